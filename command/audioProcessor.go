@@ -0,0 +1,229 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/guywithnose/runner"
+)
+
+const (
+	processedStateFileName = ".feedTube-processed.json"
+	loudnormTarget         = "I=-16:TP=-1.5:LRA=11"
+	silenceRemoveFilter    = "silenceremove=start_periods=1:start_duration=0.5:start_threshold=-50dB"
+)
+
+// AudioOptions configures the ffmpeg post processing of downloaded audio
+type AudioOptions struct {
+	Normalize   bool
+	Mono        bool
+	TrimSilence bool
+	Bitrate     string
+	Quality     string
+}
+
+// Enabled reports whether any processing was requested
+func (options AudioOptions) Enabled() bool {
+	return options.Normalize || options.Mono || options.TrimSilence || options.Bitrate != ""
+}
+
+// String describes the processing so files processed with different options can be told apart
+func (options AudioOptions) String() string {
+	steps := make([]string, 0, 4)
+	if options.TrimSilence {
+		steps = append(steps, "trimSilence")
+	}
+
+	if options.Normalize {
+		steps = append(steps, "normalize")
+	}
+
+	if options.Mono {
+		steps = append(steps, "mono")
+	}
+
+	if options.Bitrate != "" {
+		steps = append(steps, fmt.Sprintf("bitrate=%s", options.Bitrate))
+	}
+
+	return strings.Join(steps, ",")
+}
+
+// AudioProcessor runs ffmpeg over downloaded audio and records what it has processed in the output folder
+type AudioProcessor struct {
+	cmdBuilder   runner.Builder
+	outputFolder string
+	options      AudioOptions
+}
+
+// NewAudioProcessor returns a new AudioProcessor
+func NewAudioProcessor(cmdBuilder runner.Builder, outputFolder string, options AudioOptions) *AudioProcessor {
+	return &AudioProcessor{cmdBuilder: cmdBuilder, outputFolder: outputFolder, options: options}
+}
+
+// StateFile returns the file recording which files have been processed
+func (processor AudioProcessor) StateFile() string {
+	return filepath.Join(processor.outputFolder, processedStateFileName)
+}
+
+// ProcessFiles processes every item whose file has not already been processed with the current options.
+// The duration of processed items is cleared so that it gets probed again.  ffmpeg is killed when ctx is done.
+func (processor AudioProcessor) ProcessFiles(ctx context.Context, items []*VideoData) error {
+	state, err := processor.loadState()
+	if err != nil {
+		return err
+	}
+
+	signature := processor.options.String()
+	var processErr error
+	for _, item := range items {
+		fileName := getFileName(processor.outputFolder, item)
+		if state[filepath.Base(fileName)] == signature || !fileExists(fileName) {
+			continue
+		}
+
+		processErr = processor.processFile(ctx, fileName)
+		if processErr != nil {
+			break
+		}
+
+		item.Duration = ""
+		state[filepath.Base(fileName)] = signature
+	}
+
+	err = processor.saveState(state)
+	if processErr != nil {
+		return processErr
+	}
+
+	return err
+}
+
+func (processor AudioProcessor) processFile(ctx context.Context, fileName string) error {
+	filters := make([]string, 0, 5)
+	if processor.options.TrimSilence {
+		// Silence is removed from the start, then from the end by reversing the audio
+		filters = append(filters, silenceRemoveFilter, "areverse", silenceRemoveFilter, "areverse")
+	}
+
+	if processor.options.Normalize {
+		measured, err := processor.measureLoudness(ctx, fileName, filters)
+		if err != nil {
+			return err
+		}
+
+		filters = append(filters, fmt.Sprintf(
+			"loudnorm=%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+			loudnormTarget,
+			measured.InputI,
+			measured.InputTP,
+			measured.InputLRA,
+			measured.InputThresh,
+			measured.TargetOffset,
+		))
+	}
+
+	args := make([]string, 0, 6)
+	if len(filters) != 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
+
+	if processor.options.Mono {
+		args = append(args, "-ac", "1")
+	}
+
+	if processor.options.Bitrate != "" {
+		args = append(args, "-b:a", processor.options.Bitrate)
+	} else if processor.options.Quality != "" {
+		args = append(args, "-q:a", processor.options.Quality)
+	}
+
+	return runFfmpeg(ctx, processor.cmdBuilder, "process", fileName, fileName, args...)
+}
+
+type loudnessMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// measureLoudness runs the first loudnorm pass which only analyzes the audio
+func (processor AudioProcessor) measureLoudness(ctx context.Context, fileName string, filters []string) (*loudnessMeasurement, error) {
+	filters = append(append([]string{}, filters...), fmt.Sprintf("loudnorm=%s:print_format=json", loudnormTarget))
+	params := []string{"/usr/bin/ffmpeg", "-hide_banner", "-nostats", "-i", fileName, "-af", strings.Join(filters, ","), "-f", "null", "-"}
+	out, err := runCommand(ctx, processor.cmdBuilder.New("", params...))
+	if err != nil {
+		return nil, fmt.Errorf("could not measure loudness of %s: %v\nParams: '%s': %s", fileName, err, strings.Join(params, "' '"), string(out))
+	}
+
+	return parseLoudnessOutput(fileName, out)
+}
+
+// parseLoudnessOutput reads the JSON block that loudnorm prints at the end of the ffmpeg output
+func parseLoudnessOutput(fileName string, out []byte) (*loudnessMeasurement, error) {
+	start := bytes.LastIndex(out, []byte("{"))
+	end := bytes.LastIndex(out, []byte("}"))
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("could not find loudness measurement for %s", fileName)
+	}
+
+	measured := &loudnessMeasurement{}
+	err := json.Unmarshal(out[start:end+1], measured)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse loudness measurement for %s: %v", fileName, err)
+	}
+
+	if measured.InputI == "" || measured.InputTP == "" || measured.InputLRA == "" || measured.InputThresh == "" || measured.TargetOffset == "" {
+		return nil, fmt.Errorf("incomplete loudness measurement for %s", fileName)
+	}
+
+	return measured, nil
+}
+
+func (processor AudioProcessor) loadState() (map[string]string, error) {
+	stateBytes, err := ioutil.ReadFile(processor.StateFile())
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read processed state: %v", err)
+	}
+
+	state := map[string]string{}
+	err = json.Unmarshal(stateBytes, &state)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse processed state %s: %v", processor.StateFile(), err)
+	}
+
+	return state, nil
+}
+
+// saveState writes the processed state, dropping any files that no longer exist
+func (processor AudioProcessor) saveState(state map[string]string) error {
+	for fileName := range state {
+		if !fileExists(filepath.Join(processor.outputFolder, fileName)) {
+			delete(state, fileName)
+		}
+	}
+
+	stateBytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(processor.StateFile(), stateBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write processed state: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package command_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+const loudnormOutput = `[Parsed_loudnorm_0 @ 0x1]
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}`
+
+func TestAudioProcessorProcessFiles(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	item := videoData1
+	item.Duration = "01:00:00"
+	options := command.AudioOptions{Normalize: true, Mono: true, TrimSilence: true, Bitrate: "96k", Quality: "0"}
+	silence := "silenceremove=start_periods=1:start_duration=0.5:start_threshold=-50dB"
+	trim := fmt.Sprintf("%s,areverse,%s,areverse", silence, silence)
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -hide_banner -nostats -i %s/t-vId1.mp3 -af %s,loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json -f null -",
+					outputFolder,
+					trim,
+				),
+				loudnormOutput,
+				0,
+			),
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -af %s,loudnorm=I=-16:TP=-1.5:LRA=11:"+
+						"measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.20:offset=0.58:linear=true "+
+						"-ac 1 -b:a 96k %s/t-vId1.processing.mp3",
+					outputFolder,
+					trim,
+					outputFolder,
+				),
+				"",
+				0,
+			),
+		},
+	}
+	cb.ExpectedCommands[1].Closure = writeProcessedFile(t)
+	processor := command.NewAudioProcessor(cb, outputFolder, options)
+	assert.Nil(t, processor.ProcessFiles(context.Background(), []*command.VideoData{&item, &videoData2}))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "", item.Duration)
+	assertFileContents(t, fmt.Sprintf("%s/t-vId1.mp3", outputFolder), "processed")
+	assertFileContents(t, processor.StateFile(), "{\n  \"t-vId1.mp3\": \"trimSilence,normalize,mono,bitrate=96k\"\n}")
+
+	// Files that have already been processed with the same options are left alone
+	cb = &runner.Test{}
+	item.Duration = "01:00:00"
+	assert.Nil(t, command.NewAudioProcessor(cb, outputFolder, options).ProcessFiles(context.Background(), []*command.VideoData{&item}))
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "01:00:00", item.Duration)
+}
+
+func TestAudioProcessorReprocessesChangedOptions(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "gone.mp3")
+	state := `{"t-vId1.mp3": "trimSilence", "gone.mp3": "trimSilence"}`
+	assert.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/.feedTube-processed.json", outputFolder), []byte(state), 0644))
+	assert.Nil(t, os.Remove(fmt.Sprintf("%s/gone.mp3", outputFolder)))
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -ac 1 -q:a 0 %s/t-vId1.processing.mp3",
+					outputFolder,
+					outputFolder,
+				),
+				"",
+				0,
+			),
+		},
+	}
+	cb.ExpectedCommands[0].Closure = writeProcessedFile(t)
+	processor := command.NewAudioProcessor(cb, outputFolder, command.AudioOptions{Mono: true, Quality: "0"})
+	assert.Nil(t, processor.ProcessFiles(context.Background(), []*command.VideoData{&videoData1}))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assertFileContents(t, processor.StateFile(), "{\n  \"t-vId1.mp3\": \"mono\"\n}")
+}
+
+func TestAudioProcessorFfmpegFailure(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -ac 1 %s/t-vId1.processing.mp3",
+					outputFolder,
+					outputFolder,
+				),
+				"bad audio",
+				1,
+			),
+		},
+	}
+	processor := command.NewAudioProcessor(cb, outputFolder, command.AudioOptions{Mono: true})
+	err := processor.ProcessFiles(context.Background(), []*command.VideoData{&videoData1})
+	assert.EqualError(
+		t,
+		err,
+		fmt.Sprintf(
+			"could not process %s/t-vId1.mp3: exit status 1\nParams: '/usr/bin/ffmpeg' '-y' '-hide_banner' '-nostats' '-i' '%s/t-vId1.mp3' "+
+				"'-map' '0' '-map_metadata' '0' '-c:v' 'copy' '-ac' '1' '%s/t-vId1.processing.mp3': bad audio",
+			outputFolder,
+			outputFolder,
+			outputFolder,
+		),
+	)
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assertFileContents(t, processor.StateFile(), "{}")
+}
+
+func TestAudioProcessorMissingLoudnessMeasurement(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf("/usr/bin/ffmpeg -hide_banner -nostats -i %s/t-vId1.mp3 -af loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json -f null -", outputFolder),
+				`{"input_i" : "-27.61"}`,
+				0,
+			),
+		},
+	}
+	err := command.NewAudioProcessor(cb, outputFolder, command.AudioOptions{Normalize: true}).ProcessFiles(context.Background(), []*command.VideoData{&videoData1})
+	assert.EqualError(t, err, fmt.Sprintf("incomplete loudness measurement for %s/t-vId1.mp3", outputFolder))
+	assert.Equal(t, []error(nil), cb.Errors)
+}
+
+func TestAudioProcessorInvalidState(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, ".feedTube-processed.json")
+	processor := command.NewAudioProcessor(&runner.Test{}, outputFolder, command.AudioOptions{Mono: true})
+	err := processor.ProcessFiles(context.Background(), []*command.VideoData{&videoData1})
+	assert.EqualError(
+		t,
+		err,
+		fmt.Sprintf("could not parse processed state %s/.feedTube-processed.json: invalid character 'c' looking for beginning of value", outputFolder),
+	)
+}
+
+func TestCmdChannelMono(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("mono", true, "doc")
+	cb := getFfprobeRunner()
+	processCommand := newExpectedFfmpegCommand(
+		fmt.Sprintf(
+			"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -ac 1 -q:a 0 %s/t-vId1.processing.mp3",
+			outputFolder,
+			outputFolder,
+		),
+		"",
+		0,
+	)
+	processCommand.Closure = writeProcessedFile(t)
+	cb.ExpectedCommands = append(cb.ExpectedCommands[:1], append([]*runner.ExpectedCommand{processCommand}, cb.ExpectedCommands[1:]...)...)
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assertFileContents(t, fmt.Sprintf("%s/.feedTube-processed.json", outputFolder), "{\n  \"t-vId1.mp3\": \"mono\"\n}")
+}
+
+func newExpectedFfmpegCommand(cmd, output string, exitCode int) *runner.ExpectedCommand {
+	return runner.NewExpectedCommand("", regexp.QuoteMeta(cmd), output, exitCode)
+}
+
+// writeProcessedFile stands in for ffmpeg by writing the output file that ends the command
+func writeProcessedFile(t *testing.T) func(string) {
+	return func(cmd string) {
+		params := strings.Split(cmd, " ")
+		assert.Nil(t, ioutil.WriteFile(params[len(params)-1], []byte("processed"), 0644))
+	}
+}
+
+func writeOutputFiles(t *testing.T, outputFolder string, fileNames ...string) {
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	for _, fileName := range fileNames {
+		assert.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/%s", outputFolder, fileName), []byte("content"), 0644))
+	}
+}
+
+func assertFileContents(t *testing.T, fileName, expected string) {
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(contents))
+}
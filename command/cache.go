@@ -0,0 +1,196 @@
+package command
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ResponseCache keeps YouTube API responses on disk.
+// Responses younger than the TTL are reused as is and older ones are revalidated with their ETag.
+type ResponseCache struct {
+	folder string
+	ttl    time.Duration
+	dryRun bool
+}
+
+type cacheEntry struct {
+	URL         string    `json:"url"`
+	ETag        string    `json:"etag"`
+	Fetched     time.Time `json:"fetched"`
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+}
+
+type cachingTransport struct {
+	base  http.RoundTripper
+	cache *ResponseCache
+}
+
+// NewResponseCache returns a ResponseCache that stores its entries in folder
+func NewResponseCache(folder string, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{folder: folder, ttl: ttl}
+}
+
+// SetDryRun keeps the cache from saving entries.  Entries already saved are still used.
+func (cache *ResponseCache) SetDryRun(dryRun bool) {
+	cache.dryRun = dryRun
+}
+
+// Transport wraps base so GET requests are answered from the cache when possible
+func (cache *ResponseCache) Transport(base http.RoundTripper) http.RoundTripper {
+	return &cachingTransport{base: base, cache: cache}
+}
+
+// RoundTrip serves fresh entries without a request and turns a 304 for a stale entry into the cached response
+func (transport cachingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Method != http.MethodGet {
+		return transport.base.RoundTrip(request)
+	}
+
+	// Inner transports may add the API key to the request so the URL is captured first
+	url := request.URL.String()
+	entry, err := transport.cache.load(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if transport.cache.fresh(entry) {
+		return entry.response(request), nil
+	}
+
+	if entry != nil && entry.ETag != "" {
+		request = request.Clone(request.Context())
+		request.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	response, err := transport.base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotModified && entry != nil {
+		return transport.revalidate(request, response, entry)
+	}
+
+	if !transport.cache.cacheable(response) {
+		return response, nil
+	}
+
+	return transport.store(url, response)
+}
+
+// revalidate answers a 304 with the cached entry and marks it fresh again
+func (transport cachingTransport) revalidate(request *http.Request, response *http.Response, entry *cacheEntry) (*http.Response, error) {
+	_ = response.Body.Close()
+	entry.Fetched = time.Now()
+	err := transport.cache.save(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.response(request), nil
+}
+
+// store saves the body of response under url and returns the response with a body that can still be read
+func (transport cachingTransport) store(url string, response *http.Response) (*http.Response, error) {
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{
+		URL:         url,
+		ETag:        response.Header.Get("ETag"),
+		Fetched:     time.Now(),
+		ContentType: response.Header.Get("Content-Type"),
+		Body:        body,
+	}
+	err = transport.cache.save(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return response, nil
+}
+
+// fresh reports whether entry can be used without asking the server
+func (cache *ResponseCache) fresh(entry *cacheEntry) bool {
+	return entry != nil && time.Since(entry.Fetched) < cache.ttl
+}
+
+// cacheable reports whether response is worth saving.  Without an ETag it can only be used until the ttl runs out.
+func (cache *ResponseCache) cacheable(response *http.Response) bool {
+	return response.StatusCode == http.StatusOK && (response.Header.Get("ETag") != "" || cache.ttl != 0)
+}
+
+func (entry cacheEntry) response(request *http.Request) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", entry.ContentType)
+	header.Set("ETag", entry.ETag)
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       request,
+	}
+}
+
+func (cache *ResponseCache) fileName(url string) string {
+	return filepath.Join(cache.folder, fmt.Sprintf("%x.json", sha256.Sum256([]byte(url))))
+}
+
+func (cache *ResponseCache) load(url string) (*cacheEntry, error) {
+	entryBytes, err := ioutil.ReadFile(cache.fileName(url))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read cache: %v", err)
+	}
+
+	entry := &cacheEntry{}
+	// A damaged entry is fetched again
+	if json.Unmarshal(entryBytes, entry) != nil || entry.URL != url {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+func (cache *ResponseCache) save(entry *cacheEntry) error {
+	if cache.dryRun {
+		return nil
+	}
+
+	err := os.MkdirAll(cache.folder, 0777)
+	if err != nil {
+		return fmt.Errorf("could not create cache folder %s: %v", cache.folder, err)
+	}
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(cache.fileName(entry.URL), entryBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write cache: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package command_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestResponseCacheRevalidatesWithETag(t *testing.T) {
+	cacheFolder := fmt.Sprintf("%s/cache", getOutputFolder())
+	defer removeFile(t, getOutputFolder())
+	requests := make([]string, 0)
+	ts := getCacheTestServer(&requests, `"etag1"`)
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewResponseCache(cacheFolder, 0).Transport(http.DefaultTransport)}
+	assert.Equal(t, "response 1", getCachedBody(t, client, ts.URL))
+	assert.Equal(t, "response 1", getCachedBody(t, client, ts.URL))
+	assert.Equal(t, []string{"", `"etag1"`}, requests)
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	cacheFolder := fmt.Sprintf("%s/cache", getOutputFolder())
+	defer removeFile(t, getOutputFolder())
+	requests := make([]string, 0)
+	ts := getCacheTestServer(&requests, "")
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewResponseCache(cacheFolder, time.Hour).Transport(http.DefaultTransport)}
+	assert.Equal(t, "response 1", getCachedBody(t, client, ts.URL))
+	assert.Equal(t, "response 1", getCachedBody(t, client, ts.URL))
+	assert.Equal(t, []string{""}, requests)
+
+	// Without an ETag an expired entry is fetched again
+	client = &http.Client{Transport: command.NewResponseCache(cacheFolder, time.Nanosecond).Transport(http.DefaultTransport)}
+	assert.Equal(t, "response 2", getCachedBody(t, client, ts.URL))
+	assert.Equal(t, []string{"", ""}, requests)
+}
+
+func TestResponseCacheDryRun(t *testing.T) {
+	cacheFolder := fmt.Sprintf("%s/cache", getOutputFolder())
+	defer removeFile(t, getOutputFolder())
+	requests := make([]string, 0)
+	ts := getCacheTestServer(&requests, "")
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewResponseCache(cacheFolder, time.Hour).Transport(http.DefaultTransport)}
+	assert.Equal(t, "response 1", getCachedBody(t, client, ts.URL))
+
+	// Saved entries are still used but new ones aren't saved
+	cache := command.NewResponseCache(cacheFolder, time.Hour)
+	cache.SetDryRun(true)
+	client = &http.Client{Transport: cache.Transport(http.DefaultTransport)}
+	assert.Equal(t, "response 1", getCachedBody(t, client, ts.URL))
+	assert.Equal(t, "response 2", getCachedBody(t, client, fmt.Sprintf("%s/other", ts.URL)))
+	files, err := ioutil.ReadDir(cacheFolder)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestResponseCacheSkipsUncacheableResponses(t *testing.T) {
+	cacheFolder := fmt.Sprintf("%s/cache", getOutputFolder())
+	defer removeFile(t, getOutputFolder())
+	requests := make([]string, 0)
+	ts := getCacheTestServer(&requests, "")
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewResponseCache(cacheFolder, 0).Transport(http.DefaultTransport)}
+	assert.Equal(t, "response 1", getCachedBody(t, client, ts.URL))
+	assert.Equal(t, "response 2", getCachedBody(t, client, ts.URL))
+	_, err := os.Stat(cacheFolder)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestResponseCacheReadError(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "cache")
+	requests := make([]string, 0)
+	ts := getCacheTestServer(&requests, `"etag1"`)
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewResponseCache(fmt.Sprintf("%s/cache", outputFolder), 0).Transport(http.DefaultTransport)}
+	_, err := client.Get(ts.URL)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("could not read cache: open %s/cache/", outputFolder))
+}
+
+func TestCmdChannelCacheTTL(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	expectedOutputs := []string{
+		"Quota used: 202 units (channels: 2, search: 200), budget 10000\n",
+		fmt.Sprintf("Feed unchanged: %s/xmlFile\nQuota used: 0 units, budget 10000\n", outputFolder),
+	}
+	for _, expectedOutput := range expectedOutputs {
+		app, writer, _, set := getBaseAppAndFlagSet(t, outputFolder)
+		set.String("quality", "0", "doc")
+		set.Int("quotaBudget", 10000, "doc")
+		set.String("cacheFolder", fmt.Sprintf("%s/.cache", outputFolder), "doc")
+		set.Duration("cacheTTL", time.Hour, "doc")
+		cb := getFfprobeRunner()
+		assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+		assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+		assert.Equal(t, []error(nil), cb.Errors)
+		assert.Equal(t, expectedOutput, writer.String())
+	}
+}
+
+// getCacheTestServer counts its responses and answers 304 when If-None-Match matches etag
+func getCacheTestServer(requests *[]string, etag string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.Header.Get("If-None-Match"))
+		if etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+
+		fmt.Fprintf(w, "response %d", len(*requests))
+	}))
+}
+
+func getCachedBody(t *testing.T, client *http.Client, url string) string {
+	response, err := client.Get(url)
+	require.Nil(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	body, err := ioutil.ReadAll(response.Body)
+	require.Nil(t, err)
+	return string(body)
+}
@@ -2,15 +2,16 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"log/slog"
 	"time"
 
 	youtube "google.golang.org/api/youtube/v3"
-
-	"github.com/kennygrant/sanitize"
 )
 
+var errSearchLimitReached = errors.New("search limit reached")
+
 //TODO better name
 
 // ChannelInfo contains the metadata for a channel
@@ -19,47 +20,95 @@ type ChannelInfo struct {
 	Description string
 	Link        string
 	Thumbnail   string
+	Type        string
 }
 
 // ChannelScraper retrieves data about youtube videos
 type ChannelScraper struct {
 	youtubeService *youtube.Service
+	logger         *slog.Logger
 }
 
 // NewChannelScraper returns a YoutubeScraper
-func NewChannelScraper(apiKey string) *ChannelScraper {
-	youtubeService := getYoutubeService(apiKey)
-	return &ChannelScraper{youtubeService: youtubeService}
+func NewChannelScraper(apiKey string, wrappers ...TransportWrapper) *ChannelScraper {
+	youtubeService := getYoutubeService(apiKey, wrappers...)
+	return &ChannelScraper{youtubeService: youtubeService, logger: discardLogger}
+}
+
+// SetLogger sets the logger for the channel and the videos found on it
+func (scraper *ChannelScraper) SetLogger(logger *slog.Logger) {
+	scraper.logger = logger
+}
+
+type channelSource struct {
+	scraper     *ChannelScraper
+	channelName string
+	after       string
+}
+
+func newChannelSource(config SourceConfig) (Source, error) {
+	scraper := NewChannelScraper(config.APIKey, config.Transports...)
+	scraper.SetLogger(sourceLogger(config))
+	return &channelSource{scraper: scraper, channelName: config.ID, after: config.After}, nil
+}
+
+// GetVideos returns the videos on the channel
+func (source channelSource) GetVideos(ctx context.Context) ([]*VideoData, *ChannelInfo, error) {
+	return source.scraper.GetVideosForChannelWithContext(ctx, source.channelName, source.after)
 }
 
 // GetVideosForChannel returns an array of all the youtube video ids on a channel
 func (scraper ChannelScraper) GetVideosForChannel(channelName, after string) ([]*VideoData, *ChannelInfo, error) {
-	channelID, info, err := scraper.getChannelInfo(channelName)
+	return scraper.GetVideosForChannelWithContext(context.Background(), channelName, after)
+}
+
+// GetVideosForChannelWithContext returns an array of all the youtube video ids on a channel using ctx for all requests
+func (scraper ChannelScraper) GetVideosForChannelWithContext(ctx context.Context, channelName, after string) ([]*VideoData, *ChannelInfo, error) {
+	channelID, info, err := scraper.getChannelInfo(ctx, channelName)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	logger := scraper.logger.With("channel", channelID)
+	logger.Debug("Found channel", "title", info.Title)
 	listCall, err := scraper.buildSearchListCall(channelID, after)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	items, err := getSearchResults(ctx, logger, listCall, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return items, info, nil
+}
+
+// getSearchResults pages through listCall until there are no more results or limit videos have been found.
+// A limit of 0 retrieves every page.
+func getSearchResults(ctx context.Context, logger *slog.Logger, listCall *youtube.SearchListCall, limit int) ([]*VideoData, error) {
 	items := make([]*VideoData, 0)
-	err = listCall.Pages(context.Background(), func(resp *youtube.SearchListResponse) error {
-		videoPage, pageErr := parseSearchResults(resp.Items)
+	err := listCall.Pages(ctx, func(resp *youtube.SearchListResponse) error {
+		videoPage, pageErr := parseSearchResults(logger, resp.Items)
 		if pageErr != nil {
 			return pageErr
 		}
 
+		logger.Debug("Fetched search results page", "results", len(resp.Items), "videos", len(videoPage), "nextPage", resp.NextPageToken)
 		items = append(items, videoPage...)
+		if limit > 0 && len(items) >= limit {
+			items = items[:limit]
+			return errSearchLimitReached
+		}
+
 		return nil
 	})
 
-	if err != nil {
-		return nil, nil, fmt.Errorf("search request failed: %v", err)
+	if err != nil && err != errSearchLimitReached {
+		return nil, fmt.Errorf("search request failed: %v", err)
 	}
 
-	return items, info, nil
+	return items, nil
 }
 
 func (scraper ChannelScraper) buildSearchListCall(channelID, after string) (*youtube.SearchListCall, error) {
@@ -76,7 +125,7 @@ func (scraper ChannelScraper) buildSearchListCall(channelID, after string) (*you
 	return listCall, nil
 }
 
-func parseSearchResults(results []*youtube.SearchResult) ([]*VideoData, error) {
+func parseSearchResults(logger *slog.Logger, results []*youtube.SearchResult) ([]*VideoData, error) {
 	items := make([]*VideoData, 0, len(results))
 	for _, result := range results {
 		publishedTime, err := time.Parse(time.RFC3339, result.Snippet.PublishedAt)
@@ -85,33 +134,25 @@ func parseSearchResults(results []*youtube.SearchResult) ([]*VideoData, error) {
 		}
 
 		if result.Snippet.LiveBroadcastContent != "none" {
+			logger.Debug("Skipped live video", "video", result.Id.VideoId, "live", result.Snippet.LiveBroadcastContent)
 			continue
 		}
 
-		item := &VideoData{
-			GUID:        result.Id.VideoId,
-			Link:        fmt.Sprintf("https://youtu.be/%s", result.Id.VideoId),
-			Title:       result.Snippet.Title,
-			Description: fmt.Sprintf("%s https://youtu.be/%s", result.Snippet.Description, result.Id.VideoId),
-			FileName:    fmt.Sprintf("%s-%s", strings.Replace(sanitize.BaseName(result.Snippet.Title), " ", "-", -1), result.Id.VideoId),
-			PubDate:     publishedTime,
-		}
-
-		if result.Snippet.Thumbnails != nil && result.Snippet.Thumbnails.Default != nil {
-			item.Image = result.Snippet.Thumbnails.Default.Url
-		}
-
-		items = append(items, item)
+		logger.Debug("Found video", "video", result.Id.VideoId, "title", result.Snippet.Title, "published", publishedTime)
+		items = append(
+			items,
+			newVideoData(result.Id.VideoId, result.Snippet.Title, result.Snippet.ChannelTitle, result.Snippet.Description, publishedTime, result.Snippet.Thumbnails),
+		)
 	}
 
 	return items, nil
 }
 
-func (scraper ChannelScraper) getChannelInfo(channelID string) (string, *ChannelInfo, error) {
-	channel, idErr := scraper.getChannelByID(channelID)
+func (scraper ChannelScraper) getChannelInfo(ctx context.Context, channelID string) (string, *ChannelInfo, error) {
+	channel, idErr := scraper.getChannelByID(ctx, channelID)
 	if idErr != nil {
 		var err error
-		channel, err = scraper.getChannelByName(channelID)
+		channel, err = scraper.getChannelByName(ctx, channelID)
 		if err != nil {
 			return "", nil, fmt.Errorf("%v: %v", idErr, err)
 		}
@@ -121,16 +162,14 @@ func (scraper ChannelScraper) getChannelInfo(channelID string) (string, *Channel
 		Title:       channel.Snippet.Title,
 		Link:        fmt.Sprintf("https://www.youtube.com/channel/%s", channel.Id),
 		Description: channel.Snippet.Description,
-	}
-	if channel.Snippet.Thumbnails != nil && channel.Snippet.Thumbnails.Default != nil {
-		info.Thumbnail = channel.Snippet.Thumbnails.Default.Url
+		Thumbnail:   bestThumbnail(channel.Snippet.Thumbnails),
 	}
 
 	return channel.Id, info, nil
 }
 
-func (scraper ChannelScraper) getChannelByName(channelName string) (*youtube.Channel, error) {
-	listCall := scraper.youtubeService.Channels.List("snippet").ForUsername(channelName)
+func (scraper ChannelScraper) getChannelByName(ctx context.Context, channelName string) (*youtube.Channel, error) {
+	listCall := scraper.youtubeService.Channels.List("snippet").ForUsername(channelName).Context(ctx)
 	items, err := makeChannelRequest(listCall)
 	if err != nil {
 		return nil, err
@@ -143,8 +182,8 @@ func (scraper ChannelScraper) getChannelByName(channelName string) (*youtube.Cha
 	return items[0], nil
 }
 
-func (scraper ChannelScraper) getChannelByID(channelName string) (*youtube.Channel, error) {
-	listCall := scraper.youtubeService.Channels.List("snippet").Id(channelName)
+func (scraper ChannelScraper) getChannelByID(ctx context.Context, channelName string) (*youtube.Channel, error) {
+	listCall := scraper.youtubeService.Channels.List("snippet").Id(channelName).Context(ctx)
 	items, err := makeChannelRequest(listCall)
 	if err != nil {
 		return nil, err
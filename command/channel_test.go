@@ -1,6 +1,7 @@
 package command_test
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -697,6 +698,102 @@ func getBaseRunner() *runner.Test {
 	}
 }
 
+func TestCmdChannelInterrupted(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "xmlFile")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	ctx, cancel := context.WithCancel(context.Background())
+	command.SetContext(app, ctx)
+	cb := getFfprobeRunner()
+	cb.ExpectedCommands = cb.ExpectedCommands[:1]
+	cb.ExpectedCommands[0].Closure = func(string) {
+		writeOutputFiles(t, outputFolder, "t2-vId2.webm.part")
+		cancel()
+	}
+	assert.EqualError(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)), "download of t2-vId2 interrupted: context canceled")
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assertFileContents(t, fmt.Sprintf("%s/xmlFile", outputFolder), "content")
+	_, err := os.Stat(fmt.Sprintf("%s/t2-vId2.webm.part", outputFolder))
+	assert.True(t, os.IsNotExist(err))
+	assertFileContents(t, fmt.Sprintf("%s/t-vId1.mp3", outputFolder), "content")
+	assert.Equal(t, "", errWriter.String())
+}
+
+func TestCmdChannelDryRun(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "junk")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, writer, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	set.Bool("chapters", true, "doc")
+	set.Bool("dryRun", true, "doc")
+	cb := getFfprobeRunner()
+	// youtube-dl is never run
+	cb.ExpectedCommands = cb.ExpectedCommands[1:]
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(
+		t,
+		fmt.Sprintf(
+			"Would download: t2-vId2 (https://youtu.be/vId2)\nAlready downloaded: t-vId1\nFeed would change: %s/xmlFile\nWould remove file: %s/junk\n",
+			outputFolder,
+			outputFolder,
+		),
+		writer.String(),
+	)
+	assert.Equal(t, "", errWriter.String())
+	files, err := ioutil.ReadDir(outputFolder)
+	assert.Nil(t, err)
+	fileNames := make([]string, 0, len(files))
+	for _, file := range files {
+		fileNames = append(fileNames, file.Name())
+	}
+
+	assert.Equal(t, []string{"junk", "t-vId1.mp3"}, fileNames)
+}
+
+func TestCmdChannelDryRunUnchangedFeed(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "t2-vId2.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	for _, dryRun := range []bool{false, true} {
+		app, writer, _, set := getBaseAppAndFlagSet(t, outputFolder)
+		set.String("quality", "0", "doc")
+		set.Bool("dryRun", dryRun, "doc")
+		cb := &runner.Test{
+			ExpectedCommands: []*runner.ExpectedCommand{
+				runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t-vId1.mp3", outputFolder), "Duration: 02:13:45.22, start", 0),
+				runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t2-vId2.mp3", outputFolder), "Duration: 00:13:45.22, start", 0),
+			},
+		}
+		assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+		assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+		assert.Equal(t, []error(nil), cb.Errors)
+		if dryRun {
+			assert.Equal(
+				t,
+				fmt.Sprintf("Already downloaded: t-vId1\nAlready downloaded: t2-vId2\nFeed unchanged: %s/xmlFile\n", outputFolder),
+				writer.String(),
+			)
+		}
+	}
+}
+
 func getFfprobeRunner() *runner.Test {
 	return &runner.Test{
 		ExpectedCommands: []*runner.ExpectedCommand{
@@ -0,0 +1,130 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chaptersVersion   = "1.2.0"
+	chaptersMIMEType  = "application/json+chapters"
+	chaptersExtension = ".chapters.json"
+	minChapters       = 2
+)
+
+// chapterRegex matches a description line that starts with a timestamp like "05:12 Topic", "(1:02:03) - Topic" or "[00:00] Intro"
+var chapterRegex = regexp.MustCompile(`^\s*[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*(?:[-–—:|]\s*)?(.*?)\s*$`)
+
+var durationRegex = regexp.MustCompile(`^\d+:\d{2}:\d{2}$`)
+
+// Chapter is a named position in an episode
+type Chapter struct {
+	Start time.Duration
+	Title string
+}
+
+type chaptersFile struct {
+	Version  string             `json:"version"`
+	Chapters []chaptersFileItem `json:"chapters"`
+}
+
+type chaptersFileItem struct {
+	StartTime float64 `json:"startTime"`
+	Title     string  `json:"title"`
+}
+
+// ParseChapters finds the timestamped lines in a video description.
+// Timestamps that don't move forward are ignored and nil is returned unless there are at least two chapters.
+func ParseChapters(description string) []Chapter {
+	chapters := make([]Chapter, 0)
+	for _, line := range strings.Split(description, "\n") {
+		matches := chapterRegex.FindStringSubmatch(line)
+		if matches == nil || matches[2] == "" {
+			continue
+		}
+
+		start := parseTimestamp(matches[1])
+		if len(chapters) != 0 && start <= chapters[len(chapters)-1].Start {
+			continue
+		}
+
+		chapters = append(chapters, Chapter{Start: start, Title: matches[2]})
+	}
+
+	if len(chapters) < minChapters {
+		return nil
+	}
+
+	return chapters
+}
+
+func parseTimestamp(timestamp string) time.Duration {
+	var seconds int
+	for _, part := range strings.Split(timestamp, ":") {
+		// The regex only lets digits through
+		value, _ := strconv.Atoi(part)
+		seconds = seconds*60 + value
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// parseDuration parses an HH:MM:SS duration like the ones in itunes:duration
+func parseDuration(duration string) (time.Duration, error) {
+	if !durationRegex.MatchString(duration) {
+		return 0, fmt.Errorf("invalid duration %s", duration)
+	}
+
+	return parseTimestamp(duration), nil
+}
+
+func getChaptersFileName(outputFolder string, item *VideoData) string {
+	return fmt.Sprintf("%s/%s%s", outputFolder, item.FileName, chaptersExtension)
+}
+
+// WriteChapterFiles writes a podcast:chapters JSON file next to the media of each downloaded item that has chapters
+func WriteChapterFiles(items []*VideoData, outputFolder string) error {
+	for _, item := range items {
+		if len(item.Chapters) == 0 || !fileExists(getFileName(outputFolder, item)) {
+			continue
+		}
+
+		err := writeChaptersFile(getChaptersFileName(outputFolder, item), item.Chapters)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeChaptersFile leaves the file alone when it already has the same chapters
+func writeChaptersFile(fileName string, chapters []Chapter) error {
+	file := chaptersFile{Version: chaptersVersion, Chapters: make([]chaptersFileItem, 0, len(chapters))}
+	for _, chapter := range chapters {
+		file.Chapters = append(file.Chapters, chaptersFileItem{StartTime: chapter.Start.Seconds(), Title: chapter.Title})
+	}
+
+	chaptersBytes, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	existingBytes, err := ioutil.ReadFile(fileName)
+	if err == nil && bytes.Equal(existingBytes, chaptersBytes) {
+		return nil
+	}
+
+	err = ioutil.WriteFile(fileName, chaptersBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write chapters: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+const chapterDescription = "Today we talk about things\n\n00:00 Intro\n(05:12) - The first topic\n[1:02:03] | Wrap up\n" +
+	"01:00 out of order\nat 12:00 we laugh https://youtu.be/vId1"
+
+var expectedChapters = []command.Chapter{
+	{Start: 0, Title: "Intro"},
+	{Start: 5*time.Minute + 12*time.Second, Title: "The first topic"},
+	{Start: time.Hour + 2*time.Minute + 3*time.Second, Title: "Wrap up"},
+}
+
+func TestParseChapters(t *testing.T) {
+	assert.Equal(t, expectedChapters, command.ParseChapters(chapterDescription))
+}
+
+func TestParseChaptersNeedsTwoChapters(t *testing.T) {
+	assert.Nil(t, command.ParseChapters("00:00 Intro\nno other timestamps"))
+	assert.Nil(t, command.ParseChapters("d https://youtu.be/vId1"))
+}
+
+func TestWriteChapterFiles(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	item := videoData1
+	item.Chapters = expectedChapters
+	missing := videoData2
+	missing.Chapters = expectedChapters
+	assert.Nil(t, command.WriteChapterFiles([]*command.VideoData{&item, &missing, &videoData1}, outputFolder))
+	assertFileContents(
+		t,
+		fmt.Sprintf("%s/t-vId1.chapters.json", outputFolder),
+		`{
+  "version": "1.2.0",
+  "chapters": [
+    {
+      "startTime": 0,
+      "title": "Intro"
+    },
+    {
+      "startTime": 312,
+      "title": "The first topic"
+    },
+    {
+      "startTime": 3723,
+      "title": "Wrap up"
+    }
+  ]
+}`,
+	)
+	_, err := os.Stat(fmt.Sprintf("%s/t2-vId2.chapters.json", outputFolder))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestXMLBuilderChapters(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "t-vId1.chapters.json")
+	xmlFileName := fmt.Sprintf("%s/xmlFile", outputFolder)
+	item := videoData1
+	item.Duration = "01:10:00"
+	_, err := getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), []*command.VideoData{&item})
+	assert.Nil(t, err)
+	xmlBytes, err := ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	assert.Contains(
+		t,
+		string(xmlBytes),
+		`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:podcast="https://podcastindex.org/namespace/1.0">`,
+	)
+	assert.Contains(t, string(xmlBytes), `<podcast:chapters url="http://foo.com/t-vId1.chapters.json" type="application/json+chapters"></podcast:chapters>`)
+}
+
+func TestCmdChannelChapters(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "t2-vId2.chapters.json")
+	responses := getDefaultChannelResponses()
+	responses["/search?alt=json&channelId=awesomeChannelId&key=fakeApiKey&part=snippet&type=video"] = getChannelSearchPageWithDescription(
+		"00:00 Intro\n05:12 The first topic",
+	)
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("chapters", true, "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "", errWriter.String())
+	assertFileContents(
+		t,
+		fmt.Sprintf("%s/t-vId1.chapters.json", outputFolder),
+		"{\n  \"version\": \"1.2.0\",\n  \"chapters\": [\n    {\n      \"startTime\": 0,\n      \"title\": \"Intro\"\n    },\n"+
+			"    {\n      \"startTime\": 312,\n      \"title\": \"The first topic\"\n    }\n  ]\n}",
+	)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	require.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), `<podcast:chapters url="http://foo.com/t-vId1.chapters.json" type="application/json+chapters"></podcast:chapters>`)
+}
+
+func TestSpeedVariantItemsMoveChapters(t *testing.T) {
+	variant, err := command.NewSpeedVariant(&runner.Test{}, "/tmp/podcast", 1.5, "0")
+	assert.Nil(t, err)
+	item := videoData1
+	item.Chapters = expectedChapters
+	variantItems := variant.Items([]*command.VideoData{&item})
+	assert.Equal(
+		t,
+		[]command.Chapter{
+			{Start: 0, Title: "Intro"},
+			{Start: 3*time.Minute + 28*time.Second, Title: "The first topic"},
+			{Start: 41*time.Minute + 22*time.Second, Title: "Wrap up"},
+		},
+		variantItems[0].Chapters,
+	)
+	assert.Equal(t, expectedChapters, item.Chapters)
+}
+
+// getChannelSearchPageWithDescription returns the first page of channel results with a new description for vId1
+func getChannelSearchPageWithDescription(description string) string {
+	searchPage := youtube.SearchListResponse{}
+	searchURL := "/search?alt=json&channelId=awesomeChannelId&key=fakeApiKey&part=snippet&type=video"
+	_ = json.Unmarshal([]byte(getDefaultChannelResponses()[searchURL]), &searchPage)
+	searchPage.Items[1].Snippet.Description = description
+	bytes, _ := json.Marshal(searchPage)
+	return string(bytes)
+}
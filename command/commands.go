@@ -1,6 +1,8 @@
 package command
 
 import (
+	"time"
+
 	"github.com/guywithnose/runner"
 	"github.com/urfave/cli"
 )
@@ -37,6 +39,151 @@ var flags = []cli.Flag{
 		Name:  "overrideTitle, t",
 		Usage: "Manually set the feed title",
 	},
+	cli.StringFlag{
+		Name:  "overrideDescription",
+		Usage: "Manually set the feed description",
+	},
+	cli.StringFlag{
+		Name:  "overrideImage",
+		Usage: "Manually set the URL of the feed artwork",
+	},
+	cli.BoolFlag{
+		Name: "serial",
+		Usage: "Mark the feed as serial and number its episodes by playlist position. " +
+			"Publish dates are rewritten so podcatchers that sort by date keep the episodes in order.",
+	},
+	cli.BoolFlag{
+		Name: "incremental",
+		Usage: "Merge the videos into the existing xmlFile instead of rebuilding it. " +
+			"Episodes that are no longer found are kept as long as their audio file still exists.",
+	},
+	cli.BoolFlag{
+		Name:  "tag",
+		Usage: "Embed the title, channel, feed title, date, episode number, video URL and thumbnail into each newly downloaded file",
+	},
+	cli.BoolFlag{
+		Name:  "normalize",
+		Usage: "Normalize the loudness of each file to -16 LUFS with a two pass EBU R128 loudnorm",
+	},
+	cli.BoolFlag{
+		Name:  "mono",
+		Usage: "Downmix each file to mono",
+	},
+	cli.BoolFlag{
+		Name:  "trimSilence",
+		Usage: "Trim silence from the start and end of each file",
+	},
+	cli.StringFlag{
+		Name:  "bitrate",
+		Usage: "Re-encode each file at a target bitrate (e.g. 96k)",
+	},
+	cli.BoolFlag{
+		Name:  "chapters",
+		Usage: "Write a podcast:chapters JSON file for each video with timestamps in its description and link it from the feed",
+	},
+	cli.BoolFlag{
+		Name:  "embedChapters",
+		Usage: "Also embed the description timestamps as ID3 chapters when tagging",
+	},
+	cli.BoolFlag{
+		Name:  "showNotes",
+		Usage: "Add the description as HTML show notes with clickable links and timestamps",
+	},
+	cli.StringFlag{
+		Name: "transcripts",
+		Usage: "Download the subtitles (or automatic captions) in a language (e.g. en) with each new video. " +
+			"They are converted to WebVTT, SRT and text transcripts and linked from the feed.",
+	},
+	cli.StringFlag{
+		Name: "sponsorBlock",
+		Usage: "Cut the SponsorBlock segments in a comma separated list of categories (e.g. sponsor,selfpromo,interaction) " +
+			"out of each newly downloaded file",
+	},
+	cli.StringFlag{
+		Name:  "sponsorBlockURL",
+		Usage: "The SponsorBlock compatible API to fetch segments from",
+		Value: SponsorBlockURLBase,
+	},
+	cli.BoolFlag{
+		Name:  "localImages",
+		Usage: "Download the channel and video thumbnails into the output folder and serve them from the baseURL",
+	},
+	cli.StringFlag{
+		Name:  "squareImages",
+		Usage: "Crop or pad the local thumbnails into a 1400-3000px square as Apple requires (crop or pad)",
+	},
+	cli.Float64Flag{
+		Name: "speed",
+		Usage: "Also build a sped up copy of the feed (e.g. 1.5) with its files in a sibling of the output folder. " +
+			"The pitch is preserved and the original downloads are reused.",
+	},
+	cli.StringFlag{
+		Name:  "speedBaseURL",
+		Usage: "The base URL to access the sped up files (defaults to the baseURL with the speed appended)",
+	},
+	cli.StringFlag{
+		Name:  "quotaFile",
+		Usage: "Keep the YouTube API quota used each day in this file so it is shared between runs",
+	},
+	cli.IntFlag{
+		Name:  "quotaBudget",
+		Usage: "Refuse YouTube API calls that would take the daily quota used past this many units (search costs 100, lists cost 1)",
+	},
+	cli.StringFlag{
+		Name:  "cacheFolder",
+		Usage: "Cache YouTube API responses in this folder and revalidate them with their ETag",
+	},
+	cli.DurationFlag{
+		Name:  "cacheTTL",
+		Usage: "Reuse cached YouTube API responses younger than this (e.g. 6h) without revalidating them",
+	},
+	cli.BoolFlag{
+		Name:  "dryRun",
+		Usage: "Print what would be downloaded and removed and whether the feed would change without writing anything, not even the quotaFile or cacheFolder",
+	},
+	cli.StringFlag{
+		Name:  "report",
+		Usage: "Write a JSON report of what the run did to this file",
+	},
+	cli.StringFlag{
+		Name:  "metricsFile",
+		Usage: "Write Prometheus metrics to this file for the node_exporter textfile collector (use a .prom extension)",
+	},
+	cli.BoolFlag{
+		Name:  "verbose",
+		Usage: "Log what the run is doing, including the youtube-dl output",
+	},
+	cli.BoolFlag{
+		Name:  "quiet",
+		Usage: "Only log errors and don't print any other messages",
+	},
+	cli.StringFlag{
+		Name:  "logFormat",
+		Usage: "Log as text (logfmt) or json",
+		Value: "text",
+	},
+	cli.StringFlag{
+		Name:  "output",
+		Usage: "Print messages as text or print the run report as json instead",
+		Value: "text",
+	},
+	cli.BoolFlag{
+		Name:  "noWait",
+		Usage: "Fail right away instead of waiting when another run is building into the same outputFolder",
+	},
+	cli.DurationFlag{
+		Name:  "wait",
+		Usage: "Give up waiting for another run building into the same outputFolder after this long (default: wait until it finishes)",
+	},
+	cli.IntFlag{
+		Name:  "retries",
+		Usage: "Retry failed YouTube API requests and downloads this many times",
+	},
+	cli.DurationFlag{
+		Name:  "retryDelay",
+		Usage: "Wait around this long before the first retry, doubling the wait for each retry after",
+		Value: time.Second,
+	},
 	cli.StringFlag{
 		Name:  "quality, q",
 		Usage: "Set the audio quality (see man ffmpeg)",
@@ -68,4 +215,107 @@ var Commands = []cli.Command{
 		BashComplete: Completion,
 		Flags:        flags,
 	},
+	{
+		Name:         "search",
+		Aliases:      []string{"s"},
+		Usage:        "Builds your rss file from a youtube search",
+		Action:       CmdSearch(runner.Real{}),
+		BashComplete: Completion,
+		Flags: append(
+			flags,
+			cli.IntFlag{
+				Name:  "days, d",
+				Usage: "Only include videos published in the last number of days (0 for no limit)",
+				Value: defaultSearchDays,
+			},
+			cli.StringFlag{
+				Name:  "order",
+				Usage: "Order search results by date or relevance",
+				Value: defaultSearchOrder,
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Usage: "The maximum number of search results to retrieve (0 for no limit)",
+				Value: defaultSearchLimit,
+			},
+			cli.StringFlag{
+				Name:  "seenFile",
+				Usage: "A file to remember previously found videos in so they stay in the feed when search rankings change",
+			},
+		),
+	},
+	{
+		Name:         "merge",
+		Aliases:      []string{"m"},
+		Usage:        "Builds one rss file from several youtube channels, playlists or searches",
+		Action:       CmdMerge(runner.Real{}),
+		BashComplete: Completion,
+		Flags: append(
+			flags,
+			cli.StringFlag{
+				Name:  "after, a",
+				Usage: "Only process channel videos after a given date",
+			},
+			cli.BoolFlag{
+				Name:  "seasons",
+				Usage: "Number each source as its own season (use with --serial)",
+			},
+			cli.IntFlag{
+				Name:  "days, d",
+				Usage: "Only include search results published in the last number of days (0 for no limit)",
+				Value: defaultSearchDays,
+			},
+			cli.StringFlag{
+				Name:  "order",
+				Usage: "Order search results by date or relevance",
+				Value: defaultSearchOrder,
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Usage: "The maximum number of results to retrieve for each search (0 for no limit)",
+				Value: defaultSearchLimit,
+			},
+		),
+	},
+	{
+		Name:         "list",
+		Aliases:      []string{"l"},
+		Usage:        "Builds your rss file from a file listing youtube videos",
+		Action:       CmdList(runner.Real{}),
+		BashComplete: Completion,
+		Flags:        flags,
+	},
+	{
+		Name:         "daemon",
+		Usage:        "Builds the feeds in a config file on their own schedules until stopped",
+		Action:       CmdDaemon(runner.Real{}),
+		BashComplete: Completion,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "config, c",
+				Usage: "The JSON file listing the feeds to build (reloaded on SIGHUP)",
+			},
+			cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "Build at most this many feeds at once (overrides the concurrency in the config, default 1)",
+			},
+			cli.StringFlag{
+				Name:  "healthAddress",
+				Usage: "Serve the health status on /health and Prometheus metrics on /metrics at this address (e.g. :8080)",
+			},
+			cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "Log what the daemon and each feed are doing",
+			},
+			cli.BoolFlag{
+				Name:  "quiet",
+				Usage: "Only log errors",
+			},
+			cli.StringFlag{
+				Name:  "logFormat",
+				Usage: "Log as text (logfmt) or json",
+				Value: "text",
+			},
+		},
+	},
 }
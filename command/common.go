@@ -1,14 +1,22 @@
 package command
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/guywithnose/runner"
 	"github.com/urfave/cli"
 )
 
+// contextMetadataKey is where SetContext keeps the context in the app metadata
+const contextMetadataKey = "context"
+
 func checkFlags(c *cli.Context) error {
 	if c.String("outputFolder") == "" {
 		return cli.NewExitError("You must specify an outputFolder", 1)
@@ -37,15 +45,27 @@ func getRelatedFiles(items []*VideoData, xmlFile, outputFolder string) []string
 	}
 
 	for _, item := range items {
-		filePath, err := filepath.Abs(fmt.Sprintf("%s/%s.mp3", outputFolder, item.FileName))
-		if err == nil {
-			relatedFiles = append(relatedFiles, filePath)
+		relatedFiles = append(relatedFiles, getAbsolutePaths(getFileName(outputFolder, item), getChaptersFileName(outputFolder, item))...)
+		for _, format := range transcriptFormats {
+			relatedFiles = append(relatedFiles, getAbsolutePaths(getTranscriptFileName(outputFolder, item, format.extension))...)
 		}
 	}
 
 	return relatedFiles
 }
 
+func getAbsolutePaths(fileNames ...string) []string {
+	absolutePaths := make([]string, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		absolutePath, err := filepath.Abs(fileName)
+		if err == nil {
+			absolutePaths = append(absolutePaths, absolutePath)
+		}
+	}
+
+	return absolutePaths
+}
+
 func filterItems(filter string, items []*VideoData) []*VideoData {
 	filteredItems := make([]*VideoData, 0, len(items))
 	for _, item := range items {
@@ -57,32 +77,621 @@ func filterItems(filter string, items []*VideoData) []*VideoData {
 	return filteredItems
 }
 
-// Build downloads the videos and builds the feed XML
-func Build(c *cli.Context, cmdBuilder runner.Builder, items []*VideoData, info *ChannelInfo) error {
+// CmdSource builds an rss feed from the registered source type using the single command argument as the source ID
+func CmdSource(sourceType, usage string, cmdBuilder runner.Builder) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return cli.NewExitError(usage, 1)
+		}
+
+		err := checkFlags(c)
+		if err != nil {
+			return err
+		}
+
+		return buildSource(c, cmdBuilder, SourceConfig{
+			Type:     sourceType,
+			ID:       c.Args().Get(0),
+			APIKey:   c.String("apiKey"),
+			After:    c.String("after"),
+			Days:     c.Int("days"),
+			Order:    c.String("order"),
+			Limit:    c.Int("limit"),
+			SeenFile: c.String("seenFile"),
+		})
+	}
+}
+
+// buildSource builds the feed for the source described by config.
+// The API quota used is printed when quota tracking is on and the run report is written when one is asked for.
+func buildSource(c *cli.Context, cmdBuilder runner.Builder, config SourceConfig) error {
+	output := c.String("output")
+	if output != "" && output != "text" && output != "json" {
+		return fmt.Errorf("invalid output %s: must be text or json", output)
+	}
+
+	logger, err := getLogger(c)
+	if err != nil {
+		return err
+	}
+
+	writer := c.App.Writer
+	defer redirectMessages(c, output)()
+	config.DryRun = c.Bool("dryRun")
+	report := NewRunReport()
+	feed := NewFeedReport(config, c.String("xmlFile"), c.String("outputFolder"))
+	report.AddFeed(feed)
+	logger = logger.With("feed", feed.Source)
+	config.Logger = logger
+	quota := addTransports(c, &config, logger)
+	source, err := NewSource(config)
+	if err == nil {
+		err = BuildWithReport(c, cmdBuilder, source, feed, logger)
+	}
+
+	if c.String("quotaFile") != "" || c.Int("quotaBudget") != 0 {
+		// The summary is printed on failure too since running out of quota is a likely cause
+		fmt.Fprintln(c.App.Writer, quota.Summary())
+	}
+
+	feed.QuotaUsed = quota.Used()
+	feed.Finish(err)
+	report.Finish()
+	reportErr := writeReport(c, writer, report)
+	if reportErr == nil {
+		reportErr = writeMetrics(c, err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return reportErr
+}
+
+// redirectMessages sends the messages meant for Writer to ErrWriter when Writer gets the JSON report, or nowhere when quiet is set.
+// It returns the function that puts Writer back.
+func redirectMessages(c *cli.Context, output string) func() {
+	writer := c.App.Writer
+	if output != "json" && !c.Bool("quiet") {
+		return func() {}
+	}
+
+	c.App.Writer = c.App.ErrWriter
+	if c.Bool("quiet") {
+		c.App.Writer = ioutil.Discard
+	}
+
+	return func() {
+		c.App.Writer = writer
+	}
+}
+
+// addTransports adds the API client transports to config and returns the quota tracker, which is always used for the report
+func addTransports(c *cli.Context, config *SourceConfig, logger *slog.Logger) *QuotaTracker {
+	// Metrics and logging go innermost so that every request sent is seen, retries included
+	config.Transports = append(config.Transports, DefaultMetrics, LoggingTransport(logger))
+	// Quota goes inside the retries so every attempt sent is charged like YouTube charges it
+	quota := NewQuotaTracker(c.String("quotaFile"), c.Int("quotaBudget"))
+	quota.SetDryRun(config.DryRun)
+	config.Transports = append(config.Transports, quota)
+	if c.Int("retries") > 0 {
+		config.Transports = append(config.Transports, getRetryPolicy(c))
+	}
+
+	if c.String("cacheFolder") != "" {
+		// The cache goes outside the quota tracker so that fresh cached responses cost nothing
+		cache := NewResponseCache(c.String("cacheFolder"), c.Duration("cacheTTL"))
+		cache.SetDryRun(config.DryRun)
+		config.Transports = append(config.Transports, cache)
+	}
+
+	return quota
+}
+
+// writeMetrics records how the run went and writes the metrics to the --metricsFile
+func writeMetrics(c *cli.Context, runErr error) error {
+	if c.Bool("dryRun") {
+		return nil
+	}
+
+	DefaultMetrics.recordRun(c.String("outputFolder"), runErr)
+	if c.String("metricsFile") == "" {
+		return nil
+	}
+
+	return DefaultMetrics.WriteFile(c.String("metricsFile"))
+}
+
+// writeReport saves the report to the --report file and prints it for --output json
+func writeReport(c *cli.Context, writer io.Writer, report *RunReport) error {
+	if c.String("report") != "" {
+		err := report.Write(c.String("report"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.String("output") == "json" {
+		reportBytes, err := report.JSON()
+		if err != nil {
+			return err
+		}
+
+		_, err = writer.Write(reportBytes)
+		return err
+	}
+
+	return nil
+}
+
+// Build retrieves the videos from source, downloads them and builds the feed XML
+func Build(c *cli.Context, cmdBuilder runner.Builder, source Source) error {
+	logger, err := getLogger(c)
+	if err != nil {
+		return err
+	}
+
+	return BuildWithReport(c, cmdBuilder, source, NewFeedReport(SourceConfig{}, c.String("xmlFile"), c.String("outputFolder")), logger)
+}
+
+// BuildWithReport builds the feed like Build and records what it did in feed
+func BuildWithReport(c *cli.Context, cmdBuilder runner.Builder, source Source, feed *FeedReport, logger *slog.Logger) error {
+	ctx := getContext(c)
+	lock := NewFeedLock(c.String("outputFolder"))
+	if !c.Bool("dryRun") {
+		err := lock.Acquire(ctx, !c.Bool("noWait"), c.Duration("wait"))
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = lock.Release()
+		}()
+	}
+
+	processors, err := newFeedProcessors(c, cmdBuilder)
+	if err != nil {
+		return err
+	}
+
+	items, info, err := source.GetVideos(ctx)
+	feed.Step("fetch")
+	if err != nil {
+		return err
+	}
+
+	feed.Found = len(items)
+	logger.Info("Fetched videos", "count", len(items))
+	items, err = prepareItems(c, logger, feed, info, items)
+	if err != nil {
+		return err
+	}
+
+	err = downloadItems(c, cmdBuilder, logger, processors, feed, info, items)
+	if err != nil {
+		return err
+	}
+
+	feed.Step("download")
+	err = processors.processFiles(c, info, items)
+	if err != nil {
+		return err
+	}
+
+	feed.Step("process")
+	err = writeFeeds(c, cmdBuilder, logger, processors, feed, info, items)
+	if err != nil {
+		return err
+	}
+
+	feed.Step("feed")
+	if !c.Bool("cleanupUnrelatedFiles") {
+		return nil
+	}
+
+	err = cleanupFeedFolders(c, logger, lock, processors, feed, info, items)
+	feed.Step("cleanup")
+	return err
+}
+
+// feedProcessors holds the optional steps of a build, which are nil when their flags aren't set
+type feedProcessors struct {
+	variant        *SpeedVariant
+	localizer      *ImageLocalizer
+	audioProcessor *AudioProcessor
+	segmentRemover *SegmentRemover
+	postProcessors []PostProcessor
+}
+
+func newFeedProcessors(c *cli.Context, cmdBuilder runner.Builder) (*feedProcessors, error) {
+	processors := &feedProcessors{}
+	if c.Float64("speed") != 0 {
+		var err error
+		processors.variant, err = NewSpeedVariant(cmdBuilder, c.String("outputFolder"), c.Float64("speed"), c.String("quality"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Bool("localImages") || c.String("squareImages") != "" {
+		var err error
+		processors.localizer, err = NewImageLocalizer(cmdBuilder, nil, c.String("outputFolder"), c.String("baseURL"), c.String("squareImages"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	audioOptions := AudioOptions{
+		Normalize:   c.Bool("normalize"),
+		Mono:        c.Bool("mono"),
+		TrimSilence: c.Bool("trimSilence"),
+		Bitrate:     c.String("bitrate"),
+		Quality:     c.String("quality"),
+	}
+	if audioOptions.Enabled() {
+		processors.audioProcessor = NewAudioProcessor(cmdBuilder, c.String("outputFolder"), audioOptions)
+	}
+
+	return processors, nil
+}
+
+// applyOverrides replaces the channel details with the ones given on the command line
+func applyOverrides(c *cli.Context, info *ChannelInfo) {
+	if c.String("overrideTitle") != "" {
+		info.Title = c.String("overrideTitle")
+	}
+
+	if c.String("overrideDescription") != "" {
+		info.Description = c.String("overrideDescription")
+	}
+
+	if c.String("overrideImage") != "" {
+		info.Thumbnail = c.String("overrideImage")
+	}
+}
+
+// prepareItems applies the overrides, filters and ordering flags and fills in the chapters and show notes
+func prepareItems(c *cli.Context, logger *slog.Logger, feed *FeedReport, info *ChannelInfo, items []*VideoData) ([]*VideoData, error) {
+	applyOverrides(c, info)
 	if c.String("filter") != "" {
-		items = filterItems(c.String("filter"), items)
+		filtered := filterItems(c.String("filter"), items)
+		logger.Info("Filtered videos", "filter", c.String("filter"), "kept", len(filtered), "removed", len(items)-len(filtered))
+		feed.AddItems(missingItems(items, filtered), ItemFiltered, fmt.Sprintf("does not match filter %s", c.String("filter")))
+		items = filtered
+	}
+
+	if c.Bool("incremental") && c.String("xmlFile") != "" {
+		existing, err := ReadFeedItems(c.String("xmlFile"))
+		if err != nil {
+			return nil, err
+		}
+
+		items = mergeExistingItems(existing, items, c.String("outputFolder"))
 	}
 
-	err := NewDownloader(cmdBuilder, c.String("outputFolder"), c.String("quality")).DownloadVideos(items)
+	if c.Bool("serial") {
+		info.Type = serialFeedType
+		orderSerialItems(items)
+	}
+
+	for _, item := range items {
+		if c.Bool("chapters") || c.Bool("embedChapters") {
+			// The video link is appended to the description and would end up in the last chapter title
+			item.Chapters = ParseChapters(strings.TrimSuffix(item.Description, fmt.Sprintf(" %s", item.Link)))
+		}
+
+		if c.Bool("showNotes") {
+			item.ShowNotes = RenderShowNotes(item)
+		}
+	}
+
+	return items, nil
+}
+
+// addPostProcessors sets up the processors that run on each new download
+func (processors *feedProcessors) addPostProcessors(c *cli.Context, cmdBuilder runner.Builder, info *ChannelInfo, items []*VideoData) error {
+	if c.String("sponsorBlock") != "" {
+		segmentSource := NewSponsorBlock(c.String("sponsorBlockURL"), strings.Split(c.String("sponsorBlock"), ","), nil)
+		processors.segmentRemover = NewSegmentRemover(cmdBuilder, c.String("outputFolder"), segmentSource, c.String("quality"))
+		err := processors.segmentRemover.AdjustItems(items)
+		if err != nil {
+			return err
+		}
+
+		// Segments are removed before tagging so embedded chapters line up with the shorter file
+		processors.postProcessors = append(processors.postProcessors, processors.segmentRemover)
+	}
+
+	if c.Bool("tag") {
+		processors.postProcessors = append(processors.postProcessors, NewTagger(cmdBuilder, info, nil, c.Bool("embedChapters")))
+	}
+
+	return nil
+}
+
+// downloadItems downloads the items that aren't downloaded yet or lists them on a dry run
+func downloadItems(
+	c *cli.Context,
+	cmdBuilder runner.Builder,
+	logger *slog.Logger,
+	processors *feedProcessors,
+	feed *FeedReport,
+	info *ChannelInfo,
+	items []*VideoData,
+) error {
+	err := processors.addPostProcessors(c, cmdBuilder, info, items)
 	if err != nil {
 		return err
 	}
 
-	if c.String("xmlFile") != "" {
-		err := NewXMLBuilder(cmdBuilder, c.String("xmlFile"), c.String("outputFolder"), c.String("baseURL"), getGenerator(), info).BuildRss(items)
+	downloader := NewDownloader(
+		cmdBuilder,
+		c.String("outputFolder"),
+		c.String("quality"),
+		c.String("transcripts"),
+		getRetryPolicy(c),
+		processors.postProcessors...,
+	)
+	downloader.SetLogger(logger)
+	pending, existing := downloader.Plan(items)
+	feed.AddItems(existing, ItemSkipped, "already downloaded")
+	if c.Bool("dryRun") {
+		printDownloadPlan(c.App.Writer, pending, existing)
+		feed.AddItems(pending, ItemSkipped, "dry run")
+		return nil
+	}
+
+	err = downloader.DownloadVideos(getContext(c), pending)
+	feed.AddDownloads(c.String("outputFolder"), pending, err)
+	return err
+}
+
+// processFiles runs the steps that work on the downloaded files and writes the files that go with them.
+// A dry run only points the images at the ones already downloaded.
+func (processors *feedProcessors) processFiles(c *cli.Context, info *ChannelInfo, items []*VideoData) error {
+	err := processors.localizeImages(c, info, items)
+	if err != nil || c.Bool("dryRun") {
+		return err
+	}
+
+	err = processors.processAudio(c, items)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("chapters") {
+		err = WriteChapterFiles(items, c.String("outputFolder"))
 		if err != nil {
 			return err
 		}
 	}
 
-	if c.Bool("cleanupUnrelatedFiles") {
-		relatedFiles := getRelatedFiles(items, c.String("xmlFile"), c.String("outputFolder"))
-		return NewDirectoryCleaner(c.String("outputFolder")).CleanupUnrelatedFiles(relatedFiles, c.App.ErrWriter)
+	return processors.renderVariant(c, items)
+}
+
+func (processors *feedProcessors) localizeImages(c *cli.Context, info *ChannelInfo, items []*VideoData) error {
+	if processors.localizer == nil || c.String("xmlFile") == "" {
+		return nil
+	}
+
+	if c.Bool("dryRun") {
+		processors.localizer.LocalizeExisting(info, items)
+		return nil
+	}
+
+	return processors.localizer.Localize(getContext(c), info, items)
+}
+
+// processAudio runs the audio processor and converts the transcripts
+func (processors *feedProcessors) processAudio(c *cli.Context, items []*VideoData) error {
+	if processors.audioProcessor != nil {
+		err := processors.audioProcessor.ProcessFiles(getContext(c), items)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.String("transcripts") == "" {
+		return nil
+	}
+
+	return processors.convertTranscripts(c, items)
+}
+
+func (processors *feedProcessors) renderVariant(c *cli.Context, items []*VideoData) error {
+	if processors.variant == nil {
+		return nil
+	}
+
+	err := processors.variant.RenderFiles(getContext(c), items)
+	if err != nil || !c.Bool("chapters") {
+		return err
+	}
+
+	return WriteChapterFiles(processors.variant.Items(items), processors.variant.OutputFolder())
+}
+
+func (processors *feedProcessors) convertTranscripts(c *cli.Context, items []*VideoData) error {
+	var removedSegments map[string][]Segment
+	if processors.segmentRemover != nil {
+		var err error
+		removedSegments, err = processors.segmentRemover.RemovedSegments()
+		if err != nil {
+			return err
+		}
+	}
+
+	return ConvertTranscripts(items, c.String("outputFolder"), c.String("transcripts"), removedSegments)
+}
+
+// writeFeeds builds the feed and the speed variant feed when there is an xmlFile
+func writeFeeds(
+	c *cli.Context,
+	cmdBuilder runner.Builder,
+	logger *slog.Logger,
+	processors *feedProcessors,
+	feed *FeedReport,
+	info *ChannelInfo,
+	items []*VideoData,
+) error {
+	if c.String("xmlFile") == "" {
+		return nil
+	}
+
+	var err error
+	feed.FeedChanged, err = buildFeed(c, cmdBuilder, logger, c.String("xmlFile"), c.String("outputFolder"), c.String("baseURL"), info, items)
+	if err != nil || processors.variant == nil {
+		return err
+	}
+
+	_, err = buildVariantFeed(c, cmdBuilder, logger, processors.variant, info, items)
+	return err
+}
+
+// cleanupFeedFolders removes the files that aren't part of the feed from the output folder and the speed variant folder
+func cleanupFeedFolders(
+	c *cli.Context,
+	logger *slog.Logger,
+	lock *FeedLock,
+	processors *feedProcessors,
+	feed *FeedReport,
+	info *ChannelInfo,
+	items []*VideoData,
+) error {
+	relatedFiles := getRelatedFiles(items, c.String("xmlFile"), c.String("outputFolder"))
+	relatedFiles = append(relatedFiles, getAbsolutePaths(lock.FileName())...)
+	for _, flagName := range []string{"seenFile", "report", "metricsFile"} {
+		if c.String(flagName) != "" {
+			relatedFiles = append(relatedFiles, getAbsolutePaths(c.String(flagName))...)
+		}
+	}
+
+	relatedFiles = append(relatedFiles, processors.relatedFiles(info, items)...)
+	if processors.variant != nil {
+		relatedFiles = append(relatedFiles, getAbsolutePaths(processors.variant.XMLFile(c.String("xmlFile")))...)
+		variantFiles := getRelatedFiles(items, processors.variant.XMLFile(c.String("xmlFile")), processors.variant.OutputFolder())
+		err := cleanupUnrelatedFiles(c, logger, processors.variant.OutputFolder(), variantFiles, feed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cleanupUnrelatedFiles(c, logger, c.String("outputFolder"), relatedFiles, feed)
+}
+
+// relatedFiles returns the state files and images the processors keep in the output folder
+func (processors *feedProcessors) relatedFiles(info *ChannelInfo, items []*VideoData) []string {
+	relatedFiles := make([]string, 0)
+	if processors.audioProcessor != nil {
+		relatedFiles = append(relatedFiles, getAbsolutePaths(processors.audioProcessor.StateFile())...)
+	}
+
+	if processors.segmentRemover != nil {
+		relatedFiles = append(relatedFiles, getAbsolutePaths(processors.segmentRemover.StateFile())...)
+	}
+
+	if processors.localizer != nil {
+		relatedFiles = append(relatedFiles, processors.localizer.LocalFiles(info, items)...)
+	}
+
+	return relatedFiles
+}
+
+// buildFeed writes the feed, or only checks whether it would change on a dry run, and reports whether it changed
+func buildFeed(
+	c *cli.Context,
+	cmdBuilder runner.Builder,
+	logger *slog.Logger,
+	xmlFile, outputFolder, baseURL string,
+	info *ChannelInfo,
+	items []*VideoData,
+) (bool, error) {
+	xmlBuilder := NewXMLBuilder(cmdBuilder, xmlFile, outputFolder, baseURL, getGenerator(), info)
+	xmlBuilder.SetLogger(logger)
+	if c.Bool("dryRun") {
+		changed, err := xmlBuilder.WouldChange(getContext(c), items)
+		if err != nil {
+			return false, err
+		}
+
+		if changed {
+			fmt.Fprintf(c.App.Writer, "Feed would change: %s\n", xmlFile)
+		} else {
+			fmt.Fprintf(c.App.Writer, "Feed unchanged: %s\n", xmlFile)
+		}
+
+		return changed, nil
+	}
+
+	changed, err := xmlBuilder.BuildRss(getContext(c), items)
+	if err != nil {
+		return false, err
+	}
+
+	DefaultMetrics.Add(MetricFeedRebuilds, 1, "changed", strconv.FormatBool(changed))
+
+	if !changed {
+		fmt.Fprintf(c.App.Writer, "Feed unchanged: %s\n", xmlFile)
+	}
+
+	return changed, nil
+}
+
+// cleanupUnrelatedFiles removes the files in outputFolder that aren't in relatedFiles or only lists them on a dry run
+func cleanupUnrelatedFiles(c *cli.Context, logger *slog.Logger, outputFolder string, relatedFiles []string, feed *FeedReport) error {
+	cleaner := NewDirectoryCleaner(outputFolder)
+	cleaner.SetLogger(logger)
+	unrelatedFiles := cleaner.UnrelatedFiles(relatedFiles)
+	feed.RemovedFiles = append(feed.RemovedFiles, unrelatedFiles...)
+	if !c.Bool("dryRun") {
+		writer := c.App.ErrWriter
+		if c.Bool("quiet") {
+			writer = ioutil.Discard
+		}
+
+		return cleaner.CleanupUnrelatedFiles(relatedFiles, writer)
+	}
+
+	for _, unrelatedFile := range unrelatedFiles {
+		fmt.Fprintf(c.App.Writer, "Would remove file: %s\n", unrelatedFile)
 	}
 
 	return nil
 }
 
+// printDownloadPlan lists which items a run would download and which are already downloaded
+func printDownloadPlan(writer io.Writer, pending, existing []*VideoData) {
+	for _, item := range pending {
+		fmt.Fprintf(writer, "Would download: %s (%s)\n", item.FileName, item.Link)
+	}
+
+	for _, item := range existing {
+		fmt.Fprintf(writer, "Already downloaded: %s\n", item.FileName)
+	}
+}
+
+// buildVariantFeed builds a second feed whose enclosures point at the sped up copies
+func buildVariantFeed(
+	c *cli.Context,
+	cmdBuilder runner.Builder,
+	logger *slog.Logger,
+	variant *SpeedVariant,
+	info *ChannelInfo,
+	items []*VideoData,
+) (bool, error) {
+	baseURL := c.String("speedBaseURL")
+	if baseURL == "" {
+		var err error
+		baseURL, err = variant.BaseURL(c.String("baseURL"))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return buildFeed(c, cmdBuilder, logger, variant.XMLFile(c.String("xmlFile")), variant.OutputFolder(), baseURL, variant.Info(info), variant.Items(items))
+}
+
 // ContainsString searches a string slice to see if it contains a given string
 func ContainsString(needle string, haystack []string) bool {
 	for _, item := range haystack {
@@ -97,3 +706,46 @@ func ContainsString(needle string, haystack []string) bool {
 func getFileName(outputFolder string, item *VideoData) string {
 	return fmt.Sprintf("%s/%s.mp3", outputFolder, item.FileName)
 }
+
+func getRetryPolicy(c *cli.Context) *RetryPolicy {
+	if c.Int("retries") <= 0 {
+		return nil
+	}
+
+	return NewRetryPolicy(c.Int("retries"), c.Duration("retryDelay"))
+}
+
+// SetContext sets the context commands run with so they can be interrupted
+func SetContext(app *cli.App, ctx context.Context) {
+	if app.Metadata == nil {
+		app.Metadata = make(map[string]interface{})
+	}
+
+	app.Metadata[contextMetadataKey] = ctx
+}
+
+func getContext(c *cli.Context) context.Context {
+	ctx, ok := c.App.Metadata[contextMetadataKey].(context.Context)
+	if !ok {
+		return context.Background()
+	}
+
+	return ctx
+}
+
+// missingItems returns the items in all that aren't in kept
+func missingItems(all, kept []*VideoData) []*VideoData {
+	keptItems := make(map[*VideoData]bool, len(kept))
+	for _, item := range kept {
+		keptItems[item] = true
+	}
+
+	missing := make([]*VideoData, 0, len(all)-len(kept))
+	for _, item := range all {
+		if !keptItems[item] {
+			missing = append(missing, item)
+		}
+	}
+
+	return missing
+}
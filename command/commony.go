@@ -1,11 +1,15 @@
 package command
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"google.golang.org/api/googleapi/transport"
 	youtube "google.golang.org/api/youtube/v3"
+
+	"github.com/kennygrant/sanitize"
 )
 
 // YoutubeAPIURLBase is the base url to use for the youtube API.  This should only be changed for tests.
@@ -16,18 +20,64 @@ type VideoData struct {
 	GUID        string
 	Link        string
 	Title       string
+	Author      string
 	Description string
 	FileName    string
 	Image       string
 	PubDate     time.Time
+	Season      int
+	Episode     int
+	Duration    string
+	Chapters    []Chapter
+	ShowNotes   string
+}
+
+// TransportWrapper adds behavior like caching or quota accounting to the YouTube API client
+type TransportWrapper interface {
+	Transport(base http.RoundTripper) http.RoundTripper
 }
 
-func getYoutubeService(apiKey string) *youtube.Service {
+// getYoutubeService builds the API client.  Each wrapper wraps the transport built so far so the last one sees requests first.
+func getYoutubeService(apiKey string, wrappers ...TransportWrapper) *youtube.Service {
 	client := &http.Client{
 		Transport: &transport.APIKey{Key: apiKey},
 	}
+	for _, wrapper := range wrappers {
+		client.Transport = wrapper.Transport(client.Transport)
+	}
+
 	service, _ := youtube.New(client)
 	// Only for testing
 	service.BasePath = YoutubeAPIURLBase
 	return service
 }
+
+func newVideoData(videoID, title, author, description string, publishedTime time.Time, thumbnails *youtube.ThumbnailDetails) *VideoData {
+	item := &VideoData{
+		GUID:        videoID,
+		Link:        fmt.Sprintf("https://youtu.be/%s", videoID),
+		Title:       title,
+		Author:      author,
+		Description: fmt.Sprintf("%s https://youtu.be/%s", description, videoID),
+		FileName:    fmt.Sprintf("%s-%s", strings.Replace(sanitize.BaseName(title), " ", "-", -1), videoID),
+		PubDate:     publishedTime,
+		Image:       bestThumbnail(thumbnails),
+	}
+
+	return item
+}
+
+// bestThumbnail returns the URL of the highest resolution thumbnail available
+func bestThumbnail(thumbnails *youtube.ThumbnailDetails) string {
+	if thumbnails == nil {
+		return ""
+	}
+
+	for _, thumbnail := range []*youtube.Thumbnail{thumbnails.Maxres, thumbnails.Standard, thumbnails.High, thumbnails.Medium, thumbnails.Default} {
+		if thumbnail != nil && thumbnail.Url != "" {
+			return thumbnail.Url
+		}
+	}
+
+	return ""
+}
@@ -11,12 +11,38 @@ import (
 // Completion handles bash completion for the commands
 func Completion(c *cli.Context) {
 	lastParam := os.Args[len(os.Args)-2]
-	noCompletionFlags := []string{"--apiKey", "--filter", "--baseURL", "--after"}
+	noCompletionFlags := []string{
+		"--apiKey",
+		"--filter",
+		"--baseURL",
+		"--after",
+		"--days",
+		"--order",
+		"--limit",
+		"--overrideDescription",
+		"--overrideImage",
+		"--bitrate",
+		"--transcripts",
+		"--sponsorBlock",
+		"--sponsorBlockURL",
+		"--squareImages",
+		"--speed",
+		"--speedBaseURL",
+		"--quotaBudget",
+		"--cacheTTL",
+		"--retries",
+		"--retryDelay",
+		"--wait",
+		"--output",
+		"--logFormat",
+		"--concurrency",
+		"--healthAddress",
+	}
 	if ContainsString(lastParam, noCompletionFlags) {
 		return
 	}
 
-	fileCompletionFlags := []string{"--outputFolder", "--xmlFile"}
+	fileCompletionFlags := []string{"--outputFolder", "--xmlFile", "--seenFile", "--quotaFile", "--cacheFolder", "--report", "--metricsFile", "--config"}
 	if ContainsString(lastParam, fileCompletionFlags) {
 		fmt.Fprintln(c.App.Writer, "fileCompletion")
 		return
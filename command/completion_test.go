@@ -16,7 +16,15 @@ func TestCompleteChannel(t *testing.T) {
 	app.Commands = command.Commands
 	os.Args = []string{os.Args[0], "channel", "--completion"}
 	command.Completion(cli.NewContext(app, set, nil))
-	assert.Equal(t, "--apiKey\n--filter\n--outputFolder\n--xmlFile\n--baseURL\n--cleanupUnrelatedFiles\n--overrideTitle\n--quality\n--after\n", writer.String())
+	assert.Equal(
+		t,
+		"--apiKey\n--filter\n--outputFolder\n--xmlFile\n--baseURL\n--cleanupUnrelatedFiles\n"+
+			"--overrideTitle\n--overrideDescription\n--overrideImage\n--serial\n--incremental\n--tag\n"+
+			"--normalize\n--mono\n--trimSilence\n--bitrate\n--chapters\n--embedChapters\n--showNotes\n--transcripts\n--sponsorBlock\n--sponsorBlockURL\n"+
+			"--localImages\n--squareImages\n--speed\n--speedBaseURL\n--quotaFile\n--quotaBudget\n--cacheFolder\n--cacheTTL\n"+
+			"--dryRun\n--report\n--metricsFile\n--verbose\n--quiet\n--logFormat\n--output\n--noWait\n--wait\n--retries\n--retryDelay\n--quality\n--after\n",
+		writer.String(),
+	)
 }
 
 func TestCompleteChannelApiKey(t *testing.T) {
@@ -64,5 +72,14 @@ func TestRootCompletion(t *testing.T) {
 	app, writer, _ := appWithTestWriters()
 	app.Commands = append(command.Commands, cli.Command{Hidden: true, Name: "don't show"})
 	command.RootCompletion(cli.NewContext(app, set, nil))
-	assert.Equal(t, "channel:Builds your rss file from a youtube channel\nplaylist:Builds your rss file from a youtube playlist\n", writer.String())
+	assert.Equal(
+		t,
+		"channel:Builds your rss file from a youtube channel\n"+
+			"playlist:Builds your rss file from a youtube playlist\n"+
+			"search:Builds your rss file from a youtube search\n"+
+			"merge:Builds one rss file from several youtube channels, playlists or searches\n"+
+			"list:Builds your rss file from a file listing youtube videos\n"+
+			"daemon:Builds the feeds in a config file on their own schedules until stopped\n",
+		writer.String(),
+	)
 }
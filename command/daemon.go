@@ -0,0 +1,557 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/guywithnose/runner"
+	"github.com/urfave/cli"
+)
+
+// daemonCommands are the commands a feed in the daemon config can use
+var daemonCommands = map[string]func(runner.Builder) func(*cli.Context) error{
+	"channel":  CmdChannel,
+	"playlist": CmdPlaylist,
+	"search":   CmdSearch,
+	"merge":    CmdMerge,
+	"list":     CmdList,
+}
+
+// daemonLoggingFlags are passed on from the daemon to each feed unless the feed sets them itself
+var daemonLoggingFlags = []string{"verbose", "quiet", "logFormat"}
+
+// DaemonConfig lists the feeds the daemon builds
+type DaemonConfig struct {
+	Concurrency int          `json:"concurrency,omitempty"`
+	Feeds       []FeedConfig `json:"feeds"`
+}
+
+// FeedConfig is a feed the daemon builds by running Command with Args, like it would be run from cron.
+// It runs every Interval or when the cron expression in Schedule matches, delayed by up to Jitter.
+type FeedConfig struct {
+	Name     string   `json:"name"`
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	Interval string   `json:"interval,omitempty"`
+	Schedule string   `json:"schedule,omitempty"`
+	Jitter   string   `json:"jitter,omitempty"`
+}
+
+// HealthStatus describes the daemon and each of its feeds
+type HealthStatus struct {
+	Healthy      bool          `json:"healthy"`
+	Started      time.Time     `json:"started"`
+	ConfigLoaded time.Time     `json:"configLoaded"`
+	ConfigError  string        `json:"configError,omitempty"`
+	Feeds        []*FeedStatus `json:"feeds"`
+}
+
+// FeedStatus describes the runs of a feed
+type FeedStatus struct {
+	Name                string    `json:"name"`
+	Running             bool      `json:"running"`
+	NextRun             time.Time `json:"nextRun"`
+	LastStarted         time.Time `json:"lastStarted"`
+	LastDuration        float64   `json:"lastDurationSeconds"`
+	LastError           string    `json:"lastError,omitempty"`
+	Runs                int       `json:"runs"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+// Daemon builds the feeds in a config file on their schedules
+type Daemon struct {
+	app         *cli.App
+	cmdBuilder  runner.Builder
+	configFile  string
+	concurrency int
+	defaults    map[string]string
+	logger      *slog.Logger
+	started     time.Time
+	wake        chan struct{}
+	running     sync.WaitGroup
+	limiter     *runLimiter
+
+	mutex        sync.Mutex
+	feeds        []*daemonFeed
+	configLoaded time.Time
+	configError  string
+}
+
+type daemonFeed struct {
+	config   FeedConfig
+	schedule Schedule
+	jitter   time.Duration
+	status   FeedStatus
+}
+
+type syncWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewDaemon returns a Daemon for the feeds in configFile.
+// The feeds are run as commands of app and concurrency, when above 0, overrides the concurrency in the config.
+func NewDaemon(app *cli.App, cmdBuilder runner.Builder, configFile string, concurrency int, logger *slog.Logger) *Daemon {
+	// Feeds running at the same time share the writers
+	feedApp := *app
+	feedApp.Writer = &syncWriter{writer: app.Writer}
+	feedApp.ErrWriter = &syncWriter{writer: app.ErrWriter}
+	return &Daemon{
+		app:         &feedApp,
+		cmdBuilder:  cmdBuilder,
+		configFile:  configFile,
+		concurrency: concurrency,
+		defaults:    make(map[string]string),
+		logger:      logger,
+		started:     time.Now(),
+		wake:        make(chan struct{}, 1),
+		limiter:     newRunLimiter(1),
+	}
+}
+
+// CmdDaemon builds the feeds in a config file on their schedules until it is stopped
+func CmdDaemon(cmdBuilder runner.Builder) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.String("config") == "" {
+			return cli.NewExitError("You must specify a config file", 1)
+		}
+
+		logger, err := getLogger(c)
+		if err != nil {
+			return err
+		}
+
+		daemon := NewDaemon(c.App, cmdBuilder, c.String("config"), c.Int("concurrency"), logger)
+		for _, name := range daemonLoggingFlags {
+			if c.IsSet(name) {
+				daemon.defaults[name] = c.String(name)
+			}
+		}
+
+		err = daemon.Load()
+		if err != nil {
+			return err
+		}
+
+		ctx := getContext(c)
+		if c.String("healthAddress") != "" {
+			stop, err := daemon.serveHealth(c.String("healthAddress"))
+			if err != nil {
+				return err
+			}
+
+			defer stop()
+		}
+
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		defer func() {
+			signal.Stop(reload)
+			close(reload)
+		}()
+		go func() {
+			for range reload {
+				logger.Info("Reloading config", "file", daemon.configFile)
+				_ = daemon.Load()
+			}
+		}()
+
+		return daemon.Run(ctx)
+	}
+}
+
+// ReadDaemonConfig reads and checks the daemon config in configFile
+func ReadDaemonConfig(configFile string) (*DaemonConfig, error) {
+	configBytes, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %v", err)
+	}
+
+	config := &DaemonConfig{}
+	err = json.Unmarshal(configBytes, config)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config %s: %v", configFile, err)
+	}
+
+	if config.Concurrency < 0 {
+		return nil, fmt.Errorf("invalid concurrency %d: must be at least 1", config.Concurrency)
+	}
+
+	names := make(map[string]bool, len(config.Feeds))
+	for _, feed := range config.Feeds {
+		if feed.Name == "" {
+			return nil, errors.New("every feed needs a name")
+		}
+
+		if names[feed.Name] {
+			return nil, fmt.Errorf("there is more than one feed named %s", feed.Name)
+		}
+
+		names[feed.Name] = true
+		if _, ok := daemonCommands[feed.Command]; !ok {
+			return nil, fmt.Errorf("invalid command %s for feed %s: must be channel, playlist, search, merge or list", feed.Command, feed.Name)
+		}
+
+		_, _, err = parseFeedSchedule(feed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func parseFeedSchedule(feed FeedConfig) (Schedule, time.Duration, error) {
+	jitter, err := parseFeedJitter(feed)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case feed.Interval != "" && feed.Schedule != "":
+		return nil, 0, fmt.Errorf("feed %s has both an interval and a schedule", feed.Name)
+	case feed.Interval != "":
+		interval, err := time.ParseDuration(feed.Interval)
+		if err != nil || interval <= 0 {
+			return nil, 0, fmt.Errorf("invalid interval %s for feed %s", feed.Interval, feed.Name)
+		}
+
+		return IntervalSchedule{Interval: interval}, jitter, nil
+	case feed.Schedule != "":
+		schedule, err := ParseCronSchedule(feed.Schedule)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid schedule for feed %s: %v", feed.Name, err)
+		}
+
+		return schedule, jitter, nil
+	default:
+		return nil, 0, fmt.Errorf("feed %s needs an interval or a schedule", feed.Name)
+	}
+}
+
+func parseFeedJitter(feed FeedConfig) (time.Duration, error) {
+	if feed.Jitter == "" {
+		return 0, nil
+	}
+
+	jitter, err := time.ParseDuration(feed.Jitter)
+	if err != nil || jitter < 0 {
+		return 0, fmt.Errorf("invalid jitter %s for feed %s", feed.Jitter, feed.Name)
+	}
+
+	return jitter, nil
+}
+
+// Load reads the config file and replaces the feeds with the ones in it.
+// A feed that is still in the config keeps its status and, unless its schedule changed, its next run.
+// When the config can't be loaded the current feeds are kept and the error shows in the health status.
+func (daemon *Daemon) Load() error {
+	err := daemon.load()
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	if err != nil {
+		daemon.configError = err.Error()
+		daemon.logger.Error("Could not load config", "file", daemon.configFile, "error", err)
+		return err
+	}
+
+	daemon.configError = ""
+	daemon.configLoaded = time.Now()
+	daemon.signal()
+	return nil
+}
+
+func (daemon *Daemon) load() error {
+	config, err := ReadDaemonConfig(daemon.configFile)
+	if err != nil {
+		return err
+	}
+
+	feeds := make([]*daemonFeed, 0, len(config.Feeds))
+	for _, feedConfig := range config.Feeds {
+		// Bad flags are caught now instead of on the first run
+		_, err = daemon.flagSet(feedConfig)
+		if err != nil {
+			return err
+		}
+
+		schedule, jitter, _ := parseFeedSchedule(feedConfig)
+		feeds = append(feeds, &daemonFeed{config: feedConfig, schedule: schedule, jitter: jitter, status: FeedStatus{Name: feedConfig.Name}})
+	}
+
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	daemon.feeds = daemon.keepExistingFeeds(feeds, time.Now())
+	daemon.limiter.resize(daemon.concurrencyFor(config))
+	return nil
+}
+
+// concurrencyFor returns the number of feeds that may run at once, preferring the --concurrency flag over the config
+func (daemon *Daemon) concurrencyFor(config *DaemonConfig) int {
+	if daemon.concurrency > 0 {
+		return daemon.concurrency
+	}
+
+	if config.Concurrency == 0 {
+		return 1
+	}
+
+	return config.Concurrency
+}
+
+// keepExistingFeeds swaps in the current feed for each one that is still configured so it keeps its status.
+// New feeds and feeds whose schedule changed get their next run from now.  The mutex must be held.
+func (daemon *Daemon) keepExistingFeeds(feeds []*daemonFeed, now time.Time) []*daemonFeed {
+	existing := make(map[string]*daemonFeed, len(daemon.feeds))
+	for _, feed := range daemon.feeds {
+		existing[feed.config.Name] = feed
+	}
+
+	for i, feed := range feeds {
+		old, ok := existing[feed.config.Name]
+		if !ok {
+			feed.status.NextRun = feed.firstRun(now)
+			continue
+		}
+
+		scheduleChanged := old.config.Interval != feed.config.Interval || old.config.Schedule != feed.config.Schedule || old.jitter != feed.jitter
+		old.config, old.schedule, old.jitter = feed.config, feed.schedule, feed.jitter
+		if scheduleChanged {
+			old.status.NextRun = old.next(now)
+		}
+
+		feeds[i] = old
+	}
+
+	return feeds
+}
+
+// firstRun starts feeds on an interval right away so a restart doesn't put them off for a whole interval
+func (feed *daemonFeed) firstRun(now time.Time) time.Time {
+	if _, ok := feed.schedule.(IntervalSchedule); ok {
+		return now.Add(feed.randomJitter())
+	}
+
+	return feed.next(now)
+}
+
+func (feed *daemonFeed) next(now time.Time) time.Time {
+	return feed.schedule.Next(now).Add(feed.randomJitter())
+}
+
+// randomJitter spreads out feeds on the same schedule so they don't all hit the API at once
+func (feed *daemonFeed) randomJitter() time.Duration {
+	if feed.jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(feed.jitter)))
+}
+
+// Run builds each feed when it is due until ctx is done and then waits for the runs in progress to stop
+func (daemon *Daemon) Run(ctx context.Context) error {
+	daemon.logger.Info("Daemon started", "config", daemon.configFile)
+	for {
+		wait := daemon.startDueFeeds(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			daemon.logger.Info("Daemon stopping, waiting for running feeds")
+			daemon.running.Wait()
+			return nil
+		case <-daemon.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// startDueFeeds starts the feeds that are due and returns how long until the next one is
+func (daemon *Daemon) startDueFeeds(ctx context.Context) time.Duration {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	now := time.Now()
+	wait := time.Hour
+	for _, feed := range daemon.feeds {
+		if !feed.status.NextRun.After(now) {
+			if feed.status.Running {
+				daemon.logger.Warn("Feed is still running, skipping this run", "feed", feed.config.Name)
+			} else {
+				feed.status.Running = true
+				daemon.running.Add(1)
+				go daemon.runFeed(ctx, feed, feed.config)
+			}
+
+			feed.status.NextRun = feed.next(now)
+		}
+
+		if until := feed.status.NextRun.Sub(now); until < wait {
+			wait = until
+		}
+	}
+
+	return wait
+}
+
+func (daemon *Daemon) runFeed(ctx context.Context, feed *daemonFeed, config FeedConfig) {
+	defer daemon.running.Done()
+	if daemon.limiter.acquire(ctx) {
+		defer daemon.limiter.release()
+	}
+
+	if ctx.Err() != nil {
+		daemon.mutex.Lock()
+		feed.status.Running = false
+		daemon.mutex.Unlock()
+		return
+	}
+
+	logger := daemon.logger.With("feed", config.Name)
+	logger.Info("Building feed")
+	started := time.Now()
+	daemon.mutex.Lock()
+	feed.status.LastStarted = started
+	daemon.mutex.Unlock()
+
+	err := daemon.buildFeed(ctx, config)
+
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	feed.status.Running = false
+	feed.status.Runs++
+	feed.status.LastDuration = time.Since(started).Seconds()
+	feed.status.LastError = ""
+	feed.status.ConsecutiveFailures = 0
+	if err != nil {
+		feed.status.LastError = err.Error()
+		feed.status.ConsecutiveFailures++
+		logger.Error("Feed failed", "error", err, "consecutiveFailures", feed.status.ConsecutiveFailures)
+		return
+	}
+
+	logger.Info("Feed built", "duration", time.Since(started))
+}
+
+// buildFeed runs the feed's command the same way the command line would
+func (daemon *Daemon) buildFeed(ctx context.Context, config FeedConfig) error {
+	set, err := daemon.flagSet(config)
+	if err != nil {
+		return err
+	}
+
+	// Each run gets its own app so that commands swapping writers or setting the context don't affect the others
+	app := *daemon.app
+	app.Metadata = make(map[string]interface{})
+	SetContext(&app, ctx)
+	return daemonCommands[config.Command](daemon.cmdBuilder)(cli.NewContext(&app, set, nil))
+}
+
+// flagSet parses the feed's args with the flags of its command and the daemon's logging flags as defaults
+func (daemon *Daemon) flagSet(config FeedConfig) (*flag.FlagSet, error) {
+	command := daemon.app.Command(config.Command)
+	if command == nil {
+		return nil, fmt.Errorf("invalid command %s for feed %s", config.Command, config.Name)
+	}
+
+	set := flag.NewFlagSet(config.Name, flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	for _, commandFlag := range command.Flags {
+		commandFlag.Apply(set)
+	}
+
+	for name, value := range daemon.defaults {
+		_ = set.Set(name, value)
+	}
+
+	err := set.Parse(config.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid args for feed %s: %v", config.Name, err)
+	}
+
+	return set, nil
+}
+
+// Health returns the status of the daemon and its feeds.
+// The daemon is healthy when the config loaded and the last run of every feed succeeded.
+func (daemon *Daemon) Health() *HealthStatus {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	health := &HealthStatus{
+		Healthy:      daemon.configError == "",
+		Started:      daemon.started,
+		ConfigLoaded: daemon.configLoaded,
+		ConfigError:  daemon.configError,
+		Feeds:        make([]*FeedStatus, 0, len(daemon.feeds)),
+	}
+	for _, feed := range daemon.feeds {
+		status := feed.status
+		health.Feeds = append(health.Feeds, &status)
+		if status.ConsecutiveFailures > 0 {
+			health.Healthy = false
+		}
+	}
+
+	return health
+}
+
+// ServeHTTP serves the health status as JSON with a 503 status when the daemon isn't healthy
+func (daemon *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	health := daemon.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(health)
+}
+
+// serveHealth serves the health status on /health and the metrics on /metrics until stop is called
+func (daemon *Daemon) serveHealth(address string) (func(), error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("could not serve health status: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", daemon)
+	mux.Handle("/metrics", DefaultMetrics)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	daemon.logger.Info("Serving health status", "address", listener.Addr().String())
+	return func() {
+		_ = server.Close()
+	}, nil
+}
+
+// signal wakes Run so it picks up changes to the feeds
+func (daemon *Daemon) signal() {
+	select {
+	case daemon.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Write writes to the underlying writer one caller at a time
+func (writer *syncWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.writer.Write(p)
+}
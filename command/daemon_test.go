@@ -0,0 +1,242 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestReadDaemonConfigErrors(t *testing.T) {
+	configFile := getDaemonConfigFile()
+	defer removeFile(t, configFile)
+	tests := map[string]string{
+		`{"feeds": [`:                                               fmt.Sprintf("could not parse config %s: unexpected end of JSON input", configFile),
+		`{"concurrency": -1}`:                                       "invalid concurrency -1: must be at least 1",
+		`{"feeds": [{"command": "channel"}]}`:                       "every feed needs a name",
+		`{"feeds": [{"name": "a", "command": "daemon"}]}`:           "invalid command daemon for feed a: must be channel, playlist, search, merge or list",
+		`{"feeds": [{"name": "a", "command": "channel"}]}`:          "feed a needs an interval or a schedule",
+		getFeedConfigJSON(`"interval": "1h", "schedule": "@daily"`): "feed a has both an interval and a schedule",
+		getFeedConfigJSON(`"interval": "often"`):                    "invalid interval often for feed a",
+		getFeedConfigJSON(`"interval": "-1h"`):                      "invalid interval -1h for feed a",
+		getFeedConfigJSON(`"interval": "1h", "jitter": "some"`):     "invalid jitter some for feed a",
+		getFeedConfigJSON(`"schedule": "@often"`):                   "invalid schedule for feed a: invalid cron expression @often: expected 5 fields",
+	}
+	for config, expected := range tests {
+		require.Nil(t, ioutil.WriteFile(configFile, []byte(config), 0644))
+		_, err := command.ReadDaemonConfig(configFile)
+		assert.EqualError(t, err, expected, config)
+	}
+
+	writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{getDaemonFeed("a", "/tmp/a"), getDaemonFeed("a", "/tmp/b")}})
+	_, err := command.ReadDaemonConfig(configFile)
+	assert.EqualError(t, err, "there is more than one feed named a")
+
+	_, err = command.ReadDaemonConfig("/notafile")
+	assert.EqualError(t, err, "could not read config: open /notafile: no such file or directory")
+}
+
+func TestDaemonRun(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	configFile := writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{getDaemonFeed("awesome", outputFolder)}})
+	defer removeFile(t, configFile)
+	app, _, _ := appWithTestWriters()
+	app.Commands = command.Commands
+	cb := getFfprobeRunner()
+	daemon := command.NewDaemon(app, cb, configFile, 0, slog.New(slog.DiscardHandler))
+	require.Nil(t, daemon.Load())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- daemon.Run(ctx)
+	}()
+
+	status := waitForRuns(t, daemon, 1)
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	_, err := os.Stat(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	assert.Equal(t, "", status.LastError)
+	assert.False(t, status.Running)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), status.NextRun, time.Minute)
+	assert.True(t, daemon.Health().Healthy)
+}
+
+func TestDaemonFeedFails(t *testing.T) {
+	feed := getDaemonFeed("broken", "")
+	feed.Args = []string{"awesome"}
+	configFile := writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{feed}})
+	defer removeFile(t, configFile)
+	app, _, _ := appWithTestWriters()
+	app.Commands = command.Commands
+	daemon := command.NewDaemon(app, &runner.Test{}, configFile, 0, slog.New(slog.DiscardHandler))
+	require.Nil(t, daemon.Load())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- daemon.Run(ctx)
+	}()
+
+	status := waitForRuns(t, daemon, 1)
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, "You must specify an outputFolder", status.LastError)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+
+	recorder := httptest.NewRecorder()
+	daemon.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	health := &command.HealthStatus{}
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(health))
+	assert.False(t, health.Healthy)
+	require.Equal(t, 1, len(health.Feeds))
+	assert.Equal(t, "broken", health.Feeds[0].Name)
+}
+
+func TestDaemonReload(t *testing.T) {
+	first := getDaemonFeed("first", "/tmp/first")
+	configFile := writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{first}})
+	defer removeFile(t, configFile)
+	app, _, _ := appWithTestWriters()
+	app.Commands = command.Commands
+	daemon := command.NewDaemon(app, &runner.Test{}, configFile, 0, slog.New(slog.DiscardHandler))
+	require.Nil(t, daemon.Load())
+	nextRun := daemon.Health().Feeds[0].NextRun
+
+	second := getDaemonFeed("second", "/tmp/second")
+	second.Interval = ""
+	second.Schedule = "@daily"
+	writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{first, second}})
+	require.Nil(t, daemon.Load())
+	health := daemon.Health()
+	require.Equal(t, 2, len(health.Feeds))
+	assert.Equal(t, nextRun, health.Feeds[0].NextRun)
+	assert.Equal(t, "second", health.Feeds[1].Name)
+	assert.True(t, health.Feeds[1].NextRun.After(time.Now()))
+
+	// A broken config keeps the feeds from the last good one
+	require.Nil(t, ioutil.WriteFile(configFile, []byte("{"), 0644))
+	assert.NotNil(t, daemon.Load())
+	health = daemon.Health()
+	assert.Equal(t, 2, len(health.Feeds))
+	assert.False(t, health.Healthy)
+	assert.Equal(t, fmt.Sprintf("could not parse config %s: unexpected end of JSON input", configFile), health.ConfigError)
+
+	writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{second}})
+	require.Nil(t, daemon.Load())
+	health = daemon.Health()
+	assert.True(t, health.Healthy)
+	require.Equal(t, 1, len(health.Feeds))
+	assert.Equal(t, "second", health.Feeds[0].Name)
+}
+
+func TestDaemonLoadInvalidArgs(t *testing.T) {
+	feed := getDaemonFeed("bad", "/tmp/bad")
+	feed.Args = append([]string{"--notAFlag"}, feed.Args...)
+	configFile := writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{feed}})
+	defer removeFile(t, configFile)
+	app, _, _ := appWithTestWriters()
+	app.Commands = command.Commands
+	daemon := command.NewDaemon(app, &runner.Test{}, configFile, 0, slog.New(slog.DiscardHandler))
+	assert.EqualError(t, daemon.Load(), "invalid args for feed bad: flag provided but not defined: -notAFlag")
+}
+
+func TestCmdDaemon(t *testing.T) {
+	feed := getDaemonFeed("yearly", "/tmp/yearly")
+	feed.Interval = ""
+	feed.Schedule = "@yearly"
+	configFile := writeDaemonConfig(t, command.DaemonConfig{Feeds: []command.FeedConfig{feed}})
+	defer removeFile(t, configFile)
+	app, _, errWriter := appWithTestWriters()
+	app.Commands = command.Commands
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	command.SetContext(app, ctx)
+	set := flag.NewFlagSet("test", 0)
+	set.String("config", configFile, "doc")
+	set.Bool("verbose", true, "doc")
+	assert.Nil(t, command.CmdDaemon(&runner.Test{})(cli.NewContext(app, set, nil)))
+	assert.Contains(t, errWriter.String(), fmt.Sprintf("level=INFO msg=\"Daemon started\" config=%s\n", configFile))
+}
+
+func TestCmdDaemonNoConfig(t *testing.T) {
+	app, _, _ := appWithTestWriters()
+	err := command.CmdDaemon(&runner.Test{})(cli.NewContext(app, flag.NewFlagSet("test", 0), nil))
+	assert.EqualError(t, err, "You must specify a config file")
+}
+
+func TestCmdDaemonInvalidHealthAddress(t *testing.T) {
+	configFile := writeDaemonConfig(t, command.DaemonConfig{})
+	defer removeFile(t, configFile)
+	app, _, _ := appWithTestWriters()
+	set := flag.NewFlagSet("test", 0)
+	set.String("config", configFile, "doc")
+	set.String("healthAddress", "notanaddress", "doc")
+	err := command.CmdDaemon(&runner.Test{})(cli.NewContext(app, set, nil))
+	assert.EqualError(t, err, "could not serve health status: listen tcp: address notanaddress: missing port in address")
+}
+
+func getDaemonConfigFile() string {
+	return fmt.Sprintf("%s/feedTubeDaemon.json", os.TempDir())
+}
+
+func getFeedConfigJSON(schedule string) string {
+	return fmt.Sprintf(`{"feeds": [{"name": "a", "command": "channel", %s}]}`, schedule)
+}
+
+func getDaemonFeed(name, outputFolder string) command.FeedConfig {
+	return command.FeedConfig{
+		Name:    name,
+		Command: "channel",
+		Args: []string{
+			"--apiKey", "fakeApiKey",
+			"--outputFolder", outputFolder,
+			"--xmlFile", fmt.Sprintf("%s/xmlFile", outputFolder),
+			"--baseURL", "http://foo.com",
+			"awesome",
+		},
+		Interval: "1h",
+	}
+}
+
+func writeDaemonConfig(t *testing.T, config command.DaemonConfig) string {
+	configBytes, err := json.Marshal(config)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(getDaemonConfigFile(), configBytes, 0644))
+	return getDaemonConfigFile()
+}
+
+func waitForRuns(t *testing.T, daemon *command.Daemon, runs int) *command.FeedStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		health := daemon.Health()
+		if len(health.Feeds) > 0 && health.Feeds[0].Runs >= runs {
+			return health.Feeds[0]
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	require.FailNow(t, fmt.Sprintf("the feed didn't run %d times", runs))
+	return nil
+}
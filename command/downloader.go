@@ -1,46 +1,99 @@
 package command
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
+	"log/slog"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/guywithnose/runner"
 )
 
 // Downloader downloads youtube videos
 type Downloader struct {
-	cmdBuilder   runner.Builder
-	outputFolder string
-	quality      string
+	cmdBuilder     runner.Builder
+	outputFolder   string
+	quality        string
+	subtitles      string
+	retry          *RetryPolicy
+	postProcessors []PostProcessor
+	logger         *slog.Logger
 }
 
-// NewDownloader returns a new Downloader
-func NewDownloader(cmdBuilder runner.Builder, outputFolder string, quality string) *Downloader {
+// NewDownloader returns a new Downloader.  When subtitles is set to a language, the subtitles in that language are downloaded too.
+// Failed downloads are retried according to retry, which may be nil.
+func NewDownloader(cmdBuilder runner.Builder, outputFolder, quality, subtitles string, retry *RetryPolicy, postProcessors ...PostProcessor) *Downloader {
 	return &Downloader{
-		cmdBuilder:   cmdBuilder,
-		outputFolder: outputFolder,
-		quality:      quality,
+		cmdBuilder:     cmdBuilder,
+		outputFolder:   outputFolder,
+		quality:        quality,
+		subtitles:      subtitles,
+		retry:          retry,
+		postProcessors: postProcessors,
+		logger:         discardLogger,
 	}
 }
 
-// DownloadVideos downloads any items that are not already in outputfolder
-func (downloader Downloader) DownloadVideos(items []*VideoData) error {
+// SetLogger sets the logger for download progress and youtube-dl output
+func (downloader *Downloader) SetLogger(logger *slog.Logger) {
+	downloader.logger = logger
+}
+
+// Plan splits items into the ones DownloadVideos would download and the ones already in outputFolder
+func (downloader Downloader) Plan(items []*VideoData) ([]*VideoData, []*VideoData) {
+	pending := make([]*VideoData, 0, len(items))
+	existing := make([]*VideoData, 0, len(items))
+	for _, item := range items {
+		if fileExists(getFileName(downloader.outputFolder, item)) {
+			existing = append(existing, item)
+		} else {
+			pending = append(pending, item)
+		}
+	}
+
+	return pending, existing
+}
+
+// DownloadVideos downloads any items that are not already in outputfolder and runs the post processors on each new file.
+// Failures are returned as an ItemError for the item that failed.
+// When ctx is done the download in progress is stopped and its partial files are removed.
+func (downloader Downloader) DownloadVideos(ctx context.Context, items []*VideoData) error {
 	for _, item := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		if fileExists(getFileName(downloader.outputFolder, item)) {
 			continue
 		}
 
-		err := downloader.downloadVideo(item.GUID, item.FileName)
+		err := downloader.downloadVideo(ctx, item.GUID, item.FileName)
 		if err != nil {
-			return err
+			return ItemError{Item: item, Err: err}
+		}
+
+		for _, postProcessor := range downloader.postProcessors {
+			err = postProcessor.Process(ctx, item, getFileName(downloader.outputFolder, item))
+			if err != nil {
+				// The download is removed so the next run downloads and processes it again instead of skipping it
+				removePartialFiles(downloader.outputFolder, item.FileName)
+				downloader.logger.Info("Removed download that failed processing", "video", item.GUID, "error", err)
+				return ItemError{Item: item, Err: err}
+			}
 		}
 	}
 
 	return nil
 }
 
-func (downloader Downloader) downloadVideo(videoID, fileName string) error {
+func (downloader Downloader) downloadVideo(ctx context.Context, videoID, fileName string) error {
 	params := []string{
 		"/usr/bin/youtube-dl",
 		"-x",
@@ -48,19 +101,98 @@ func (downloader Downloader) downloadVideo(videoID, fileName string) error {
 		"mp3",
 		"--audio-quality",
 		downloader.quality,
-		"-o",
-		fmt.Sprintf("%s/%s.%%(ext)s", downloader.outputFolder, fileName),
-		fmt.Sprintf("https://youtu.be/%s", videoID),
 	}
-	cmd := downloader.cmdBuilder.New("", params...)
-	out, err := cmd.CombinedOutput()
+	if downloader.subtitles != "" {
+		// Uploaded subtitles are preferred with the automatic captions as a fallback
+		params = append(params, "--write-sub", "--write-auto-sub", "--sub-lang", downloader.subtitles, "--sub-format", "vtt")
+	}
+
+	params = append(params, "-o", fmt.Sprintf("%s/%s.%%(ext)s", downloader.outputFolder, fileName), fmt.Sprintf("https://youtu.be/%s", videoID))
+	logger := downloader.logger.With("video", videoID)
+	logger.Info("Downloading video", "file", fileName)
+	started := time.Now()
+	err := downloader.retry.Do(ctx, func() (bool, error) {
+		out, err := runCommand(ctx, downloader.cmdBuilder.New("", params...))
+		logger.Debug("youtube-dl finished", "output", string(out))
+		if ctx.Err() != nil {
+			removePartialFiles(downloader.outputFolder, fileName)
+			logger.Info("Download interrupted", "error", ctx.Err())
+			return false, fmt.Errorf("download of %s interrupted: %v", fileName, ctx.Err())
+		}
+
+		if err != nil {
+			logger.Info("youtube-dl failed", "error", err, "retryable", isRetryableDownloadError(out))
+			return isRetryableDownloadError(out), fmt.Errorf("could not download %s: %v\nParams: '%s': %s", fileName, err, strings.Join(params, "' '"), string(out))
+		}
+
+		return false, nil
+	})
+	DefaultMetrics.Observe(MetricDownloadDuration, time.Since(started).Seconds())
 	if err != nil {
-		return fmt.Errorf("could not download %s: %v\nParams: '%s': %s", fileName, err, strings.Join(params, "' '"), string(out))
+		DefaultMetrics.Add(MetricDownloads, 1, "result", "failure")
+		return err
+	}
+
+	DefaultMetrics.Add(MetricDownloads, 1, "result", "success")
+	fileInfo, statErr := os.Stat(fmt.Sprintf("%s/%s.mp3", downloader.outputFolder, fileName))
+	if statErr == nil {
+		DefaultMetrics.Add(MetricDownloadedBytes, float64(fileInfo.Size()))
+		logger.Info("Downloaded video", "bytes", fileInfo.Size(), "duration", time.Since(started))
 	}
 
 	return nil
 }
 
+// runCommand runs cmd and kills it when ctx is done.  Commands that aren't processes, like the ones in tests, run to completion.
+// The command runs in its own process group so the ffmpeg youtube-dl starts is killed along with it.
+func runCommand(ctx context.Context, cmd runner.Command) ([]byte, error) {
+	execCmd, ok := cmd.(*exec.Cmd)
+	if !ok {
+		return cmd.CombinedOutput()
+	}
+
+	var out bytes.Buffer
+	execCmd.Stdout = &out
+	execCmd.Stderr = &out
+	if execCmd.SysProcAttr == nil {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	execCmd.SysProcAttr.Setpgid = true
+	err := execCmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- execCmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return out.Bytes(), err
+	case <-ctx.Done():
+		_ = syscall.Kill(-execCmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return out.Bytes(), ctx.Err()
+	}
+}
+
+// removePartialFiles removes whatever an interrupted youtube-dl left behind for fileName, like .part, .webm and subtitle files
+func removePartialFiles(outputFolder, fileName string) {
+	files, err := ioutil.ReadDir(outputFolder)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), fmt.Sprintf("%s.", fileName)) {
+			_ = os.Remove(filepath.Join(outputFolder, file.Name()))
+		}
+	}
+}
+
 func fileExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	return !os.IsNotExist(err)
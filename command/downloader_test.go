@@ -1,9 +1,14 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/guywithnose/runner"
 	"github.com/stretchr/testify/assert"
@@ -13,8 +18,8 @@ func TestDownloader(t *testing.T) {
 	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
 	videos := []*VideoData{getVideoData("vId1", "t"), getVideoData("vId2", "t2")}
 	cmdBuilder := getTestCommandBuilder(videos)
-	downloader := NewDownloader(cmdBuilder, outputFolder, "0")
-	assert.Nil(t, downloader.DownloadVideos(videos))
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", nil)
+	assert.Nil(t, downloader.DownloadVideos(context.Background(), videos))
 	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
 	assert.Equal(t, []error(nil), cmdBuilder.Errors)
 }
@@ -28,8 +33,27 @@ func TestDownloaderDoesntReDownloadExisitngFiles(t *testing.T) {
 	assert.Nil(t, err)
 	videos := []*VideoData{getVideoData("vId1", "t"), getVideoData("vId2", "t2")}
 	cmdBuilder := getTestCommandBuilder(videos[1:])
-	downloader := NewDownloader(cmdBuilder, outputFolder, "0")
-	assert.Nil(t, downloader.DownloadVideos(videos))
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", nil)
+	assert.Nil(t, downloader.DownloadVideos(context.Background(), videos))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+}
+
+func TestDownloaderSubtitles(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	cmdBuilder := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand(
+				"",
+				"/usr/bin/youtube-dl -x --audio-format mp3 --audio-quality 0 --write-sub --write-auto-sub --sub-lang en --sub-format vtt "+
+					"-o /tmp/testFeedTube/t-vId1.%\\(ext\\)s https://youtu.be/vId1",
+				"",
+				0,
+			),
+		},
+	}
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "en", nil)
+	assert.Nil(t, downloader.DownloadVideos(context.Background(), []*VideoData{getVideoData("vId1", "t")}))
 	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
 	assert.Equal(t, []error(nil), cmdBuilder.Errors)
 }
@@ -38,10 +62,10 @@ func TestDownloaderDownloadError(t *testing.T) {
 	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
 	videos := []*VideoData{getVideoData("vId1", "t")}
 	cmdBuilder := getTestErrorCommandBuilder(videos)
-	downloader := NewDownloader(cmdBuilder, outputFolder, "0")
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", nil)
 	assert.EqualError(
 		t,
-		downloader.DownloadVideos(videos),
+		downloader.DownloadVideos(context.Background(), videos),
 		"could not download t-vId1: exit status 1\nParams: '/usr/bin/youtube-dl' '-x' '--audio-format' 'mp3' '--audio-quality' '0' '-o' "+
 			"'/tmp/testFeedTube/t-vId1.%(ext)s' 'https://youtu.be/vId1': error downloading video vId1",
 	)
@@ -49,6 +73,168 @@ func TestDownloaderDownloadError(t *testing.T) {
 	assert.Equal(t, []error(nil), cmdBuilder.Errors)
 }
 
+func TestDownloaderRetriesTransientErrors(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	video := getVideoData("vId1", "t")
+	cmdBuilder := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand("", getDownloadCommand(video), "ERROR: Unable to download webpage: timed out", 1),
+			runner.NewExpectedCommand("", getDownloadCommand(video), "", 0),
+		},
+	}
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", NewRetryPolicy(2, 0))
+	assert.Nil(t, downloader.DownloadVideos(context.Background(), []*VideoData{video}))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+}
+
+func TestDownloaderDoesNotRetryPermanentErrors(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	video := getVideoData("vId1", "t")
+	cmdBuilder := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand("", getDownloadCommand(video), "ERROR: Video unavailable", 1),
+		},
+	}
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", NewRetryPolicy(2, 0))
+	err := downloader.DownloadVideos(context.Background(), []*VideoData{video})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "ERROR: Video unavailable")
+	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+}
+
+func TestDownloaderGivesUpRetrying(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	video := getVideoData("vId1", "t")
+	cmdBuilder := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand("", getDownloadCommand(video), "ERROR: HTTP Error 503", 1),
+			runner.NewExpectedCommand("", getDownloadCommand(video), "ERROR: HTTP Error 503", 1),
+		},
+	}
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", NewRetryPolicy(1, 0))
+	err := downloader.DownloadVideos(context.Background(), []*VideoData{video})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not download t-vId1: exit status 1")
+	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+}
+
+func TestDownloaderInterrupted(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	defer removeFile(t, outputFolder)
+	videos := []*VideoData{getVideoData("vId1", "t"), getVideoData("vId2", "t2")}
+	ctx, cancel := context.WithCancel(context.Background())
+	download := runner.NewExpectedCommand("", getDownloadCommand(videos[0]), "", -1)
+	download.Closure = func(string) {
+		// The signal arrives part way through the download
+		for _, partialFile := range []string{"t-vId1.webm.part", "t-vId1.en.vtt"} {
+			_, err := os.Create(fmt.Sprintf("%s/%s", outputFolder, partialFile))
+			assert.Nil(t, err)
+		}
+
+		cancel()
+	}
+	cmdBuilder := &runner.Test{ExpectedCommands: []*runner.ExpectedCommand{download}}
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", NewRetryPolicy(2, 0))
+	assert.EqualError(t, downloader.DownloadVideos(ctx, videos), "download of t-vId1 interrupted: context canceled")
+	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+	files, err := ioutil.ReadDir(outputFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(files))
+}
+
+func TestRunCommandKillsProcessWhenDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := runCommand(ctx, exec.Command("sleep", "10"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestRunCommandKillsChildProcessesWhenDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// The sleep outlives the shell unless the whole group is killed and holds the output open until it exits
+	_, err := runCommand(ctx, exec.Command("sh", "-c", "sleep 10; echo done"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestRunCommand(t *testing.T) {
+	out, err := runCommand(context.Background(), exec.Command("sh", "-c", "echo out; echo err >&2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "out\nerr\n", string(out))
+}
+
+func TestDownloaderPlan(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	defer removeFile(t, outputFolder)
+	_, err := os.Create(fmt.Sprintf("%s/t-vId1.mp3", outputFolder))
+	assert.Nil(t, err)
+	videos := []*VideoData{getVideoData("vId1", "t"), getVideoData("vId2", "t2")}
+	cmdBuilder := &runner.Test{}
+	pending, existing := NewDownloader(cmdBuilder, outputFolder, "0", "", nil).Plan(videos)
+	assert.Equal(t, []*VideoData{videos[1]}, pending)
+	assert.Equal(t, []*VideoData{videos[0]}, existing)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+}
+
+func TestDownloaderPostProcessesNewFiles(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	defer removeFile(t, outputFolder)
+	_, err := os.Create(fmt.Sprintf("%s/t-vId1.mp3", outputFolder))
+	assert.Nil(t, err)
+	videos := []*VideoData{getVideoData("vId1", "t"), getVideoData("vId2", "t2")}
+	cmdBuilder := getTestCommandBuilder(videos[1:])
+	postProcessor := &recordingPostProcessor{}
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", nil, postProcessor)
+	assert.Nil(t, downloader.DownloadVideos(context.Background(), videos))
+	assert.Equal(t, []string{"/tmp/testFeedTube/t2-vId2.mp3"}, postProcessor.fileNames)
+	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+}
+
+func TestDownloaderPostProcessError(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	defer removeFile(t, outputFolder)
+	videos := []*VideoData{getVideoData("vId1", "t"), getVideoData("vId2", "t2")}
+	cmdBuilder := getTestCommandBuilder(videos[:1])
+	cmdBuilder.ExpectedCommands[0].Closure = func(string) {
+		for _, fileName := range []string{"t-vId1.mp3", "t-vId1.en.vtt"} {
+			assert.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/%s", outputFolder, fileName), []byte("content"), 0644))
+		}
+	}
+	postProcessor := &recordingPostProcessor{err: errors.New("could not tag")}
+	downloader := NewDownloader(cmdBuilder, outputFolder, "0", "", nil, postProcessor)
+	assert.EqualError(t, downloader.DownloadVideos(context.Background(), videos), "could not tag")
+	assert.Equal(t, []string{"/tmp/testFeedTube/t-vId1.mp3"}, postProcessor.fileNames)
+	assert.Equal(t, []*runner.ExpectedCommand{}, cmdBuilder.ExpectedCommands)
+	assert.Equal(t, []error(nil), cmdBuilder.Errors)
+	// The next run downloads the video again
+	files, err := ioutil.ReadDir(outputFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(files))
+}
+
+type recordingPostProcessor struct {
+	fileNames []string
+	err       error
+}
+
+func (postProcessor *recordingPostProcessor) Process(_ context.Context, item *VideoData, fileName string) error {
+	postProcessor.fileNames = append(postProcessor.fileNames, fileName)
+	return postProcessor.err
+}
+
 func getVideoData(id, title string) *VideoData {
 	return &VideoData{
 		GUID:     id,
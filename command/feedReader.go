@@ -0,0 +1,132 @@
+package command
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	itunesNamespace  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	podcastNamespace = "https://podcastindex.org/namespace/1.0"
+	contentNamespace = "http://purl.org/rss/1.0/modules/content/"
+)
+
+// existingFeed is the subset of a previously written feed that is needed to build on it
+type existingFeed struct {
+	Channel struct {
+		Items []existingItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type existingItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	Enclosure   struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+	Image struct {
+		HREF string `xml:"href,attr"`
+	} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	Duration string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	Season   int    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	Episode  int    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+}
+
+// readExistingFeed parses a previously written feed file.  A missing file returns a nil feed.
+func readExistingFeed(xmlFileName string) (*existingFeed, error) {
+	xmlBytes, err := ioutil.ReadFile(xmlFileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read existing feed: %v", err)
+	}
+
+	feed := &existingFeed{}
+	err = xml.Unmarshal(xmlBytes, feed)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse existing feed %s: %v", xmlFileName, err)
+	}
+
+	return feed, nil
+}
+
+// ReadFeedItems parses the items in a previously written feed file back into VideoData
+func ReadFeedItems(xmlFileName string) ([]*VideoData, error) {
+	feed, err := readExistingFeed(xmlFileName)
+	if err != nil || feed == nil {
+		return []*VideoData{}, err
+	}
+
+	items := make([]*VideoData, 0, len(feed.Channel.Items))
+	for _, existing := range feed.Channel.Items {
+		pubDate, err := time.Parse(time.RFC1123Z, existing.PubDate)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing publish date on existing item %s: %v", existing.GUID, err)
+		}
+
+		items = append(items, &VideoData{
+			GUID:        existing.GUID,
+			Link:        existing.Link,
+			Title:       existing.Title,
+			Description: existing.Description,
+			FileName:    strings.TrimSuffix(path.Base(existing.Enclosure.URL), ".mp3"),
+			Image:       existing.Image.HREF,
+			PubDate:     pubDate.UTC(),
+			Season:      existing.Season,
+			Episode:     existing.Episode,
+			Duration:    existing.Duration,
+		})
+	}
+
+	return items, nil
+}
+
+// mergeExistingItems merges freshly scraped items with the items from the existing feed.
+// Scraped items win, but keep the known duration so the file doesn't need to be probed again.
+// Existing items that are no longer scraped are kept as long as their media is still in outputFolder.
+func mergeExistingItems(existing, items []*VideoData, outputFolder string) []*VideoData {
+	existingByGUID := make(map[string]*VideoData, len(existing))
+	for _, item := range existing {
+		existingByGUID[item.GUID] = item
+	}
+
+	merged := make([]*VideoData, 0, len(existing)+len(items))
+	for _, item := range items {
+		if existingItem, ok := existingByGUID[item.GUID]; ok {
+			if item.Duration == "" && existingItem.FileName == item.FileName {
+				item.Duration = existingItem.Duration
+			}
+
+			delete(existingByGUID, item.GUID)
+		}
+
+		merged = append(merged, item)
+	}
+
+	preserved := false
+	for _, item := range existing {
+		if _, ok := existingByGUID[item.GUID]; ok && fileExists(getFileName(outputFolder, item)) {
+			merged = append(merged, item)
+			preserved = true
+		}
+	}
+
+	if preserved {
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].PubDate.After(merged[j].PubDate)
+		})
+	}
+
+	return merged
+}
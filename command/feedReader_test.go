@@ -0,0 +1,185 @@
+package command_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	youtube "google.golang.org/api/youtube/v3"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestReadFeedItems(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFile := fmt.Sprintf("%s/xmlFile", outputFolder)
+	assert.Nil(t, ioutil.WriteFile(xmlFile, []byte(getExpectedSerialXML()), 0644))
+	items, err := command.ReadFeedItems(xmlFile)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]*command.VideoData{
+			{
+				GUID:        "vId1",
+				Link:        "https://youtu.be/vId1",
+				Title:       "t",
+				Description: "d https://youtu.be/vId1",
+				FileName:    "t-vId1",
+				Image:       "https://images.com/vid1Thumb.jpg",
+				PubDate:     time.Date(2007, time.January, 02, 15, 04, 05, 0, time.UTC),
+				Season:      2,
+				Episode:     3,
+				Duration:    "02:13:45",
+			},
+		},
+		items,
+	)
+}
+
+func TestReadFeedItemsMissingFile(t *testing.T) {
+	items, err := command.ReadFeedItems("/notAFile")
+	assert.Nil(t, err)
+	assert.Equal(t, []*command.VideoData{}, items)
+}
+
+func TestReadFeedItemsInvalidFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFile := fmt.Sprintf("%s/xmlFile", outputFolder)
+	assert.Nil(t, ioutil.WriteFile(xmlFile, []byte("<rss><channel>"), 0644))
+	_, err := command.ReadFeedItems(xmlFile)
+	assert.EqualError(t, err, fmt.Sprintf("could not parse existing feed %s: XML syntax error on line 1: unexpected EOF", xmlFile))
+}
+
+func TestReadFeedItemsInvalidDate(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFile := fmt.Sprintf("%s/xmlFile", outputFolder)
+	assert.Nil(t, ioutil.WriteFile(xmlFile, []byte("<rss><channel><item><guid>vId1</guid><pubDate>2007</pubDate></item></channel></rss>"), 0644))
+	_, err := command.ReadFeedItems(xmlFile)
+	assert.EqualError(
+		t,
+		err,
+		`error parsing publish date on existing item vId1: parsing time "2007" as "Mon, 02 Jan 2006 15:04:05 -0700": cannot parse "2007" as "Mon"`,
+	)
+}
+
+func TestCmdChannelIncremental(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	assert.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/t-vId1.mp3", outputFolder), []byte("123"), 0777))
+	assert.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/t2-vId2.mp3", outputFolder), []byte("12345"), 0777))
+	ts := getTestServer(getDefaultChannelResponses())
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("incremental", true, "doc")
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t-vId1.mp3", outputFolder), "Duration: 02:13:45.22, start", 0),
+			runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t2-vId2.mp3", outputFolder), "Duration: 00:13:45.22, start", 0),
+		},
+	}
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	ts.Close()
+	firstXML, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+
+	responses := getDefaultChannelResponses()
+	bytes, _ := json.Marshal(youtube.SearchListResponse{Items: []*youtube.SearchResult{}})
+	responses["/search?alt=json&channelId=awesomeChannelId&key=fakeApiKey&pageToken=page2&part=snippet&type=video"] = string(bytes)
+	ts = getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, writer, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("incremental", true, "doc")
+	cb = &runner.Test{}
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, fmt.Sprintf("Feed unchanged: %s/xmlFile\n", outputFolder), writer.String())
+	secondXML, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	assert.Equal(t, string(firstXML), string(secondXML))
+}
+
+func TestCmdChannelIncrementalDropsItemsWithoutMedia(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFile := fmt.Sprintf("%s/xmlFile", outputFolder)
+	assert.Nil(t, ioutil.WriteFile(xmlFile, []byte(getExpectedSerialXML()), 0644))
+	responses := getDefaultChannelResponses()
+	bytes, _ := json.Marshal(youtube.SearchListResponse{Items: []*youtube.SearchResult{}})
+	responses["/search?alt=json&channelId=awesomeChannelId&key=fakeApiKey&part=snippet&type=video"] = string(bytes)
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("incremental", true, "doc")
+	cb := &runner.Test{}
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []error(nil), cb.Errors)
+	items, err := command.ReadFeedItems(xmlFile)
+	assert.Nil(t, err)
+	assert.Equal(t, []*command.VideoData{}, items)
+}
+
+func TestCmdChannelIncrementalInvalidFeed(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFile := fmt.Sprintf("%s/xmlFile", outputFolder)
+	assert.Nil(t, ioutil.WriteFile(xmlFile, []byte("<rss>"), 0644))
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.Bool("incremental", true, "doc")
+	cb := &runner.Test{}
+	assert.EqualError(
+		t,
+		command.CmdChannel(cb)(cli.NewContext(app, set, nil)),
+		fmt.Sprintf("could not parse existing feed %s: XML syntax error on line 1: unexpected EOF", xmlFile),
+	)
+}
+
+func getExpectedSerialXML() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+  <channel>
+    <title>t</title>
+    <link>https://www.youtube.com/channel/awesomeChannelId</link>
+    <description>d</description>
+    <lastBuildDate>Tue, 02 Jan 2007 15:04:05 +0000</lastBuildDate>
+    <pubDate>Tue, 02 Jan 2007 15:04:05 +0000</pubDate>
+    <itunes:type>serial</itunes:type>
+    <item>
+      <guid>vId1</guid>
+      <title>t</title>
+      <link>https://youtu.be/vId1</link>
+      <description>d https://youtu.be/vId1</description>
+      <pubDate>Tue, 02 Jan 2007 15:04:05 +0000</pubDate>
+      <enclosure url="http://foo.com/t-vId1.mp3" length="3" type="audio/mpeg"></enclosure>
+      <itunes:image href="https://images.com/vid1Thumb.jpg"></itunes:image>
+      <itunes:duration>02:13:45</itunes:duration>
+      <itunes:season>2</itunes:season>
+      <itunes:episode>3</itunes:episode>
+    </item>
+  </channel>
+</rss>`
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/guywithnose/runner"
+)
+
+// runFfmpeg runs ffmpeg with args on sourceFileName, copying the other streams and metadata, and swaps the result in for fileName once it is complete.
+// sourceFileName and fileName may be the same file.  action describes what ffmpeg does in errors and ffmpeg is killed when ctx is done.
+func runFfmpeg(ctx context.Context, cmdBuilder runner.Builder, action, sourceFileName, fileName string, args ...string) error {
+	extension := filepath.Ext(fileName)
+	tempFileName := fmt.Sprintf("%s.processing%s", strings.TrimSuffix(fileName, extension), extension)
+	params := []string{"/usr/bin/ffmpeg", "-y", "-hide_banner", "-nostats", "-i", sourceFileName, "-map", "0", "-map_metadata", "0", "-c:v", "copy"}
+	params = append(append(params, args...), tempFileName)
+	out, err := runCommand(ctx, cmdBuilder.New("", params...))
+	if err != nil {
+		_ = os.Remove(tempFileName)
+		return fmt.Errorf("could not %s %s: %v\nParams: '%s': %s", action, sourceFileName, err, strings.Join(params, "' '"), string(out))
+	}
+
+	err = os.Rename(tempFileName, fileName)
+	if err != nil {
+		return fmt.Errorf("could not replace %s: %v", fileName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package command
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	id3HeaderSize     = 10
+	id3FooterFlag     = 0x10
+	id3EncodingUTF8   = 0x03
+	id3PictureCover   = 0x03
+	id3MaxSyncsafeInt = 1<<28 - 1
+	id3TOCTopLevel    = 0x01
+	id3TOCOrdered     = 0x02
+	id3MaxTOCEntries  = 255
+	id3OffsetUnused   = math.MaxUint32
+)
+
+type id3Frame struct {
+	id   string
+	data []byte
+}
+
+// writeID3File copies the audio from in to out behind a fresh ID3v2.4 tag, dropping any ID3v2 tag in was carrying
+func writeID3File(in *os.File, out *os.File, tags Tags) error {
+	audioOffset, err := id3TagSize(in)
+	if err != nil {
+		return err
+	}
+
+	tag, err := buildID3Tag(id3Frames(tags))
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(tag)
+	if err != nil {
+		return err
+	}
+
+	_, err = in.Seek(audioOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// id3TagSize returns the size of the ID3v2 tag at the start of r, or 0 when there isn't one
+func id3TagSize(r io.ReaderAt) (int64, error) {
+	header := make([]byte, id3HeaderSize)
+	_, err := r.ReadAt(header, 0)
+	if err == io.EOF {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0, nil
+	}
+
+	size := int64(decodeSyncsafe(header[6:10])) + id3HeaderSize
+	if header[5]&id3FooterFlag != 0 {
+		size += id3HeaderSize
+	}
+
+	return size, nil
+}
+
+func id3Frames(tags Tags) []id3Frame {
+	frames := make([]id3Frame, 0, 7)
+	frames = appendID3TextFrame(frames, "TIT2", tags.Title)
+	frames = appendID3TextFrame(frames, "TPE1", tags.Artist)
+	frames = appendID3TextFrame(frames, "TALB", tags.Album)
+	if !tags.Date.IsZero() {
+		frames = appendID3TextFrame(frames, "TDRC", tags.Date.UTC().Format("2006-01-02"))
+	}
+
+	if tags.Track > 0 {
+		frames = appendID3TextFrame(frames, "TRCK", strconv.Itoa(tags.Track))
+	}
+
+	if tags.Comment != "" {
+		// Encoding, language and an empty content descriptor come before the comment itself
+		data := append([]byte{id3EncodingUTF8, 'e', 'n', 'g', 0}, tags.Comment...)
+		frames = append(frames, id3Frame{id: "COMM", data: data})
+	}
+
+	if len(tags.Artwork) != 0 {
+		// Encoding, MIME type, picture type and an empty description come before the image itself
+		data := append([]byte{id3EncodingUTF8}, tags.ArtworkMIME...)
+		data = append(data, 0, id3PictureCover, 0)
+		frames = append(frames, id3Frame{id: "APIC", data: append(data, tags.Artwork...)})
+	}
+
+	return append(frames, id3ChapterFrames(tags.Chapters, tags.Duration)...)
+}
+
+// id3ChapterFrames builds a table of contents and a CHAP frame for each chapter.
+// Each chapter ends where the next one starts and the last one ends at duration.
+func id3ChapterFrames(chapters []Chapter, duration time.Duration) []id3Frame {
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	if len(chapters) > id3MaxTOCEntries {
+		chapters = chapters[:id3MaxTOCEntries]
+	}
+
+	toc := append([]byte("toc\x00"), id3TOCTopLevel|id3TOCOrdered, byte(len(chapters)))
+	frames := make([]id3Frame, 1, len(chapters)+1)
+	for i, chapter := range chapters {
+		elementID := fmt.Sprintf("chp%d\x00", i)
+		toc = append(toc, elementID...)
+		end := duration
+		if i+1 < len(chapters) {
+			end = chapters[i+1].Start
+		}
+
+		if end < chapter.Start {
+			end = chapter.Start
+		}
+
+		// Start and end times in milliseconds are followed by byte offsets which aren't used
+		data := make([]byte, len(elementID)+16)
+		copy(data, elementID)
+		binary.BigEndian.PutUint32(data[len(elementID):], uint32(chapter.Start/time.Millisecond))
+		binary.BigEndian.PutUint32(data[len(elementID)+4:], uint32(end/time.Millisecond))
+		binary.BigEndian.PutUint32(data[len(elementID)+8:], id3OffsetUnused)
+		binary.BigEndian.PutUint32(data[len(elementID)+12:], id3OffsetUnused)
+		title, _ := encodeID3Frame(id3Frame{id: "TIT2", data: append([]byte{id3EncodingUTF8}, chapter.Title...)})
+		frames = append(frames, id3Frame{id: "CHAP", data: append(data, title...)})
+	}
+
+	frames[0] = id3Frame{id: "CTOC", data: toc}
+	return frames
+}
+
+func appendID3TextFrame(frames []id3Frame, id, text string) []id3Frame {
+	if text == "" {
+		return frames
+	}
+
+	return append(frames, id3Frame{id: id, data: append([]byte{id3EncodingUTF8}, text...)})
+}
+
+func buildID3Tag(frames []id3Frame) ([]byte, error) {
+	body := &bytes.Buffer{}
+	for _, frame := range frames {
+		encoded, err := encodeID3Frame(frame)
+		if err != nil {
+			return nil, err
+		}
+
+		body.Write(encoded)
+	}
+
+	tagSize, err := encodeSyncsafe(body.Len())
+	if err != nil {
+		return nil, fmt.Errorf("ID3 tag is too large")
+	}
+
+	tag := bytes.NewBuffer(make([]byte, 0, id3HeaderSize+body.Len()))
+	tag.WriteString("ID3")
+	tag.Write([]byte{4, 0, 0})
+	tag.Write(tagSize)
+	tag.Write(body.Bytes())
+	return tag.Bytes(), nil
+}
+
+func encodeID3Frame(frame id3Frame) ([]byte, error) {
+	frameSize, err := encodeSyncsafe(len(frame.data))
+	if err != nil {
+		return nil, fmt.Errorf("%s frame is too large", frame.id)
+	}
+
+	encoded := make([]byte, 0, id3HeaderSize+len(frame.data))
+	encoded = append(encoded, frame.id...)
+	encoded = append(encoded, frameSize...)
+	encoded = append(encoded, 0, 0)
+	return append(encoded, frame.data...), nil
+}
+
+// encodeSyncsafe encodes n as a 4 byte ID3 syncsafe integer which only uses the low 7 bits of each byte
+func encodeSyncsafe(n int) ([]byte, error) {
+	if n < 0 || n > id3MaxSyncsafeInt {
+		return nil, fmt.Errorf("%d does not fit in a syncsafe integer", n)
+	}
+
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}, nil
+}
+
+func decodeSyncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
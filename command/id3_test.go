@@ -0,0 +1,127 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fakeMP3Audio = []byte{0xff, 0xfb, 0x90, 0x00, 'a', 'u', 'd', 'i', 'o'}
+
+func TestWriteTagsMP3(t *testing.T) {
+	fileName := writeFixture(t, "fixture.mp3", fakeMP3Audio)
+	defer removeFile(t, fileName)
+	assert.Nil(t, WriteTags(fileName, getTestTags()))
+	frames, audio := readID3File(t, fileName)
+	assert.Equal(
+		t,
+		[]id3Frame{
+			{id: "TIT2", data: []byte("\x03t")},
+			{id: "TPE1", data: []byte("\x03channel")},
+			{id: "TALB", data: []byte("\x03feed")},
+			{id: "TDRC", data: []byte("\x032007-01-02")},
+			{id: "TRCK", data: []byte("\x033")},
+			{id: "COMM", data: []byte("\x03eng\x00https://youtu.be/vId1")},
+			{id: "APIC", data: []byte("\x03image/png\x00\x03\x00artwork")},
+		},
+		frames,
+	)
+	assert.Equal(t, fakeMP3Audio, audio)
+}
+
+func TestWriteTagsMP3ReplacesExistingTag(t *testing.T) {
+	// An ID3v2.3 tag with a footer flag set and a single TSSE frame
+	existingTag := []byte{'I', 'D', '3', 3, 0, 0x10, 0, 0, 0, 15, 'T', 'S', 'S', 'E', 0, 0, 0, 5, 0, 0, 0, 'L', 'a', 'v', 'f'}
+	existingTag = append(existingTag, []byte{'3', 'D', 'I', 3, 0, 0x10, 0, 0, 0, 15}...)
+	fileName := writeFixture(t, "fixture.mp3", append(existingTag, fakeMP3Audio...))
+	defer removeFile(t, fileName)
+	assert.Nil(t, WriteTags(fileName, Tags{Title: "t"}))
+	frames, audio := readID3File(t, fileName)
+	assert.Equal(t, []id3Frame{{id: "TIT2", data: []byte("\x03t")}}, frames)
+	assert.Equal(t, fakeMP3Audio, audio)
+}
+
+func TestWriteTagsMP3Chapters(t *testing.T) {
+	fileName := writeFixture(t, "fixture.mp3", fakeMP3Audio)
+	defer removeFile(t, fileName)
+	tags := Tags{
+		Chapters: []Chapter{{Start: 0, Title: "Intro"}, {Start: 90 * time.Second, Title: "Topic"}},
+		Duration: 2 * time.Minute,
+	}
+	assert.Nil(t, WriteTags(fileName, tags))
+	frames, audio := readID3File(t, fileName)
+	assert.Equal(
+		t,
+		[]id3Frame{
+			{id: "CTOC", data: []byte("toc\x00\x03\x02chp0\x00chp1\x00")},
+			{
+				id: "CHAP",
+				data: []byte("chp0\x00\x00\x00\x00\x00\x00\x01\x5f\x90\xff\xff\xff\xff\xff\xff\xff\xff" +
+					"TIT2\x00\x00\x00\x06\x00\x00\x03Intro"),
+			},
+			{
+				id: "CHAP",
+				data: []byte("chp1\x00\x00\x01\x5f\x90\x00\x01\xd4\xc0\xff\xff\xff\xff\xff\xff\xff\xff" +
+					"TIT2\x00\x00\x00\x06\x00\x00\x03Topic"),
+			},
+		},
+		frames,
+	)
+	assert.Equal(t, fakeMP3Audio, audio)
+}
+
+func TestWriteTagsMissingFile(t *testing.T) {
+	err := WriteTags("/doesntexist/t-vId1.mp3", Tags{})
+	assert.EqualError(t, err, "could not tag /doesntexist/t-vId1.mp3: open /doesntexist/t-vId1.mp3: no such file or directory")
+}
+
+func TestWriteTagsUnsupportedFile(t *testing.T) {
+	assert.EqualError(t, WriteTags("/tmp/t-vId1.ogg", Tags{}), "could not tag /tmp/t-vId1.ogg: unsupported file type")
+}
+
+func TestSyncsafe(t *testing.T) {
+	encoded, err := encodeSyncsafe(257)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0, 2, 1}, encoded)
+	assert.Equal(t, 257, decodeSyncsafe(encoded))
+	_, err = encodeSyncsafe(id3MaxSyncsafeInt + 1)
+	assert.EqualError(t, err, "268435456 does not fit in a syncsafe integer")
+}
+
+func getTestTags() Tags {
+	return Tags{
+		Title:       "t",
+		Artist:      "channel",
+		Album:       "feed",
+		Date:        time.Date(2007, time.January, 02, 15, 04, 05, 0, time.UTC),
+		Track:       3,
+		Comment:     "https://youtu.be/vId1",
+		Artwork:     []byte("artwork"),
+		ArtworkMIME: "image/png",
+	}
+}
+
+func writeFixture(t *testing.T, name string, contents []byte) string {
+	fileName := fmt.Sprintf("%s/%s", os.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(fileName, contents, 0644))
+	return fileName
+}
+
+func readID3File(t *testing.T, fileName string) ([]id3Frame, []byte) {
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{'I', 'D', '3', 4, 0, 0}, contents[:6])
+	tagEnd := id3HeaderSize + decodeSyncsafe(contents[6:10])
+	frames := make([]id3Frame, 0)
+	for offset := id3HeaderSize; offset < tagEnd; {
+		size := decodeSyncsafe(contents[offset+4 : offset+8])
+		frames = append(frames, id3Frame{id: string(contents[offset : offset+4]), data: contents[offset+10 : offset+10+size]})
+		offset += 10 + size
+	}
+
+	return frames, contents[tagEnd:]
+}
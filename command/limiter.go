@@ -0,0 +1,59 @@
+package command
+
+import (
+	"context"
+	"sync"
+)
+
+// runLimiter caps how many feeds build at once.  The limit can change while runs are in progress and they still count against it.
+type runLimiter struct {
+	mutex   sync.Mutex
+	limit   int
+	active  int
+	changed chan struct{}
+}
+
+func newRunLimiter(limit int) *runLimiter {
+	return &runLimiter{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire waits for a free slot and reports whether it got one before ctx was done
+func (limiter *runLimiter) acquire(ctx context.Context) bool {
+	for {
+		limiter.mutex.Lock()
+		if limiter.active < limiter.limit {
+			limiter.active++
+			limiter.mutex.Unlock()
+			return true
+		}
+
+		changed := limiter.changed
+		limiter.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// release gives back a slot taken by acquire
+func (limiter *runLimiter) release() {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.active--
+	limiter.wakeWaiters()
+}
+
+// resize changes the limit.  When it shrinks the runs over the new limit finish and no more start until there is room.
+func (limiter *runLimiter) resize(limit int) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.limit = limit
+	limiter.wakeWaiters()
+}
+
+func (limiter *runLimiter) wakeWaiters() {
+	close(limiter.changed)
+	limiter.changed = make(chan struct{})
+}
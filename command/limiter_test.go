@@ -0,0 +1,54 @@
+package command
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLimiter(t *testing.T) {
+	limiter := newRunLimiter(1)
+	assert.True(t, limiter.acquire(context.Background()))
+	acquired := make(chan bool)
+	go func() {
+		acquired <- limiter.acquire(context.Background())
+	}()
+
+	select {
+	case <-acquired:
+		assert.Fail(t, "the second run started while the first was running")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	limiter.release()
+	assert.True(t, <-acquired)
+}
+
+func TestRunLimiterResize(t *testing.T) {
+	limiter := newRunLimiter(2)
+	assert.True(t, limiter.acquire(context.Background()))
+	assert.True(t, limiter.acquire(context.Background()))
+
+	// Runs in progress still count after the limit shrinks
+	limiter.resize(1)
+	limiter.release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, limiter.acquire(ctx))
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- limiter.acquire(context.Background())
+	}()
+	limiter.resize(2)
+	assert.True(t, <-acquired)
+}
+
+func TestRunLimiterCancelled(t *testing.T) {
+	limiter := newRunLimiter(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, limiter.acquire(ctx))
+}
@@ -0,0 +1,11 @@
+package command
+
+import (
+	"github.com/guywithnose/runner"
+	"github.com/urfave/cli"
+)
+
+// CmdList builds an rss feed from a file listing youtube videos
+func CmdList(cmdBuilder runner.Builder) func(c *cli.Context) error {
+	return CmdSource("list", "Usage: \"feedTube list {listFile}\"", cmdBuilder)
+}
@@ -0,0 +1,60 @@
+package command_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestCmdList(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	listFile := writeVideoList(t, "vId1\nhttps://youtu.be/vId2\n")
+	defer removeFile(t, listFile)
+	ts := getTestServer(getDefaultVideoListResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	set := flag.NewFlagSet("test", 0)
+	set.String("apiKey", "fakeApiKey", "doc")
+	set.String("outputFolder", outputFolder, "doc")
+	set.String("xmlFile", fmt.Sprintf("%s/xmlFile", outputFolder), "doc")
+	set.String("baseURL", "http://foo.com", "doc")
+	set.String("quality", "0", "doc")
+	set.String("overrideImage", "https://images.com/thumb.jpg", "doc")
+	assert.Nil(t, set.Parse([]string{listFile}))
+	app, _, _ := appWithTestWriters()
+	cb := getBaseRunner()
+	assert.Nil(t, command.CmdList(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	xmlLines := strings.Split(string(xmlBytes), "\n")
+	expectedXML := getExpectedChannelXML(xmlLines[8:10])
+	expectedXML[3] = "    <title>feedTubeVideoList</title>"
+	expectedXML[4] = "    <link>https://www.youtube.com</link>"
+	expectedXML[5] = "    <description>Videos listed in feedTubeVideoList.txt</description>"
+	assert.Equal(t, expectedXML, xmlLines)
+}
+
+func TestCmdListMissingFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	cb := &runner.Test{}
+	assert.EqualError(t, command.CmdList(cb)(cli.NewContext(app, set, nil)), "could not read video list: open awesome: no such file or directory")
+}
+
+func TestCmdListUsage(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	app, _, _ := appWithTestWriters()
+	assert.EqualError(t, command.CmdList(&runner.Test{})(cli.NewContext(app, set, nil)), `Usage: "feedTube list {listFile}"`)
+}
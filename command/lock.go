@@ -0,0 +1,174 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	lockFileName     = ".feedTube-lock"
+	lockPollInterval = 250 * time.Millisecond
+)
+
+// FeedLock keeps two runs from building into the same output folder at once.
+// The lock file is held with flock, so the lock goes away with a run that dies and separate FeedLocks in one process exclude each other too.
+// The file holds the PID of the run that owns it so the error can say who is building the feed.
+type FeedLock struct {
+	fileName string
+	mutex    sync.Mutex
+	file     *os.File
+}
+
+// NewFeedLock returns a FeedLock for outputFolder
+func NewFeedLock(outputFolder string) *FeedLock {
+	return &FeedLock{fileName: filepath.Join(outputFolder, lockFileName)}
+}
+
+// FileName returns the lock file so the cleaner can leave it alone
+func (lock *FeedLock) FileName() string {
+	return lock.fileName
+}
+
+// Acquire takes the lock.  When another run holds it Acquire fails right away unless wait is set.
+// Otherwise it waits until the lock is free, ctx is done or timeout passes when it is above 0.
+func (lock *FeedLock) Acquire(ctx context.Context, wait bool, timeout time.Duration) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+
+	for {
+		acquired, owner, err := lock.tryAcquire()
+		if err != nil || acquired {
+			return err
+		}
+
+		if !wait {
+			return fmt.Errorf("feed in %s is being built by %s", filepath.Dir(lock.fileName), describeOwner(owner))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("gave up waiting for %s to finish building the feed in %s", describeOwner(owner), filepath.Dir(lock.fileName))
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Release removes the lock file and unlocks it if this FeedLock holds it
+func (lock *FeedLock) Release() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.file == nil {
+		return nil
+	}
+
+	// The file is removed while it is still locked so a run waiting on it notices and locks the next one instead
+	err := os.Remove(lock.fileName)
+	_ = syscall.Flock(int(lock.file.Fd()), syscall.LOCK_UN)
+	_ = lock.file.Close()
+	lock.file = nil
+	return err
+}
+
+// tryAcquire takes the lock if nobody holds it and otherwise returns the PID of the run that does
+func (lock *FeedLock) tryAcquire() (bool, int, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.file != nil {
+		return false, os.Getpid(), nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(lock.fileName), 0777)
+	if err != nil {
+		return false, 0, fmt.Errorf("could not create lock %s: %v", lock.fileName, err)
+	}
+
+	for {
+		file, err := os.OpenFile(lock.fileName, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return false, 0, fmt.Errorf("could not create lock %s: %v", lock.fileName, err)
+		}
+
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == syscall.EWOULDBLOCK {
+			_ = file.Close()
+			return false, lock.owner(), nil
+		}
+
+		if err != nil {
+			_ = file.Close()
+			return false, 0, fmt.Errorf("could not lock %s: %v", lock.fileName, err)
+		}
+
+		if !lock.isCurrentFile(file) {
+			// The run that held the lock removed the file after this one opened it
+			_ = file.Close()
+			continue
+		}
+
+		err = writeOwner(file)
+		if err != nil {
+			_ = file.Close()
+			return false, 0, fmt.Errorf("could not create lock %s: %v", lock.fileName, err)
+		}
+
+		lock.file = file
+		return true, 0, nil
+	}
+}
+
+// isCurrentFile reports whether file is still the one at the lock file path
+func (lock *FeedLock) isCurrentFile(file *os.File) bool {
+	openInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	pathInfo, err := os.Stat(lock.fileName)
+	return err == nil && os.SameFile(openInfo, pathInfo)
+}
+
+// owner returns the PID in the lock file or 0 when there is no valid one
+func (lock *FeedLock) owner() int {
+	pidBytes, err := ioutil.ReadFile(lock.fileName)
+	if err != nil {
+		return 0
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	if err != nil || pid <= 0 {
+		return 0
+	}
+
+	return pid
+}
+
+func writeOwner(file *os.File) error {
+	err := file.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	return err
+}
+
+// describeOwner names the run holding a lock, which may not have written its PID yet
+func describeOwner(pid int) string {
+	if pid == 0 {
+		return "another process"
+	}
+
+	return fmt.Sprintf("process %d", pid)
+}
@@ -0,0 +1,175 @@
+package command_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestFeedLock(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	lock := command.NewFeedLock(outputFolder)
+	assert.Equal(t, fmt.Sprintf("%s/.feedTube-lock", outputFolder), lock.FileName())
+	require.Nil(t, lock.Acquire(context.Background(), false, 0))
+	assertFileContents(t, lock.FileName(), fmt.Sprintf("%d\n", os.Getpid()))
+	files, err := ioutil.ReadDir(outputFolder)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Nil(t, lock.Release())
+	_, err = os.Stat(lock.FileName())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFeedLockHeld(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	require.Nil(t, command.NewFeedLock(outputFolder).Acquire(context.Background(), false, 0))
+	err := command.NewFeedLock(outputFolder).Acquire(context.Background(), false, 0)
+	assert.EqualError(t, err, fmt.Sprintf("feed in %s is being built by process %d", outputFolder, os.Getpid()))
+}
+
+func TestFeedLockWaits(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	first := command.NewFeedLock(outputFolder)
+	require.Nil(t, first.Acquire(context.Background(), false, 0))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, first.Release())
+	}()
+	assert.Nil(t, command.NewFeedLock(outputFolder).Acquire(context.Background(), true, time.Minute))
+	assertFileContents(t, first.FileName(), fmt.Sprintf("%d\n", os.Getpid()))
+}
+
+func TestFeedLockWaitTimeout(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	require.Nil(t, command.NewFeedLock(outputFolder).Acquire(context.Background(), false, 0))
+	err := command.NewFeedLock(outputFolder).Acquire(context.Background(), true, 10*time.Millisecond)
+	assert.EqualError(t, err, fmt.Sprintf("gave up waiting for process %d to finish building the feed in %s", os.Getpid(), outputFolder))
+}
+
+func TestFeedLockWaitCancelled(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	require.Nil(t, command.NewFeedLock(outputFolder).Acquire(context.Background(), false, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, command.NewFeedLock(outputFolder).Acquire(ctx, true, 0))
+}
+
+func TestFeedLockStale(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	finished := exec.Command("true")
+	require.Nil(t, finished.Run())
+	for _, contents := range []string{fmt.Sprintf("%d\n", finished.ProcessState.Pid()), "garbage"} {
+		writeOutputFiles(t, outputFolder)
+		lock := command.NewFeedLock(outputFolder)
+		require.Nil(t, ioutil.WriteFile(lock.FileName(), []byte(contents), 0644))
+		assert.Nil(t, lock.Acquire(context.Background(), false, 0))
+		assertFileContents(t, lock.FileName(), fmt.Sprintf("%d\n", os.Getpid()))
+		assert.Nil(t, lock.Release())
+	}
+}
+
+func TestFeedLockHeldByAnotherProcess(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder)
+	lock := command.NewFeedLock(outputFolder)
+	// A lock taken on its own open file behaves like one taken by another process
+	file, err := os.OpenFile(lock.FileName(), os.O_CREATE|os.O_RDWR, 0644)
+	require.Nil(t, err)
+	defer func() {
+		_ = file.Close()
+	}()
+	require.Nil(t, syscall.Flock(int(file.Fd()), syscall.LOCK_EX))
+	_, err = file.WriteString("1\n")
+	require.Nil(t, err)
+	assert.EqualError(t, lock.Acquire(context.Background(), false, 0), fmt.Sprintf("feed in %s is being built by process 1", outputFolder))
+	require.Nil(t, syscall.Flock(int(file.Fd()), syscall.LOCK_UN))
+	assert.Nil(t, lock.Acquire(context.Background(), false, 0))
+	assert.Nil(t, lock.Release())
+}
+
+func TestFeedLockConcurrent(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	var acquired int32
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if command.NewFeedLock(outputFolder).Acquire(context.Background(), false, 0) == nil {
+				atomic.AddInt32(&acquired, 1)
+			}
+		}()
+	}
+
+	wait.Wait()
+	assert.Equal(t, int32(1), acquired)
+}
+
+func TestFeedLockReleaseKeepsOtherLocks(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	lock := command.NewFeedLock(outputFolder)
+	writeOutputFiles(t, outputFolder)
+	require.Nil(t, ioutil.WriteFile(lock.FileName(), []byte("1\n"), 0644))
+	assert.Nil(t, lock.Release())
+	assertFileContents(t, lock.FileName(), "1\n")
+}
+
+func TestCmdChannelLocked(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	require.Nil(t, command.NewFeedLock(outputFolder).Acquire(context.Background(), false, 0))
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.Bool("noWait", true, "doc")
+	cb := &runner.Test{}
+	err := command.CmdChannel(cb)(cli.NewContext(app, set, nil))
+	assert.EqualError(t, err, fmt.Sprintf("feed in %s is being built by process %d", outputFolder, os.Getpid()))
+	assert.Equal(t, []error(nil), cb.Errors)
+	_, err = os.Stat(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCmdChannelKeepsLockFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := getFfprobeRunner()
+	cb.ExpectedCommands[0].Closure = func(string) {
+		// The lock is held while the feed is built
+		_, err := os.Stat(fmt.Sprintf("%s/.feedTube-lock", outputFolder))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "", errWriter.String())
+	_, err := os.Stat(fmt.Sprintf("%s/.feedTube-lock", outputFolder))
+	assert.True(t, os.IsNotExist(err))
+}
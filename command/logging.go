@@ -0,0 +1,74 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+type loggingTransport struct {
+	base   http.RoundTripper
+	logger *slog.Logger
+}
+
+// NewLogger returns a logger that writes logfmt, or JSON when format is json, lines at level and above to writer
+func NewLogger(writer io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(writer, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(writer, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %s: must be text or json", format)
+	}
+}
+
+// getLogger builds the logger from the --verbose, --quiet and --logFormat flags.
+// Only warnings and errors are logged by default to keep cron runs quiet.
+func getLogger(c *cli.Context) (*slog.Logger, error) {
+	level := slog.LevelWarn
+	if c.Bool("verbose") {
+		level = slog.LevelDebug
+	}
+
+	if c.Bool("quiet") {
+		level = slog.LevelError
+	}
+
+	return NewLogger(c.App.ErrWriter, c.String("logFormat"), level)
+}
+
+// LoggingTransport returns a TransportWrapper that logs every API request at debug level
+func LoggingTransport(logger *slog.Logger) TransportWrapper {
+	return loggingTransportWrapper{logger: logger}
+}
+
+type loggingTransportWrapper struct {
+	logger *slog.Logger
+}
+
+// Transport wraps base so every API request is logged
+func (wrapper loggingTransportWrapper) Transport(base http.RoundTripper) http.RoundTripper {
+	return &loggingTransport{base: base, logger: wrapper.logger}
+}
+
+// RoundTrip logs the API method, the status and how long the request took
+func (transport loggingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	started := time.Now()
+	response, err := transport.base.RoundTrip(request)
+	if err != nil {
+		transport.logger.Debug("API request failed", "method", path.Base(request.URL.Path), "error", err, "duration", time.Since(started))
+		return nil, err
+	}
+
+	transport.logger.Debug("API request", "method", path.Base(request.URL.Path), "status", response.StatusCode, "duration", time.Since(started))
+	return response, nil
+}
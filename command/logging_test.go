@@ -0,0 +1,140 @@
+package command_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestNewLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := command.NewLogger(&out, "text", slog.LevelInfo)
+	require.Nil(t, err)
+	logger.Debug("hidden")
+	logger.Info("shown", "video", "vId1")
+	assert.NotContains(t, out.String(), "hidden")
+	assert.Contains(t, out.String(), "level=INFO msg=shown video=vId1\n")
+}
+
+func TestNewLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := command.NewLogger(&out, "json", slog.LevelInfo)
+	require.Nil(t, err)
+	logger.Info("shown", "video", "vId1")
+	line := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "shown", line["msg"])
+	assert.Equal(t, "vId1", line["video"])
+}
+
+func TestNewLoggerInvalidFormat(t *testing.T) {
+	_, err := command.NewLogger(&bytes.Buffer{}, "xml", slog.LevelInfo)
+	assert.EqualError(t, err, "invalid log format xml: must be text or json")
+}
+
+func TestLoggingTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	var out bytes.Buffer
+	logger, err := command.NewLogger(&out, "text", slog.LevelDebug)
+	require.Nil(t, err)
+	client := &http.Client{Transport: command.LoggingTransport(logger).Transport(http.DefaultTransport)}
+	response, err := client.Get(fmt.Sprintf("%s/youtube/v3/channels", ts.URL))
+	require.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"API request\" method=channels status=404 duration=")
+}
+
+func TestCmdChannelVerbose(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("verbose", true, "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	for _, expected := range []string{
+		`level=DEBUG msg="API request" feed=channel:awesome method=channels status=200`,
+		"level=INFO msg=\"Fetched videos\" feed=channel:awesome count=2\n",
+		"level=INFO msg=\"Downloading video\" feed=channel:awesome video=vId2 file=t2-vId2\n",
+		"level=DEBUG msg=\"youtube-dl finished\" feed=channel:awesome video=vId2 output=\"video 2 output\"\n",
+		"level=DEBUG msg=\"Found channel\" feed=channel:awesome channel=awesomeChannelId title=t\n",
+		"level=DEBUG msg=\"Skipped live video\" feed=channel:awesome channel=awesomeChannelId video=vIdLive live=live\n",
+		"level=DEBUG msg=\"Found video\" feed=channel:awesome channel=awesomeChannelId video=vId2 title=t2 published=2006-01-02T15:04:05.000Z\n",
+		"level=DEBUG msg=\"Fetched search results page\" feed=channel:awesome channel=awesomeChannelId results=2 videos=1 nextPage=page2\n",
+		`level=DEBUG msg="Running ffprobe" feed=channel:awesome video=vId1`,
+		fmt.Sprintf("level=INFO msg=\"Writing feed\" feed=channel:awesome file=%s/xmlFile", outputFolder),
+	} {
+		assert.Contains(t, errWriter.String(), expected)
+	}
+}
+
+func TestCmdChannelQuiet(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "unrelated")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, writer, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Int("quotaBudget", 10000, "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	set.Bool("quiet", true, "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "", writer.String())
+	assert.Equal(t, "", errWriter.String())
+}
+
+func TestCmdChannelLogFormatJSON(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("verbose", true, "doc")
+	set.String("logFormat", "json", "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []error(nil), cb.Errors)
+	lines := strings.Split(strings.TrimSpace(errWriter.String()), "\n")
+	require.NotEqual(t, 0, len(lines))
+	for _, line := range lines {
+		entry := map[string]interface{}{}
+		require.Nil(t, json.Unmarshal([]byte(line), &entry), line)
+		assert.Equal(t, "channel:awesome", entry["feed"])
+	}
+}
+
+func TestCmdChannelInvalidLogFormat(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("logFormat", "xml", "doc")
+	err := command.CmdChannel(&runner.Test{})(cli.NewContext(app, set, nil))
+	assert.EqualError(t, err, "invalid log format xml: must be text or json")
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"github.com/guywithnose/runner"
+	"github.com/urfave/cli"
+)
+
+// CmdMerge builds a single rss feed from several sources
+func CmdMerge(cmdBuilder runner.Builder) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return cli.NewExitError("Usage: \"feedTube merge {type:id[:filter]}...\"", 1)
+		}
+
+		err := checkFlags(c)
+		if err != nil {
+			return err
+		}
+
+		config := SourceConfig{
+			Type:    "merge",
+			APIKey:  c.String("apiKey"),
+			After:   c.String("after"),
+			Sources: make([]SourceConfig, 0, c.NArg()),
+			Seasons: c.Bool("seasons"),
+		}
+		for _, argument := range c.Args() {
+			sourceConfig, err := ParseSourceArgument(argument)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+
+			if sourceConfig.Type == "search" {
+				setSearchFlags(c, &sourceConfig)
+			}
+
+			config.Sources = append(config.Sources, sourceConfig)
+		}
+
+		return buildSource(c, cmdBuilder, config)
+	}
+}
+
+// setSearchFlags applies the --days, --limit and --order flags to a search source
+func setSearchFlags(c *cli.Context, config *SourceConfig) {
+	if c.IsSet("days") {
+		config.Days = c.Int("days")
+	}
+
+	if c.IsSet("limit") {
+		config.Limit = c.Int("limit")
+	}
+
+	if c.IsSet("order") {
+		config.Order = c.String("order")
+	}
+}
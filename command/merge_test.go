@@ -0,0 +1,112 @@
+package command_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestCmdMerge(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	responses := getDefaultChannelResponses()
+	for url, response := range getDefaultPlaylistResponses() {
+		responses[url] = response
+	}
+
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	set := getMergeFlagSet(t, outputFolder, "channel:awesome:t2", "playlist:awesome")
+	set.String("overrideDescription", "merged", "doc")
+	set.String("overrideImage", "https://images.com/merged.jpg", "doc")
+	app, _, _ := appWithTestWriters()
+	cb := getBaseRunner()
+	assert.Nil(t, command.CmdMerge(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	xmlLines := strings.Split(string(xmlBytes), "\n")
+	expectedXML := getExpectedChannelXML(xmlLines[8:10])
+	expectedXML[5] = "    <description>merged</description>"
+	expectedXML[11] = "      <url>https://images.com/merged.jpg</url>"
+	expectedXML[13] = `    <itunes:image href="https://images.com/merged.jpg"></itunes:image>`
+	expectedXML[30] = `      <itunes:image href="https://images.com/merged.jpg"></itunes:image>`
+	assert.Equal(t, expectedXML, xmlLines)
+}
+
+func TestCmdMergeSearchFlags(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	searchResponse := getDefaultSearchResponses()["/search?alt=json&key=fakeApiKey&maxResults=50&order=date&part=snippet&q=golang+talks&type=video"]
+	// Only the search the flags ask for is served so any other search fails the run
+	responses := map[string]string{"/search?alt=json&key=fakeApiKey&maxResults=1&order=relevance&part=snippet&q=golang+talks&type=video": searchResponse}
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	set := getMergeFlagSet(t, outputFolder)
+	set.Int("days", 30, "doc")
+	set.Int("limit", 50, "doc")
+	set.String("order", "date", "doc")
+	assert.Nil(t, set.Parse([]string{"--days", "0", "--limit", "1", "--order", "relevance", "search:golang talks"}))
+	app, _, _ := appWithTestWriters()
+	cb := &runner.Test{ExpectedCommands: []*runner.ExpectedCommand{
+		runner.NewExpectedCommand(
+			"",
+			fmt.Sprintf("/usr/bin/youtube-dl -x --audio-format mp3 --audio-quality 0 -o %s/t-vId1.%%\\(ext\\)s https://youtu.be/vId1", outputFolder),
+			"",
+			0,
+		),
+	}}
+	assert.Nil(t, command.CmdMerge(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), "<guid>vId1</guid>")
+	assert.NotContains(t, string(xmlBytes), "<guid>vId2</guid>")
+}
+
+func TestCmdMergeInvalidSource(t *testing.T) {
+	outputFolder := getOutputFolder()
+	set := getMergeFlagSet(t, outputFolder, "awesome")
+	app, _, _ := appWithTestWriters()
+	cb := &runner.Test{}
+	assert.EqualError(t, command.CmdMerge(cb)(cli.NewContext(app, set, nil)), "invalid source awesome: must be in the form type:id[:filter]")
+}
+
+func TestCmdMergeUnknownSourceType(t *testing.T) {
+	outputFolder := getOutputFolder()
+	set := getMergeFlagSet(t, outputFolder, "nope:awesome")
+	app, _, _ := appWithTestWriters()
+	cb := &runner.Test{}
+	assert.EqualError(t, command.CmdMerge(cb)(cli.NewContext(app, set, nil)), "unknown source type: nope")
+}
+
+func TestCmdMergeUsage(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	app, _, _ := appWithTestWriters()
+	assert.EqualError(t, command.CmdMerge(&runner.Test{})(cli.NewContext(app, set, nil)), `Usage: "feedTube merge {type:id[:filter]}..."`)
+}
+
+func getMergeFlagSet(t *testing.T, outputFolder string, sources ...string) *flag.FlagSet {
+	set := flag.NewFlagSet("test", 0)
+	set.String("apiKey", "fakeApiKey", "doc")
+	set.String("outputFolder", outputFolder, "doc")
+	set.String("xmlFile", fmt.Sprintf("%s/xmlFile", outputFolder), "doc")
+	set.String("baseURL", "http://foo.com", "doc")
+	set.String("quality", "0", "doc")
+	assert.Nil(t, set.Parse(sources))
+	return set
+}
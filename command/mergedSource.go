@@ -0,0 +1,106 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type mergedSource struct {
+	sources []Source
+	filters []string
+	seasons bool
+}
+
+func newMergedSource(config SourceConfig) (Source, error) {
+	if len(config.Sources) == 0 {
+		return nil, fmt.Errorf("a merged feed needs at least one source")
+	}
+
+	merged := &mergedSource{
+		sources: make([]Source, 0, len(config.Sources)),
+		filters: make([]string, 0, len(config.Sources)),
+		seasons: config.Seasons,
+	}
+	for _, sourceConfig := range config.Sources {
+		if sourceConfig.APIKey == "" {
+			sourceConfig.APIKey = config.APIKey
+		}
+
+		if sourceConfig.After == "" {
+			sourceConfig.After = config.After
+		}
+
+		sourceConfig.Transports = config.Transports
+		sourceConfig.DryRun = config.DryRun
+		sourceConfig.Logger = config.Logger
+
+		source, err := NewSource(sourceConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		merged.sources = append(merged.sources, source)
+		merged.filters = append(merged.filters, sourceConfig.Filter)
+	}
+
+	return merged, nil
+}
+
+// GetVideos returns the filtered videos from every source, deduplicated by video ID and sorted newest first.
+// The feed metadata comes from the first source.  When seasons are enabled each source is numbered as its own season.
+func (source mergedSource) GetVideos(ctx context.Context) ([]*VideoData, *ChannelInfo, error) {
+	var info *ChannelInfo
+	items := make([]*VideoData, 0)
+	guids := make(map[string]bool)
+	for i, subSource := range source.sources {
+		subItems, subInfo, err := subSource.GetVideos(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if info == nil {
+			info = subInfo
+		}
+
+		for _, item := range filterItems(source.filters[i], subItems) {
+			if guids[item.GUID] {
+				continue
+			}
+
+			guids[item.GUID] = true
+			if source.seasons {
+				item.Season = i + 1
+			}
+
+			items = append(items, item)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].PubDate.After(items[j].PubDate)
+	})
+
+	return items, info, nil
+}
+
+// ParseSourceArgument parses a source in the form type:id[:filter].
+// Searches get the same days, limit and order defaults as the search command.
+func ParseSourceArgument(argument string) (SourceConfig, error) {
+	parts := strings.SplitN(argument, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return SourceConfig{}, fmt.Errorf("invalid source %s: must be in the form type:id[:filter]", argument)
+	}
+
+	config := SourceConfig{Type: parts[0], ID: parts[1]}
+	if config.Type == "search" {
+		config.Days, config.Limit, config.Order = defaultSearchDays, defaultSearchLimit, defaultSearchOrder
+	}
+
+	if len(parts) == 3 {
+		config.Filter = parts[2]
+	}
+
+	return config, nil
+}
@@ -0,0 +1,146 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+var fixtureVideos = map[string][]*command.VideoData{
+	"main": {
+		{GUID: "vId1", Title: "Episode 1", PubDate: time.Date(2007, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{GUID: "vId3", Title: "Vlog", PubDate: time.Date(2008, 1, 2, 15, 4, 5, 0, time.UTC)},
+	},
+	"clips": {
+		{GUID: "vId2", Title: "Episode 2 clip", PubDate: time.Date(2009, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{GUID: "vId1", Title: "Episode 1 reupload", PubDate: time.Date(2007, 1, 2, 15, 4, 5, 0, time.UTC)},
+	},
+}
+
+func init() {
+	command.RegisterSource("fixture", func(config command.SourceConfig) (command.Source, error) {
+		items, ok := fixtureVideos[config.ID]
+		if !ok {
+			return staticSource{err: errors.New("fixture failed")}, nil
+		}
+
+		return staticSource{items: items, info: &command.ChannelInfo{Title: config.ID}}, nil
+	})
+}
+
+func TestMergedSource(t *testing.T) {
+	source, err := command.NewSource(command.SourceConfig{
+		Type: "merge",
+		Sources: []command.SourceConfig{
+			{Type: "fixture", ID: "main", Filter: "Episode"},
+			{Type: "fixture", ID: "clips"},
+		},
+	})
+	assert.Nil(t, err)
+	items, info, err := source.GetVideos(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &command.ChannelInfo{Title: "main"}, info)
+	assert.Equal(t, []*command.VideoData{fixtureVideos["clips"][0], fixtureVideos["main"][0]}, items)
+}
+
+func TestMergedSourceSeasons(t *testing.T) {
+	source, err := command.NewSource(command.SourceConfig{
+		Type:    "merge",
+		Seasons: true,
+		Sources: []command.SourceConfig{{Type: "fixture", ID: "main"}, {Type: "fixture", ID: "clips"}},
+	})
+	assert.Nil(t, err)
+	items, _, err := source.GetVideos(context.Background())
+	assert.Nil(t, err)
+	seasons := map[string]int{}
+	for _, item := range items {
+		seasons[item.GUID] = item.Season
+	}
+
+	assert.Equal(t, map[string]int{"vId1": 1, "vId2": 2, "vId3": 1}, seasons)
+	for _, items := range fixtureVideos {
+		for _, item := range items {
+			item.Season = 0
+		}
+	}
+}
+
+func TestMergedSourceFailure(t *testing.T) {
+	source, err := command.NewSource(command.SourceConfig{
+		Type:    "merge",
+		Sources: []command.SourceConfig{{Type: "fixture", ID: "main"}, {Type: "fixture", ID: "broken"}},
+	})
+	assert.Nil(t, err)
+	_, _, err = source.GetVideos(context.Background())
+	assert.EqualError(t, err, "fixture failed")
+}
+
+func TestMergedSourceNoSources(t *testing.T) {
+	_, err := command.NewSource(command.SourceConfig{Type: "merge"})
+	assert.EqualError(t, err, "a merged feed needs at least one source")
+}
+
+func TestMergedSourceInvalidSource(t *testing.T) {
+	_, err := command.NewSource(command.SourceConfig{Type: "merge", Sources: []command.SourceConfig{{Type: "nope", ID: "main"}}})
+	assert.EqualError(t, err, "unknown source type: nope")
+}
+
+func TestParseSourceArgument(t *testing.T) {
+	config, err := command.ParseSourceArgument("channel:awesome:Episode: 1")
+	assert.Nil(t, err)
+	assert.Equal(t, command.SourceConfig{Type: "channel", ID: "awesome", Filter: "Episode: 1"}, config)
+}
+
+func TestParseSourceArgumentSearch(t *testing.T) {
+	config, err := command.ParseSourceArgument("search:golang talks")
+	assert.Nil(t, err)
+	assert.Equal(t, command.SourceConfig{Type: "search", ID: "golang talks", Days: 30, Limit: 50, Order: "date"}, config)
+}
+
+func TestMergedSourceSearchIsBounded(t *testing.T) {
+	requests := make([]url.Values, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query())
+		// Every page claims there are more results
+		page := youtube.SearchListResponse{NextPageToken: fmt.Sprintf("page%d", len(requests)+1)}
+		for i := 0; i < 50; i++ {
+			page.Items = append(page.Items, &youtube.SearchResult{
+				Snippet: &youtube.SearchResultSnippet{Title: "t", PublishedAt: "2007-01-02T15:04:05Z", LiveBroadcastContent: "none"},
+				Id:      &youtube.ResourceId{VideoId: fmt.Sprintf("vId%d-%d", len(requests), i)},
+			})
+		}
+
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	sourceConfig, err := command.ParseSourceArgument("search:golang talks")
+	require.Nil(t, err)
+	source, err := command.NewSource(command.SourceConfig{Type: "merge", APIKey: "fakeApiKey", Sources: []command.SourceConfig{sourceConfig}})
+	require.Nil(t, err)
+	items, _, err := source.GetVideos(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, 50, len(items))
+	require.Equal(t, 1, len(requests))
+	assert.Equal(t, "50", requests[0].Get("maxResults"))
+	assert.Equal(t, "date", requests[0].Get("order"))
+	publishedAfter, err := time.Parse(time.RFC3339, requests[0].Get("publishedAfter"))
+	require.Nil(t, err)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, -30), publishedAfter, time.Minute)
+}
+
+func TestParseSourceArgumentInvalid(t *testing.T) {
+	_, err := command.ParseSourceArgument("awesome")
+	assert.EqualError(t, err, "invalid source awesome: must be in the form type:id[:filter]")
+}
@@ -0,0 +1,287 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names
+const (
+	MetricAPIRequests      = "feedtube_api_requests_total"
+	MetricQuotaUnits       = "feedtube_api_quota_units_total"
+	MetricDownloads        = "feedtube_downloads_total"
+	MetricDownloadDuration = "feedtube_download_duration_seconds"
+	MetricDownloadedBytes  = "feedtube_downloaded_bytes_total"
+	MetricFfprobeCalls     = "feedtube_ffprobe_calls_total"
+	MetricFeedRebuilds     = "feedtube_feed_rebuilds_total"
+	MetricLastRun          = "feedtube_last_run_timestamp_seconds"
+	MetricLastRunSuccess   = "feedtube_last_run_success"
+)
+
+const (
+	counterMetric   = "counter"
+	gaugeMetric     = "gauge"
+	histogramMetric = "histogram"
+)
+
+type metricDefinition struct {
+	help    string
+	kind    string
+	buckets []float64
+}
+
+var metricDefinitions = map[string]metricDefinition{
+	MetricAPIRequests:      {help: "YouTube API requests sent by method and status code", kind: counterMetric},
+	MetricQuotaUnits:       {help: "YouTube API quota units spent by method", kind: counterMetric},
+	MetricDownloads:        {help: "Video downloads by result", kind: counterMetric},
+	MetricDownloadDuration: {help: "Time spent downloading a video", kind: histogramMetric, buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800}},
+	MetricDownloadedBytes:  {help: "Bytes of audio downloaded", kind: counterMetric},
+	MetricFfprobeCalls:     {help: "ffprobe runs to find audio durations", kind: counterMetric},
+	MetricFeedRebuilds:     {help: "Feed builds by whether the XML changed", kind: counterMetric},
+	MetricLastRun:          {help: "When the last run of a feed finished", kind: gaugeMetric},
+	MetricLastRunSuccess:   {help: "Whether the last run of a feed succeeded", kind: gaugeMetric},
+}
+
+// labelValueEscaper escapes label values the way the Prometheus text format expects, which is not the same as Go quoting
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// DefaultMetrics collects the metrics for the whole process
+var DefaultMetrics = NewMetrics()
+
+// Metrics collects counters, gauges and histograms and writes them in the Prometheus text format
+type Metrics struct {
+	mutex  sync.Mutex
+	series map[string]map[string]*metricSeries
+}
+
+type metricSeries struct {
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics *Metrics
+}
+
+// NewMetrics returns an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{series: make(map[string]map[string]*metricSeries)}
+}
+
+// Add increases the counter name with the given label name and value pairs
+func (metrics *Metrics) Add(name string, value float64, labels ...string) {
+	metrics.update(name, labels, func(series *metricSeries) {
+		series.value += value
+	})
+}
+
+// Set sets the gauge name with the given label name and value pairs
+func (metrics *Metrics) Set(name string, value float64, labels ...string) {
+	metrics.update(name, labels, func(series *metricSeries) {
+		series.value = value
+	})
+}
+
+// Observe records value in the histogram name with the given label name and value pairs
+func (metrics *Metrics) Observe(name string, value float64, labels ...string) {
+	buckets := metricDefinitions[name].buckets
+	metrics.update(name, labels, func(series *metricSeries) {
+		if series.buckets == nil {
+			series.buckets = make([]uint64, len(buckets))
+		}
+
+		for i, bound := range buckets {
+			if value <= bound {
+				series.buckets[i]++
+			}
+		}
+
+		series.value += value
+		series.count++
+	})
+}
+
+func (metrics *Metrics) update(name string, labels []string, update func(series *metricSeries)) {
+	if _, ok := metricDefinitions[name]; !ok {
+		panic(fmt.Sprintf("unknown metric %s", name))
+	}
+
+	key := formatLabels(labels...)
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if metrics.series[name] == nil {
+		metrics.series[name] = make(map[string]*metricSeries)
+	}
+
+	series, ok := metrics.series[name][key]
+	if !ok {
+		series = &metricSeries{}
+		metrics.series[name][key] = series
+	}
+
+	update(series)
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (metrics *Metrics) WriteTo(writer io.Writer) (int64, error) {
+	var out bytes.Buffer
+	metrics.mutex.Lock()
+	names := make([]string, 0, len(metrics.series))
+	for name := range metrics.series {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		definition := metricDefinitions[name]
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s %s\n", name, definition.help, name, definition.kind)
+		keys := make([]string, 0, len(metrics.series[name]))
+		for key := range metrics.series[name] {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeSeries(&out, name, key, definition, metrics.series[name][key])
+		}
+	}
+
+	metrics.mutex.Unlock()
+	written, err := writer.Write(out.Bytes())
+	return int64(written), err
+}
+
+func writeSeries(out io.Writer, name, labels string, definition metricDefinition, series *metricSeries) {
+	if definition.kind != histogramMetric {
+		fmt.Fprintf(out, "%s%s %s\n", name, labels, formatMetricValue(series.value))
+		return
+	}
+
+	for i, bound := range definition.buckets {
+		fmt.Fprintf(out, "%s_bucket%s %d\n", name, addLabel(labels, "le", formatMetricValue(bound)), series.buckets[i])
+	}
+
+	fmt.Fprintf(out, "%s_bucket%s %d\n", name, addLabel(labels, "le", "+Inf"), series.count)
+	fmt.Fprintf(out, "%s_sum%s %s\n", name, labels, formatMetricValue(series.value))
+	fmt.Fprintf(out, "%s_count%s %d\n", name, labels, series.count)
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = metrics.WriteTo(w)
+}
+
+// WriteFile writes the metrics for the node_exporter textfile collector.
+// The file is renamed into place so the collector never reads it half written.
+// Each write has its own temp file since feeds in the daemon that share a file write it at the same time.
+func (metrics *Metrics) WriteFile(fileName string) error {
+	var out bytes.Buffer
+	_, _ = metrics.WriteTo(&out)
+	tempFile, err := ioutil.TempFile(filepath.Dir(fileName), fmt.Sprintf("%s.*.tmp", filepath.Base(fileName)))
+	if err != nil {
+		return fmt.Errorf("could not write metrics: %v", err)
+	}
+
+	err = writeTempFile(tempFile, out.Bytes())
+	if err == nil {
+		err = os.Rename(tempFile.Name(), fileName)
+	}
+
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return fmt.Errorf("could not write metrics: %v", err)
+	}
+
+	return nil
+}
+
+// writeTempFile writes contents to file and closes it.
+// Temp files are only readable by their owner so it is opened up for a collector running as someone else.
+func writeTempFile(file *os.File, contents []byte) error {
+	_, err := file.Write(contents)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Chmod(file.Name(), 0644)
+}
+
+// Transport wraps base so every API request sent is counted
+func (metrics *Metrics) Transport(base http.RoundTripper) http.RoundTripper {
+	return &metricsTransport{base: base, metrics: metrics}
+}
+
+// RoundTrip counts the request and, when a response came back, the quota it cost
+func (transport metricsTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	method := path.Base(request.URL.Path)
+	response, err := transport.base.RoundTrip(request)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(response.StatusCode)
+		transport.metrics.Add(MetricQuotaUnits, float64(quotaCost(method)), "method", method)
+	}
+
+	transport.metrics.Add(MetricAPIRequests, 1, "method", method, "code", code)
+	return response, err
+}
+
+// recordRun sets the last run gauges for the feed in outputFolder
+func (metrics *Metrics) recordRun(outputFolder string, err error) {
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+
+	metrics.Set(MetricLastRun, float64(time.Now().Unix()), "feed", outputFolder)
+	metrics.Set(MetricLastRunSuccess, success, "feed", outputFolder)
+}
+
+func formatLabels(labels ...string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ","))
+}
+
+func addLabel(labels, name, value string) string {
+	label := formatLabels(name, value)
+	if labels == "" {
+		return label
+	}
+
+	return fmt.Sprintf("%s,%s", strings.TrimSuffix(labels, "}"), strings.TrimPrefix(label, "{"))
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,210 @@
+package command_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	metrics := command.NewMetrics()
+	metrics.Add(command.MetricDownloads, 1, "result", "success")
+	metrics.Add(command.MetricDownloads, 2, "result", "success")
+	metrics.Add(command.MetricDownloads, 1, "result", "failure")
+	metrics.Set(command.MetricLastRunSuccess, 1, "feed", `/tmp/"quoted"`)
+	metrics.Observe(command.MetricDownloadDuration, 3)
+	metrics.Observe(command.MetricDownloadDuration, 45.5)
+	var out strings.Builder
+	_, err := metrics.WriteTo(&out)
+	require.Nil(t, err)
+	assert.Equal(
+		t,
+		strings.Join(
+			[]string{
+				"# HELP feedtube_download_duration_seconds Time spent downloading a video",
+				"# TYPE feedtube_download_duration_seconds histogram",
+				`feedtube_download_duration_seconds_bucket{le="1"} 0`,
+				`feedtube_download_duration_seconds_bucket{le="5"} 1`,
+				`feedtube_download_duration_seconds_bucket{le="15"} 1`,
+				`feedtube_download_duration_seconds_bucket{le="30"} 1`,
+				`feedtube_download_duration_seconds_bucket{le="60"} 2`,
+				`feedtube_download_duration_seconds_bucket{le="120"} 2`,
+				`feedtube_download_duration_seconds_bucket{le="300"} 2`,
+				`feedtube_download_duration_seconds_bucket{le="600"} 2`,
+				`feedtube_download_duration_seconds_bucket{le="1800"} 2`,
+				`feedtube_download_duration_seconds_bucket{le="+Inf"} 2`,
+				"feedtube_download_duration_seconds_sum 48.5",
+				"feedtube_download_duration_seconds_count 2",
+				"# HELP feedtube_downloads_total Video downloads by result",
+				"# TYPE feedtube_downloads_total counter",
+				`feedtube_downloads_total{result="failure"} 1`,
+				`feedtube_downloads_total{result="success"} 3`,
+				"# HELP feedtube_last_run_success Whether the last run of a feed succeeded",
+				"# TYPE feedtube_last_run_success gauge",
+				`feedtube_last_run_success{feed="/tmp/\"quoted\""} 1`,
+				"",
+			},
+			"\n",
+		),
+		out.String(),
+	)
+}
+
+func TestMetricsHistogramLabels(t *testing.T) {
+	metrics := command.NewMetrics()
+	metrics.Observe(command.MetricDownloadDuration, 2000, "feed", "a")
+	var out strings.Builder
+	_, err := metrics.WriteTo(&out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), `feedtube_download_duration_seconds_bucket{feed="a",le="1800"} 0`+"\n")
+	assert.Contains(t, out.String(), `feedtube_download_duration_seconds_bucket{feed="a",le="+Inf"} 1`+"\n")
+	assert.Contains(t, out.String(), `feedtube_download_duration_seconds_sum{feed="a"} 2000`+"\n")
+}
+
+func TestMetricsUnknownMetric(t *testing.T) {
+	assert.Panics(t, func() {
+		command.NewMetrics().Add("nope", 1)
+	})
+}
+
+func TestMetricsServeHTTP(t *testing.T) {
+	metrics := command.NewMetrics()
+	metrics.Add(command.MetricFfprobeCalls, 1)
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "feedtube_ffprobe_calls_total 1\n")
+}
+
+func TestMetricsTransport(t *testing.T) {
+	requests := make([]string, 0)
+	ts := getQuotaTestServer(&requests)
+	defer ts.Close()
+	metrics := command.NewMetrics()
+	client := &http.Client{Transport: metrics.Transport(http.DefaultTransport)}
+	for _, method := range []string{"search", "channels", "search"} {
+		response, err := client.Get(fmt.Sprintf("%s/youtube/v3/%s", ts.URL, method))
+		require.Nil(t, err)
+		_ = response.Body.Close()
+	}
+
+	var out strings.Builder
+	_, err := metrics.WriteTo(&out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), `feedtube_api_requests_total{method="search",code="200"} 2`+"\n")
+	assert.Contains(t, out.String(), `feedtube_api_requests_total{method="channels",code="200"} 1`+"\n")
+	assert.Contains(t, out.String(), `feedtube_api_quota_units_total{method="search"} 200`+"\n")
+	assert.Contains(t, out.String(), `feedtube_api_quota_units_total{method="channels"} 1`+"\n")
+}
+
+func TestMetricsTransportError(t *testing.T) {
+	metrics := command.NewMetrics()
+	client := &http.Client{Transport: metrics.Transport(http.DefaultTransport)}
+	_, err := client.Get("http://127.0.0.1:0/youtube/v3/search")
+	require.NotNil(t, err)
+	var out strings.Builder
+	_, err = metrics.WriteTo(&out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), `feedtube_api_requests_total{method="search",code="error"} 1`+"\n")
+	assert.NotContains(t, out.String(), command.MetricQuotaUnits)
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	metrics := command.NewMetrics()
+	metrics.Set(command.MetricLastRunSuccess, 1, "feed", "/feeds/a \"b\"\\c\nd\té")
+	var out strings.Builder
+	_, err := metrics.WriteTo(&out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), `feedtube_last_run_success{feed="/feeds/a \"b\"\\c\nd`+"\t"+`é"} 1`+"\n")
+}
+
+func TestMetricsWriteFileError(t *testing.T) {
+	err := command.NewMetrics().WriteFile("/notadir/feedTube.prom")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not write metrics: open /notadir/feedTube.prom.")
+}
+
+func TestMetricsWriteFileConcurrent(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder)
+	metricsFile := fmt.Sprintf("%s/feedTube.prom", outputFolder)
+	metrics := command.NewMetrics()
+	metrics.Add(command.MetricFfprobeCalls, 1)
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			assert.Nil(t, metrics.WriteFile(metricsFile))
+		}()
+	}
+
+	wait.Wait()
+	assertFileContents(t, metricsFile, "# HELP feedtube_ffprobe_calls_total ffprobe runs to find audio durations\n"+
+		"# TYPE feedtube_ffprobe_calls_total counter\nfeedtube_ffprobe_calls_total 1\n")
+	files, err := ioutil.ReadDir(outputFolder)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, os.FileMode(0644), files[0].Mode())
+}
+
+func TestCmdChannelMetricsFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	command.DefaultMetrics = command.NewMetrics()
+	metricsFile := fmt.Sprintf("%s/feedTube.prom", outputFolder)
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.String("metricsFile", metricsFile, "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := getFfprobeRunner()
+	cb.ExpectedCommands[0].Closure = func(string) {
+		writeOutputFiles(t, outputFolder, "t2-vId2.mp3")
+	}
+	cb.ExpectedCommands = append(
+		cb.ExpectedCommands,
+		runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t2-vId2.mp3", outputFolder), "Duration: 00:13:45.22, start", 0),
+	)
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "", errWriter.String())
+
+	metricsBytes, err := ioutil.ReadFile(metricsFile)
+	require.Nil(t, err)
+	for _, line := range []string{
+		`feedtube_api_requests_total{method="channels",code="200"} 2`,
+		`feedtube_api_requests_total{method="search",code="200"} 2`,
+		`feedtube_api_quota_units_total{method="search"} 200`,
+		`feedtube_downloads_total{result="success"} 1`,
+		"feedtube_download_duration_seconds_count 1",
+		"feedtube_downloaded_bytes_total 7",
+		"feedtube_ffprobe_calls_total 2",
+		`feedtube_feed_rebuilds_total{changed="true"} 1`,
+		fmt.Sprintf(`feedtube_last_run_success{feed="%s"} 1`, outputFolder),
+	} {
+		assert.Contains(t, string(metricsBytes), line+"\n")
+	}
+
+	files, err := ioutil.ReadDir(outputFolder)
+	require.Nil(t, err)
+	for _, file := range files {
+		assert.False(t, strings.HasSuffix(file.Name(), ".tmp"), file.Name())
+	}
+}
@@ -0,0 +1,363 @@
+package command
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	mp4HeaderSize   = 8
+	mp4DataTypeText = 1
+	mp4DataTypeJPEG = 13
+	mp4DataTypePNG  = 14
+)
+
+// mp4Containers are the atoms that need to be walked to reach the chunk offsets and the iTunes metadata
+var mp4Containers = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+	"udta": true,
+	"meta": true,
+	"ilst": true,
+}
+
+type mp4Atom struct {
+	kind     string
+	offset   int64
+	size     int64
+	data     []byte
+	children []*mp4Atom
+}
+
+// writeMP4File copies in to out with the iTunes metadata in the moov atom replaced by tags.
+// Any chunk offsets that point past the moov atom are shifted by the change in its size.
+func writeMP4File(in *os.File, out *os.File, tags Tags) error {
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	atoms, err := readMP4TopLevelAtoms(in, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	var moov *mp4Atom
+	for _, atom := range atoms {
+		if atom.kind == "moov" {
+			moov = atom
+		}
+	}
+
+	if moov == nil {
+		return fmt.Errorf("no moov atom found")
+	}
+
+	moovBytes, err := rebuildMP4Moov(in, moov, tags)
+	if err != nil {
+		return err
+	}
+
+	for _, atom := range atoms {
+		if atom == moov {
+			_, err = out.Write(moovBytes)
+		} else {
+			_, err = io.Copy(out, io.NewSectionReader(in, atom.offset, atom.size))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func rebuildMP4Moov(in io.ReaderAt, moov *mp4Atom, tags Tags) ([]byte, error) {
+	moovData := make([]byte, moov.size)
+	_, err := in.ReadAt(moovData, moov.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseMP4Atoms(moovData)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed[0].children = setMP4Tags(parsed[0].children, tags)
+	encoded, err := encodeMP4Atom(parsed[0])
+	if err != nil {
+		return nil, err
+	}
+
+	delta := int64(len(encoded)) - moov.size
+	if delta != 0 {
+		err = shiftMP4ChunkOffsets(parsed[0], moov.offset+moov.size, delta)
+		if err != nil {
+			return nil, err
+		}
+
+		encoded, err = encodeMP4Atom(parsed[0])
+	}
+
+	return encoded, err
+}
+
+func readMP4TopLevelAtoms(in io.ReaderAt, fileSize int64) ([]*mp4Atom, error) {
+	atoms := make([]*mp4Atom, 0)
+	for offset := int64(0); offset < fileSize; {
+		header := make([]byte, 16)
+		n, err := in.ReadAt(header, offset)
+		if n < mp4HeaderSize {
+			return nil, fmt.Errorf("truncated atom at offset %d: %v", offset, err)
+		}
+
+		size, headerSize := int64(binary.BigEndian.Uint32(header)), int64(mp4HeaderSize)
+		switch {
+		case size == 1 && n == len(header):
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:])), 16
+		case size == 0:
+			size = fileSize - offset
+		}
+
+		if size < headerSize || offset+size > fileSize {
+			return nil, fmt.Errorf("invalid %s atom size at offset %d", header[4:8], offset)
+		}
+
+		atoms = append(atoms, &mp4Atom{kind: string(header[4:8]), offset: offset, size: size})
+		offset += size
+	}
+
+	return atoms, nil
+}
+
+func parseMP4Atoms(data []byte) ([]*mp4Atom, error) {
+	atoms := make([]*mp4Atom, 0)
+	for len(data) > 0 {
+		if len(data) < mp4HeaderSize {
+			return nil, fmt.Errorf("truncated atom")
+		}
+
+		size, headerSize := uint64(binary.BigEndian.Uint32(data)), uint64(mp4HeaderSize)
+		switch {
+		case size == 1 && len(data) >= 16:
+			size, headerSize = binary.BigEndian.Uint64(data[8:]), 16
+		case size == 0:
+			size = uint64(len(data))
+		}
+
+		if size < headerSize || size > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid %s atom size", data[4:8])
+		}
+
+		atom := &mp4Atom{kind: string(data[4:8]), data: data[headerSize:size]}
+		if mp4Containers[atom.kind] {
+			err := parseMP4Children(atom)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		atoms = append(atoms, atom)
+		data = data[size:]
+	}
+
+	return atoms, nil
+}
+
+func parseMP4Children(atom *mp4Atom) error {
+	payload := atom.data
+	atom.data = nil
+	// The ISO meta atom has a version and flags before its children, the QuickTime one goes straight to its hdlr
+	if atom.kind == "meta" && !(len(payload) >= 8 && string(payload[4:8]) == "hdlr") {
+		if len(payload) < 4 {
+			return fmt.Errorf("truncated meta atom")
+		}
+
+		atom.data, payload = payload[:4], payload[4:]
+	}
+
+	var err error
+	atom.children, err = parseMP4Atoms(payload)
+	return err
+}
+
+func encodeMP4Atom(atom *mp4Atom) ([]byte, error) {
+	payload := bytes.NewBuffer(append([]byte{}, atom.data...))
+	for _, child := range atom.children {
+		encoded, err := encodeMP4Atom(child)
+		if err != nil {
+			return nil, err
+		}
+
+		payload.Write(encoded)
+	}
+
+	size := mp4HeaderSize + payload.Len()
+	if int64(size) > math.MaxUint32 {
+		return nil, fmt.Errorf("%s atom is too large", atom.kind)
+	}
+
+	encoded := make([]byte, mp4HeaderSize, size)
+	binary.BigEndian.PutUint32(encoded, uint32(size))
+	copy(encoded[4:], atom.kind)
+	return append(encoded, payload.Bytes()...), nil
+}
+
+// setMP4Tags replaces the tagged items in moov/udta/meta/ilst, creating any atoms that are missing
+func setMP4Tags(moovChildren []*mp4Atom, tags Tags) []*mp4Atom {
+	var udta, meta, ilst *mp4Atom
+	moovChildren, udta = findOrAddMP4Atom(moovChildren, "udta")
+	udta.children, meta = findOrAddMP4Atom(udta.children, "meta")
+	if meta.data == nil && len(meta.children) == 0 {
+		meta.data = []byte{0, 0, 0, 0}
+		meta.children = []*mp4Atom{{kind: "hdlr", data: mp4MetadataHandler()}}
+	}
+
+	meta.children, ilst = findOrAddMP4Atom(meta.children, "ilst")
+	items := mp4Items(tags)
+	kept := make([]*mp4Atom, 0, len(ilst.children)+len(items))
+	for _, child := range ilst.children {
+		if findMP4Atom(items, child.kind) == nil {
+			kept = append(kept, child)
+		}
+	}
+
+	ilst.children = append(kept, items...)
+	return moovChildren
+}
+
+func findMP4Atom(atoms []*mp4Atom, kind string) *mp4Atom {
+	for _, atom := range atoms {
+		if atom.kind == kind {
+			return atom
+		}
+	}
+
+	return nil
+}
+
+func findOrAddMP4Atom(atoms []*mp4Atom, kind string) ([]*mp4Atom, *mp4Atom) {
+	atom := findMP4Atom(atoms, kind)
+	if atom != nil {
+		return atoms, atom
+	}
+
+	atom = &mp4Atom{kind: kind}
+	return append(atoms, atom), atom
+}
+
+// mp4MetadataHandler is the hdlr payload that marks a meta atom as holding iTunes metadata
+func mp4MetadataHandler() []byte {
+	handler := make([]byte, 0, 25)
+	handler = append(handler, 0, 0, 0, 0, 0, 0, 0, 0)
+	handler = append(handler, "mdirappl"...)
+	return append(handler, make([]byte, 9)...)
+}
+
+func mp4Items(tags Tags) []*mp4Atom {
+	items := make([]*mp4Atom, 0, 7)
+	items = appendMP4TextItem(items, "\xa9nam", tags.Title)
+	items = appendMP4TextItem(items, "\xa9ART", tags.Artist)
+	items = appendMP4TextItem(items, "\xa9alb", tags.Album)
+	if !tags.Date.IsZero() {
+		items = appendMP4TextItem(items, "\xa9day", tags.Date.UTC().Format("2006-01-02"))
+	}
+
+	if tags.Track > 0 && tags.Track <= math.MaxUint16 {
+		// trkn holds padding, the track number, the total track count and more padding
+		track := []byte{0, 0, byte(tags.Track >> 8), byte(tags.Track), 0, 0, 0, 0}
+		items = append(items, newMP4Item("trkn", 0, track))
+	}
+
+	items = appendMP4TextItem(items, "\xa9cmt", tags.Comment)
+	if len(tags.Artwork) != 0 {
+		dataType := uint32(mp4DataTypeJPEG)
+		if tags.ArtworkMIME == "image/png" {
+			dataType = mp4DataTypePNG
+		}
+
+		items = append(items, newMP4Item("covr", dataType, tags.Artwork))
+	}
+
+	return items
+}
+
+func appendMP4TextItem(items []*mp4Atom, kind, text string) []*mp4Atom {
+	if text == "" {
+		return items
+	}
+
+	return append(items, newMP4Item(kind, mp4DataTypeText, []byte(text)))
+}
+
+func newMP4Item(kind string, dataType uint32, value []byte) *mp4Atom {
+	// The data atom starts with its type and a locale of 0
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(data, dataType)
+	return &mp4Atom{kind: kind, children: []*mp4Atom{{kind: "data", data: append(data, value...)}}}
+}
+
+// shiftMP4ChunkOffsets moves every chunk offset at or past threshold by delta
+func shiftMP4ChunkOffsets(atom *mp4Atom, threshold, delta int64) error {
+	switch atom.kind {
+	case "stco":
+		return shiftMP4Offsets(atom, 4, threshold, delta)
+	case "co64":
+		return shiftMP4Offsets(atom, 8, threshold, delta)
+	}
+
+	for _, child := range atom.children {
+		err := shiftMP4ChunkOffsets(child, threshold, delta)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func shiftMP4Offsets(atom *mp4Atom, width int, threshold, delta int64) error {
+	if len(atom.data) < 8 {
+		return fmt.Errorf("truncated %s atom", atom.kind)
+	}
+
+	data := append([]byte{}, atom.data...)
+	count := int(binary.BigEndian.Uint32(data[4:8]))
+	if len(data) < 8+count*width {
+		return fmt.Errorf("truncated %s atom", atom.kind)
+	}
+
+	for i := 0; i < count; i++ {
+		entry := data[8+i*width : 8+(i+1)*width]
+		if width == 4 {
+			offset := int64(binary.BigEndian.Uint32(entry))
+			if offset < threshold {
+				continue
+			}
+
+			if offset+delta > math.MaxUint32 {
+				return fmt.Errorf("chunk offset overflow in %s atom", atom.kind)
+			}
+
+			binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+			continue
+		}
+
+		offset := int64(binary.BigEndian.Uint64(entry))
+		if offset >= threshold {
+			binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+		}
+	}
+
+	atom.data = data
+	return nil
+}
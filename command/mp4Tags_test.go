@@ -0,0 +1,142 @@
+package command
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTagsM4A(t *testing.T) {
+	fileName := writeFixture(t, "fixture.m4a", getM4AFixture(nil, true))
+	defer removeFile(t, fileName)
+	assert.Nil(t, WriteTags(fileName, getTestTags()))
+	moov, audio := readM4AFile(t, fileName)
+	ilst := findMP4Path(t, moov, "udta", "meta", "ilst")
+	assert.Equal(
+		t,
+		[]string{"\xa9nam", "\xa9ART", "\xa9alb", "\xa9day", "trkn", "\xa9cmt", "covr"},
+		getMP4Kinds(ilst.children),
+	)
+	assert.Equal(t, "\x00\x00\x00\x01\x00\x00\x00\x00t", string(ilst.children[0].data[mp4HeaderSize:]))
+	assert.Equal(t, "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00", string(ilst.children[4].data[mp4HeaderSize:]))
+	assert.Equal(t, "\x00\x00\x00\x0e\x00\x00\x00\x00artwork", string(ilst.children[6].data[mp4HeaderSize:]))
+	assert.Equal(t, []string{"hdlr", "ilst"}, getMP4Kinds(findMP4Path(t, moov, "udta", "meta").children))
+	assert.Equal(t, "audio", audio)
+}
+
+func TestWriteTagsM4AKeepsOtherItems(t *testing.T) {
+	existingTitle := newMP4Item("\xa9nam", mp4DataTypeText, []byte("old"))
+	encoder := newMP4Item("\xa9too", mp4DataTypeText, []byte("Lavf"))
+	udta := &mp4Atom{
+		kind: "udta",
+		children: []*mp4Atom{
+			{
+				kind:     "meta",
+				data:     []byte{0, 0, 0, 0},
+				children: []*mp4Atom{{kind: "hdlr", data: mp4MetadataHandler()}, {kind: "ilst", children: []*mp4Atom{existingTitle, encoder}}},
+			},
+		},
+	}
+	fileName := writeFixture(t, "fixture.m4a", getM4AFixture(udta, true))
+	defer removeFile(t, fileName)
+	assert.Nil(t, WriteTags(fileName, Tags{Title: "t"}))
+	moov, audio := readM4AFile(t, fileName)
+	ilst := findMP4Path(t, moov, "udta", "meta", "ilst")
+	assert.Equal(t, []string{"\xa9too", "\xa9nam"}, getMP4Kinds(ilst.children))
+	assert.Equal(t, "\x00\x00\x00\x01\x00\x00\x00\x00t", string(ilst.children[1].data[mp4HeaderSize:]))
+	assert.Equal(t, "audio", audio)
+}
+
+func TestWriteTagsM4AMoovAtEnd(t *testing.T) {
+	fileName := writeFixture(t, "fixture.m4a", getM4AFixture(nil, false))
+	defer removeFile(t, fileName)
+	assert.Nil(t, WriteTags(fileName, getTestTags()))
+	_, audio := readM4AFile(t, fileName)
+	assert.Equal(t, "audio", audio)
+}
+
+func TestWriteTagsM4ANoMoov(t *testing.T) {
+	fileName := writeFixture(t, "fixture.m4a", []byte("\x00\x00\x00\x0dmdataudio"))
+	defer removeFile(t, fileName)
+	assert.EqualError(t, WriteTags(fileName, Tags{}), "could not tag /tmp/fixture.m4a: no moov atom found")
+}
+
+func TestWriteTagsM4AInvalidAtom(t *testing.T) {
+	fileName := writeFixture(t, "fixture.m4a", []byte("\x00\x00\x00\xffmdataudio"))
+	defer removeFile(t, fileName)
+	assert.EqualError(t, WriteTags(fileName, Tags{}), "could not tag /tmp/fixture.m4a: invalid mdat atom size at offset 0")
+}
+
+// getM4AFixture builds a minimal m4a with a single chunk whose offset points at "audio" in the mdat atom
+func getM4AFixture(udta *mp4Atom, moovFirst bool) []byte {
+	ftyp := encodeTestMP4Atom(&mp4Atom{kind: "ftyp", data: []byte("M4A \x00\x00\x00\x00M4A isom")})
+	stco := &mp4Atom{kind: "stco", data: []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}}
+	moov := &mp4Atom{
+		kind: "moov",
+		children: []*mp4Atom{
+			{kind: "mvhd", data: make([]byte, 100)},
+			{
+				kind: "trak",
+				children: []*mp4Atom{
+					{kind: "mdia", children: []*mp4Atom{{kind: "minf", children: []*mp4Atom{{kind: "stbl", children: []*mp4Atom{stco}}}}}},
+				},
+			},
+		},
+	}
+	if udta != nil {
+		moov.children = append(moov.children, udta)
+	}
+
+	mdat := encodeTestMP4Atom(&mp4Atom{kind: "mdat", data: []byte("audio")})
+	chunkOffset := len(ftyp) + mp4HeaderSize
+	if moovFirst {
+		chunkOffset += len(encodeTestMP4Atom(moov))
+	}
+
+	binary.BigEndian.PutUint32(stco.data[8:], uint32(chunkOffset))
+	if moovFirst {
+		return append(append(ftyp, encodeTestMP4Atom(moov)...), mdat...)
+	}
+
+	return append(append(ftyp, mdat...), encodeTestMP4Atom(moov)...)
+}
+
+func encodeTestMP4Atom(atom *mp4Atom) []byte {
+	encoded, _ := encodeMP4Atom(atom)
+	return encoded
+}
+
+// readM4AFile returns the parsed moov atom and the audio its chunk offset points at
+func readM4AFile(t *testing.T, fileName string) (*mp4Atom, string) {
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	atoms, err := parseMP4Atoms(contents)
+	assert.Nil(t, err)
+	assert.Equal(t, "ftyp", atoms[0].kind)
+	moov := findMP4Atom(atoms, "moov")
+	stco := findMP4Path(t, moov, "trak", "mdia", "minf", "stbl", "stco")
+	chunkOffset := binary.BigEndian.Uint32(stco.data[8:])
+	return moov, string(contents[chunkOffset : chunkOffset+5])
+}
+
+func findMP4Path(t *testing.T, atom *mp4Atom, kinds ...string) *mp4Atom {
+	for _, kind := range kinds {
+		atom = findMP4Atom(atom.children, kind)
+		if !assert.NotNil(t, atom, kind) {
+			t.FailNow()
+		}
+	}
+
+	return atom
+}
+
+func getMP4Kinds(atoms []*mp4Atom) []string {
+	kinds := make([]string, 0, len(atoms))
+	for _, atom := range atoms {
+		kinds = append(kinds, atom.kind)
+	}
+
+	return kinds
+}
@@ -7,26 +7,5 @@ import (
 
 // CmdPlaylist builds an rss feed from a youtube playlist
 func CmdPlaylist(cmdBuilder runner.Builder) func(c *cli.Context) error {
-	return func(c *cli.Context) error {
-		if c.NArg() != 1 {
-			return cli.NewExitError("Usage: \"feedTube playlist {playlistID}\"", 1)
-		}
-
-		err := checkFlags(c)
-		if err != nil {
-			return err
-		}
-
-		playlistID := c.Args().Get(0)
-		items, playlistInfo, err := NewPlaylistScraper(c.String("apiKey")).GetVideosForPlaylist(playlistID)
-		if err != nil {
-			return err
-		}
-
-		if c.String("overrideTitle") != "" {
-			playlistInfo.Title = c.String("overrideTitle")
-		}
-
-		return Build(c, cmdBuilder, items, playlistInfo)
-	}
+	return CmdSource("playlist", "Usage: \"feedTube playlist {playlistID}\"", cmdBuilder)
 }
@@ -3,26 +3,30 @@ package command
 import (
 	"context"
 	"fmt"
-	"strings"
+	"log/slog"
 	"time"
 
 	youtube "google.golang.org/api/youtube/v3"
-
-	"github.com/kennygrant/sanitize"
 )
 
 // PlaylistScraper retrieves data about youtube videos
 type PlaylistScraper struct {
 	youtubeService *youtube.Service
+	logger         *slog.Logger
 }
 
 // NewPlaylistScraper returns a YoutubeScraper
-func NewPlaylistScraper(apiKey string) *PlaylistScraper {
-	youtubeService := getYoutubeService(apiKey)
-	return &PlaylistScraper{youtubeService: youtubeService}
+func NewPlaylistScraper(apiKey string, wrappers ...TransportWrapper) *PlaylistScraper {
+	youtubeService := getYoutubeService(apiKey, wrappers...)
+	return &PlaylistScraper{youtubeService: youtubeService, logger: discardLogger}
+}
+
+// SetLogger sets the logger for the playlist and the videos found in it
+func (scraper *PlaylistScraper) SetLogger(logger *slog.Logger) {
+	scraper.logger = logger
 }
 
-func parsePlaylistItems(results []*youtube.PlaylistItem) ([]*VideoData, error) {
+func parsePlaylistItems(logger *slog.Logger, results []*youtube.PlaylistItem) ([]*VideoData, error) {
 	items := make([]*VideoData, 0, len(results))
 	for _, result := range results {
 		publishedTime, err := time.Parse(time.RFC3339, result.Snippet.PublishedAt)
@@ -30,40 +34,61 @@ func parsePlaylistItems(results []*youtube.PlaylistItem) ([]*VideoData, error) {
 			return nil, fmt.Errorf("error parsing publish date on video %s: %v", result.Snippet.ResourceId.VideoId, err)
 		}
 
-		item := &VideoData{
-			GUID:        result.Snippet.ResourceId.VideoId,
-			Link:        fmt.Sprintf("https://youtu.be/%s", result.Snippet.ResourceId.VideoId),
-			Title:       result.Snippet.Title,
-			Description: fmt.Sprintf("%s https://youtu.be/%s", result.Snippet.Description, result.Snippet.ResourceId.VideoId),
-			FileName:    fmt.Sprintf("%s-%s", strings.Replace(sanitize.BaseName(result.Snippet.Title), " ", "-", -1), result.Snippet.ResourceId.VideoId),
-			PubDate:     publishedTime,
-		}
-
-		if result.Snippet.Thumbnails != nil && result.Snippet.Thumbnails.Default != nil {
-			item.Image = result.Snippet.Thumbnails.Default.Url
-		}
-
+		item := newVideoData(
+			result.Snippet.ResourceId.VideoId,
+			result.Snippet.Title,
+			result.Snippet.ChannelTitle,
+			result.Snippet.Description,
+			publishedTime,
+			result.Snippet.Thumbnails,
+		)
+		item.Episode = int(result.Snippet.Position) + 1
+		logger.Debug("Found video", "video", item.GUID, "title", item.Title, "position", item.Episode)
 		items = append(items, item)
 	}
 
 	return items, nil
 }
 
+type playlistSource struct {
+	scraper    *PlaylistScraper
+	playlistID string
+}
+
+func newPlaylistSource(config SourceConfig) (Source, error) {
+	scraper := NewPlaylistScraper(config.APIKey, config.Transports...)
+	scraper.SetLogger(sourceLogger(config))
+	return &playlistSource{scraper: scraper, playlistID: config.ID}, nil
+}
+
+// GetVideos returns the videos in the playlist
+func (source playlistSource) GetVideos(ctx context.Context) ([]*VideoData, *ChannelInfo, error) {
+	return source.scraper.GetVideosForPlaylistWithContext(ctx, source.playlistID)
+}
+
 // GetVideosForPlaylist returns an array of all the youtube video ids in a playlist
 func (scraper PlaylistScraper) GetVideosForPlaylist(playlistID string) ([]*VideoData, *ChannelInfo, error) {
-	info, err := scraper.getPlaylistInfo(playlistID)
+	return scraper.GetVideosForPlaylistWithContext(context.Background(), playlistID)
+}
+
+// GetVideosForPlaylistWithContext returns an array of all the youtube video ids in a playlist using ctx for all requests
+func (scraper PlaylistScraper) GetVideosForPlaylistWithContext(ctx context.Context, playlistID string) ([]*VideoData, *ChannelInfo, error) {
+	info, err := scraper.getPlaylistInfo(ctx, playlistID)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	logger := scraper.logger.With("playlist", playlistID)
+	logger.Debug("Found playlist", "title", info.Title)
 	items := make([]*VideoData, 0)
 	listCall := scraper.youtubeService.PlaylistItems.List("snippet").PlaylistId(playlistID)
-	err = listCall.Pages(context.Background(), func(resp *youtube.PlaylistItemListResponse) error {
-		videoPage, pageErr := parsePlaylistItems(resp.Items)
+	err = listCall.Pages(ctx, func(resp *youtube.PlaylistItemListResponse) error {
+		videoPage, pageErr := parsePlaylistItems(logger, resp.Items)
 		if pageErr != nil {
 			return pageErr
 		}
 
+		logger.Debug("Fetched playlist page", "videos", len(videoPage), "nextPage", resp.NextPageToken)
 		items = append(items, videoPage...)
 		return nil
 	})
@@ -75,8 +100,8 @@ func (scraper PlaylistScraper) GetVideosForPlaylist(playlistID string) ([]*Video
 	return items, info, nil
 }
 
-func (scraper PlaylistScraper) getPlaylistInfo(playlistID string) (*ChannelInfo, error) {
-	listCall := scraper.youtubeService.Playlists.List("snippet").Id(playlistID)
+func (scraper PlaylistScraper) getPlaylistInfo(ctx context.Context, playlistID string) (*ChannelInfo, error) {
+	listCall := scraper.youtubeService.Playlists.List("snippet").Id(playlistID).Context(ctx)
 	resp, err := listCall.Do()
 	if err != nil {
 		return nil, fmt.Errorf("Playlist request failed: %v", err)
@@ -90,9 +115,7 @@ func (scraper PlaylistScraper) getPlaylistInfo(playlistID string) (*ChannelInfo,
 		Title:       resp.Items[0].Snippet.Title,
 		Link:        fmt.Sprintf("https://www.youtube.com/playlist?list=%s", playlistID),
 		Description: resp.Items[0].Snippet.Description,
-	}
-	if resp.Items[0].Snippet.Thumbnails != nil && resp.Items[0].Snippet.Thumbnails.Default != nil {
-		feed.Thumbnail = resp.Items[0].Snippet.Thumbnails.Default.Url
+		Thumbnail:   bestThumbnail(resp.Items[0].Snippet.Thumbnails),
 	}
 	return feed, nil
 }
@@ -1,7 +1,9 @@
 package command_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"log/slog"
 	"net/http/httptest"
 	"testing"
 
@@ -9,6 +11,7 @@ import (
 
 	"github.com/guywithnose/feedTube/command"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetVideosForPlaylist(t *testing.T) {
@@ -17,10 +20,30 @@ func TestGetVideosForPlaylist(t *testing.T) {
 	command.YoutubeAPIURLBase = ts.URL
 	videoData, channelInfo, err := command.NewPlaylistScraper("fakeApiKey").GetVideosForPlaylist("awesome")
 	assert.Nil(t, err)
-	assert.Equal(t, []*command.VideoData{&videoData1, &videoData2}, videoData)
+	expectedVideoData1 := videoData1
+	expectedVideoData1.Episode = 1
+	expectedVideoData2 := videoData2
+	expectedVideoData2.Episode = 2
+	assert.Equal(t, []*command.VideoData{&expectedVideoData1, &expectedVideoData2}, videoData)
 	assert.Equal(t, &awesomePlaylistInfo, channelInfo)
 }
 
+func TestGetVideosForPlaylistLogger(t *testing.T) {
+	ts := getTestServer(getDefaultPlaylistResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	var out bytes.Buffer
+	logger, err := command.NewLogger(&out, "text", slog.LevelDebug)
+	require.Nil(t, err)
+	scraper := command.NewPlaylistScraper("fakeApiKey")
+	scraper.SetLogger(logger)
+	_, _, err = scraper.GetVideosForPlaylist("awesome")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"Found video\" playlist=awesome video=vId1 title=t position=1\n")
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"Found video\" playlist=awesome video=vId2 title=t2 position=2\n")
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"Fetched playlist page\" playlist=awesome videos=")
+}
+
 func TestPlaylistRequestFailure(t *testing.T) {
 	ts := getTestPlaylistServerOverrideResponse("/playlists?alt=json&id=awesome&key=fakeApiKey&part=snippet")
 	defer ts.Close()
@@ -160,6 +183,7 @@ func getDefaultPlaylistResponses() map[string]string {
 					Title:       "t2",
 					Description: "d2",
 					PublishedAt: "2006-01-02T15:04:05Z",
+					Position:    1,
 					ResourceId: &youtube.ResourceId{
 						VideoId: "vId2",
 					},
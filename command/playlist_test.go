@@ -51,6 +51,32 @@ func TestCmdPlaylist(t *testing.T) {
 	assert.Equal(t, getExpectedPlaylistXML(xmlLines[8:10]), xmlLines)
 }
 
+func TestCmdPlaylistSerial(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	ts := getTestServer(getDefaultPlaylistResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("serial", true, "doc")
+	cb := getBaseRunner()
+	assert.Nil(t, command.CmdPlaylist(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	xmlLines := strings.Split(string(xmlBytes), "\n")
+	expectedXML := getExpectedPlaylistXML(xmlLines[8:10])
+	expectedXML[19] = `      <pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate>`
+	expectedXML[28] = `      <pubDate>Mon, 02 Jan 2006 15:05:05 +0000</pubDate>`
+	expectedXML = append(expectedXML[:31], append([]string{`      <itunes:episode>2</itunes:episode>`}, expectedXML[31:]...)...)
+	expectedXML = append(expectedXML[:22], append([]string{`      <itunes:episode>1</itunes:episode>`}, expectedXML[22:]...)...)
+	expectedXML = append(expectedXML[:14], append([]string{`    <itunes:type>serial</itunes:type>`}, expectedXML[14:]...)...)
+	assert.Equal(t, expectedXML, xmlLines)
+}
+
 func TestCmdPlaylistDownloadFailure(t *testing.T) {
 	outputFolder := getOutputFolder()
 	defer removeFile(t, outputFolder)
@@ -0,0 +1,270 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	searchQuotaCost  = 100
+	listQuotaCost    = 1
+	quotaDateFormat  = "2006-01-02"
+	quotaResetZoneID = "America/Los_Angeles"
+)
+
+// QuotaTracker tallies the YouTube API quota used by the requests it sees.
+// The daily total is kept in a state file so every run on the same day counts against one budget.
+// Charges lock the state file, so runs and daemon feeds sharing it never lose each other's units.
+type QuotaTracker struct {
+	stateFile string
+	budget    int
+	dryRun    bool
+	mutex     sync.Mutex
+	used      map[string]int
+}
+
+// QuotaExceededError is returned instead of sending a call that would go over the budget.  Retrying it can't help.
+type QuotaExceededError struct {
+	Method string
+	Cost   int
+	Used   int
+	Budget int
+}
+
+func (err QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota budget exceeded: %s costs %d units and %d of %d are used", err.Method, err.Cost, err.Used, err.Budget)
+}
+
+type quotaState struct {
+	Date string `json:"date"`
+	Used int    `json:"used"`
+}
+
+type quotaTransport struct {
+	base    http.RoundTripper
+	tracker *QuotaTracker
+}
+
+// NewQuotaTracker returns a QuotaTracker.  An empty stateFile only counts this run and a budget of 0 is unlimited.
+func NewQuotaTracker(stateFile string, budget int) *QuotaTracker {
+	return &QuotaTracker{stateFile: stateFile, budget: budget, used: map[string]int{}}
+}
+
+// SetDryRun keeps the tracker from writing the state file.  The budget still counts the daily total plus this run.
+func (tracker *QuotaTracker) SetDryRun(dryRun bool) {
+	tracker.dryRun = dryRun
+}
+
+// Transport wraps base so each request is charged before it is sent
+func (tracker *QuotaTracker) Transport(base http.RoundTripper) http.RoundTripper {
+	return &quotaTransport{base: base, tracker: tracker}
+}
+
+// RoundTrip refuses requests that would go over the budget
+func (transport quotaTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	err := transport.tracker.charge(path.Base(request.URL.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	return transport.base.RoundTrip(request)
+}
+
+// Used returns the units used by this run
+func (tracker *QuotaTracker) Used() int {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	total := 0
+	for _, units := range tracker.used {
+		total += units
+	}
+
+	return total
+}
+
+// Summary describes the units used by this run per method along with the daily total
+func (tracker *QuotaTracker) Summary() string {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	used := 0
+	methods := make([]string, 0, len(tracker.used))
+	for method, units := range tracker.used {
+		used += units
+		methods = append(methods, fmt.Sprintf("%s: %d", method, units))
+	}
+
+	sort.Strings(methods)
+	summary := fmt.Sprintf("Quota used: %d units", used)
+	if len(methods) != 0 {
+		summary = fmt.Sprintf("%s (%s)", summary, strings.Join(methods, ", "))
+	}
+
+	if tracker.stateFile != "" {
+		// The summary is best effort so an unreadable state file just leaves the daily total out
+		state, err := tracker.loadState()
+		if err == nil {
+			summary = fmt.Sprintf("%s, %d today", summary, state.Used)
+		}
+	}
+
+	if tracker.budget != 0 {
+		summary = fmt.Sprintf("%s, budget %d", summary, tracker.budget)
+	}
+
+	return summary
+}
+
+func (tracker *QuotaTracker) charge(method string) error {
+	cost := quotaCost(method)
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	unlock, err := tracker.lockState()
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+	state, err := tracker.currentState()
+	if err != nil {
+		return err
+	}
+
+	if tracker.budget != 0 && state.Used+cost > tracker.budget {
+		return QuotaExceededError{Method: method, Cost: cost, Used: state.Used, Budget: tracker.budget}
+	}
+
+	tracker.used[method] += cost
+	state.Used += cost
+	if tracker.stateFile == "" || tracker.dryRun {
+		return nil
+	}
+
+	return tracker.saveState(state)
+}
+
+// lockState locks the state file when it is going to be written and returns the function that unlocks it
+func (tracker *QuotaTracker) lockState() (func(), error) {
+	if tracker.stateFile == "" || tracker.dryRun {
+		return func() {}, nil
+	}
+
+	return lockStateFile(tracker.stateFile)
+}
+
+// currentState returns the units used today.  Without a state file that is only this run.
+func (tracker *QuotaTracker) currentState() (*quotaState, error) {
+	state := &quotaState{Date: quotaDay()}
+	for _, units := range tracker.used {
+		state.Used += units
+	}
+
+	if tracker.stateFile == "" {
+		return state, nil
+	}
+
+	saved, err := tracker.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	if tracker.dryRun {
+		// This run's units are never saved so they are added to the saved total
+		saved.Used += state.Used
+	}
+
+	return saved, nil
+}
+
+// loadState reads the daily total, starting over once the quota has reset
+func (tracker *QuotaTracker) loadState() (*quotaState, error) {
+	state := &quotaState{}
+	stateBytes, err := ioutil.ReadFile(tracker.stateFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read quota state: %v", err)
+	}
+
+	if err == nil {
+		err = json.Unmarshal(stateBytes, state)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse quota state %s: %v", tracker.stateFile, err)
+		}
+	}
+
+	if state.Date != quotaDay() {
+		state = &quotaState{Date: quotaDay()}
+	}
+
+	return state, nil
+}
+
+// saveState renames the new total into place so a run reading the state never sees it half written
+func (tracker *QuotaTracker) saveState(state *quotaState) error {
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tempFileName := fmt.Sprintf("%s.%d.tmp", tracker.stateFile, os.Getpid())
+	err = ioutil.WriteFile(tempFileName, stateBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write quota state: %v", err)
+	}
+
+	err = os.Rename(tempFileName, tracker.stateFile)
+	if err != nil {
+		_ = os.Remove(tempFileName)
+		return fmt.Errorf("could not write quota state: %v", err)
+	}
+
+	return nil
+}
+
+// lockStateFile takes an exclusive lock next to stateFile and returns the function that releases it.
+// The lock is on a separate file since the state file is replaced on every write.
+// Each call opens the lock file again, so it also keeps goroutines in the same process apart.
+func lockStateFile(stateFile string) (func(), error) {
+	lockFile, err := os.OpenFile(fmt.Sprintf("%s.lock", stateFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not lock quota state: %v", err)
+	}
+
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		_ = lockFile.Close()
+		return nil, fmt.Errorf("could not lock quota state: %v", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		_ = lockFile.Close()
+	}, nil
+}
+
+// quotaDay returns the day the quota is counted against, which resets at midnight Pacific time
+func quotaDay() string {
+	location, err := time.LoadLocation(quotaResetZoneID)
+	if err != nil {
+		location = time.UTC
+	}
+
+	return time.Now().In(location).Format(quotaDateFormat)
+}
+
+// quotaCost returns the units a call to the API method costs
+func quotaCost(method string) int {
+	if method == "search" {
+		return searchQuotaCost
+	}
+
+	return listQuotaCost
+}
@@ -0,0 +1,184 @@
+package command_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestQuotaTrackerTransport(t *testing.T) {
+	requests := make([]string, 0)
+	ts := getQuotaTestServer(&requests)
+	defer ts.Close()
+	tracker := command.NewQuotaTracker("", 0)
+	client := &http.Client{Transport: tracker.Transport(http.DefaultTransport)}
+	for _, method := range []string{"search", "channels", "playlistItems", "search"} {
+		response, err := client.Get(fmt.Sprintf("%s/youtube/v3/%s?part=snippet", ts.URL, method))
+		require.Nil(t, err)
+		_ = response.Body.Close()
+	}
+
+	assert.Equal(t, 202, tracker.Used())
+	assert.Equal(t, "Quota used: 202 units (channels: 1, playlistItems: 1, search: 200)", tracker.Summary())
+	assert.Equal(t, 4, len(requests))
+}
+
+func TestQuotaTrackerBudget(t *testing.T) {
+	requests := make([]string, 0)
+	ts := getQuotaTestServer(&requests)
+	defer ts.Close()
+	tracker := command.NewQuotaTracker("", 101)
+	client := &http.Client{Transport: tracker.Transport(http.DefaultTransport)}
+	for _, method := range []string{"search", "channels"} {
+		response, err := client.Get(fmt.Sprintf("%s/%s", ts.URL, method))
+		require.Nil(t, err)
+		_ = response.Body.Close()
+	}
+
+	_, err := client.Get(fmt.Sprintf("%s/videos", ts.URL))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "quota budget exceeded: videos costs 1 units and 101 of 101 are used")
+	assert.Equal(t, []string{"/search", "/channels"}, requests)
+	assert.Equal(t, "Quota used: 101 units (channels: 1, search: 100), budget 101", tracker.Summary())
+}
+
+func TestQuotaTrackerStateFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder)
+	stateFile := fmt.Sprintf("%s/quota.json", outputFolder)
+	require.Nil(t, ioutil.WriteFile(stateFile, []byte(`{"date": "2000-01-01", "used": 9999}`), 0644))
+	requests := make([]string, 0)
+	ts := getQuotaTestServer(&requests)
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewQuotaTracker(stateFile, 150).Transport(http.DefaultTransport)}
+	response, err := client.Get(fmt.Sprintf("%s/search", ts.URL))
+	require.Nil(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, 100, getQuotaStateUsed(t, stateFile))
+
+	// A second run on the same day shares the budget
+	tracker := command.NewQuotaTracker(stateFile, 150)
+	client = &http.Client{Transport: tracker.Transport(http.DefaultTransport)}
+	response, err = client.Get(fmt.Sprintf("%s/channels", ts.URL))
+	require.Nil(t, err)
+	_ = response.Body.Close()
+	_, err = client.Get(fmt.Sprintf("%s/search", ts.URL))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "quota budget exceeded: search costs 100 units and 101 of 150 are used")
+	assert.Equal(t, 101, getQuotaStateUsed(t, stateFile))
+	assert.Equal(t, "Quota used: 1 units (channels: 1), 101 today, budget 150", tracker.Summary())
+
+	// A dry run counts its units against the saved total without saving them
+	tracker = command.NewQuotaTracker(stateFile, 102)
+	tracker.SetDryRun(true)
+	client = &http.Client{Transport: tracker.Transport(http.DefaultTransport)}
+	response, err = client.Get(fmt.Sprintf("%s/channels", ts.URL))
+	require.Nil(t, err)
+	_ = response.Body.Close()
+	_, err = client.Get(fmt.Sprintf("%s/channels", ts.URL))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "quota budget exceeded: channels costs 1 units and 102 of 102 are used")
+	assert.Equal(t, 101, getQuotaStateUsed(t, stateFile))
+}
+
+func TestQuotaTrackerStateFileConcurrent(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder)
+	stateFile := fmt.Sprintf("%s/quota.json", outputFolder)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}")
+	}))
+	defer ts.Close()
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			// Separate trackers stand in for feeds in the daemon and runs from cron sharing the file
+			client := &http.Client{Transport: command.NewQuotaTracker(stateFile, 0).Transport(http.DefaultTransport)}
+			for j := 0; j < 5; j++ {
+				response, err := client.Get(fmt.Sprintf("%s/channels", ts.URL))
+				if assert.Nil(t, err) {
+					_ = response.Body.Close()
+				}
+			}
+		}()
+	}
+
+	wait.Wait()
+	assert.Equal(t, 50, getQuotaStateUsed(t, stateFile))
+}
+
+func TestQuotaTrackerInvalidStateFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "quota.json")
+	client := &http.Client{Transport: command.NewQuotaTracker(fmt.Sprintf("%s/quota.json", outputFolder), 0).Transport(http.DefaultTransport)}
+	_, err := client.Get("http://foo.com/search")
+	require.NotNil(t, err)
+	assert.Contains(
+		t,
+		err.Error(),
+		fmt.Sprintf("could not parse quota state %s/quota.json: invalid character 'c' looking for beginning of value", outputFolder),
+	)
+}
+
+func TestCmdChannelQuota(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, writer, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.String("quotaFile", fmt.Sprintf("%s/quota.json", outputFolder), "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "Quota used: 202 units (channels: 2, search: 200), 202 today\n", writer.String())
+}
+
+func TestCmdChannelQuotaBudgetExceeded(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, writer, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.Int("quotaBudget", 150, "doc")
+	err := command.CmdChannel(&runner.Test{})(cli.NewContext(app, set, nil))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "quota budget exceeded: search costs 100 units and 102 of 150 are used")
+	assert.Equal(t, "Quota used: 102 units (channels: 2, search: 100), budget 150\n", writer.String())
+}
+
+func getQuotaTestServer(requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.Path)
+		fmt.Fprint(w, "{}")
+	}))
+}
+
+func getQuotaStateUsed(t *testing.T, stateFile string) int {
+	stateBytes, err := ioutil.ReadFile(stateFile)
+	require.Nil(t, err)
+	state := struct {
+		Used int `json:"used"`
+	}{}
+	require.Nil(t, json.Unmarshal(stateBytes, &state))
+	return state.Used
+}
@@ -0,0 +1,190 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Item statuses in a FeedReport
+const (
+	ItemFiltered   = "filtered"
+	ItemSkipped    = "skipped"
+	ItemDownloaded = "downloaded"
+	ItemFailed     = "failed"
+)
+
+// RunReport describes a run for monitoring
+type RunReport struct {
+	Started  time.Time     `json:"started"`
+	Duration float64       `json:"durationSeconds"`
+	Feeds    []*FeedReport `json:"feeds"`
+}
+
+// FeedReport describes what a run did to one feed
+type FeedReport struct {
+	Source          string             `json:"source"`
+	XMLFile         string             `json:"xmlFile,omitempty"`
+	OutputFolder    string             `json:"outputFolder"`
+	DryRun          bool               `json:"dryRun,omitempty"`
+	Found           int                `json:"found"`
+	Filtered        int                `json:"filtered"`
+	Downloaded      int                `json:"downloaded"`
+	Skipped         int                `json:"skipped"`
+	Failed          int                `json:"failed"`
+	BytesDownloaded int64              `json:"bytesDownloaded"`
+	QuotaUsed       int                `json:"quotaUsed"`
+	FeedChanged     bool               `json:"feedChanged"`
+	RemovedFiles    []string           `json:"removedFiles"`
+	Items           []*ItemReport      `json:"items"`
+	Timings         map[string]float64 `json:"timingsSeconds"`
+	Error           string             `json:"error,omitempty"`
+	started         time.Time
+	stepStarted     time.Time
+}
+
+// ItemReport describes what happened to one video
+type ItemReport struct {
+	GUID   string `json:"guid"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+}
+
+// ItemError is an error processing a particular video
+type ItemError struct {
+	Item *VideoData
+	Err  error
+}
+
+// Error returns the message of the underlying error
+func (err ItemError) Error() string {
+	return err.Err.Error()
+}
+
+// NewRunReport returns a RunReport starting now
+func NewRunReport() *RunReport {
+	return &RunReport{Started: time.Now(), Feeds: make([]*FeedReport, 0, 1)}
+}
+
+// NewFeedReport returns a FeedReport for the feed built from config and starts timing it
+func NewFeedReport(config SourceConfig, xmlFile, outputFolder string) *FeedReport {
+	now := time.Now()
+	return &FeedReport{
+		Source:       fmt.Sprintf("%s:%s", config.Type, config.ID),
+		XMLFile:      xmlFile,
+		OutputFolder: outputFolder,
+		DryRun:       config.DryRun,
+		RemovedFiles: make([]string, 0),
+		Items:        make([]*ItemReport, 0),
+		Timings:      make(map[string]float64),
+		started:      now,
+		stepStarted:  now,
+	}
+}
+
+// AddFeed adds feed to the report
+func (report *RunReport) AddFeed(feed *FeedReport) {
+	report.Feeds = append(report.Feeds, feed)
+}
+
+// Finish records how long the run took
+func (report *RunReport) Finish() {
+	report.Duration = time.Since(report.Started).Seconds()
+}
+
+// Write saves the report as JSON to fileName
+func (report *RunReport) Write(fileName string) error {
+	reportBytes, err := report.JSON()
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(fileName, reportBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write report: %v", err)
+	}
+
+	return nil
+}
+
+// JSON encodes the report
+func (report *RunReport) JSON() ([]byte, error) {
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(reportBytes, '\n'), nil
+}
+
+// Step records the time since the last step, or the start, as the timing for step
+func (feed *FeedReport) Step(step string) {
+	now := time.Now()
+	feed.Timings[step] += now.Sub(feed.stepStarted).Seconds()
+	feed.stepStarted = now
+}
+
+// Finish records the total time and the error the feed failed with, if any
+func (feed *FeedReport) Finish(err error) {
+	feed.Timings["total"] = time.Since(feed.started).Seconds()
+	if err != nil {
+		feed.Error = err.Error()
+	}
+}
+
+// AddItems records items with status
+func (feed *FeedReport) AddItems(items []*VideoData, status, reason string) {
+	for _, item := range items {
+		feed.AddItem(item, status, reason, 0)
+	}
+}
+
+// AddItem records what happened to item and updates the totals
+func (feed *FeedReport) AddItem(item *VideoData, status, reason string, bytes int64) {
+	feed.Items = append(feed.Items, &ItemReport{GUID: item.GUID, Title: item.Title, Status: status, Reason: reason, Bytes: bytes})
+	switch status {
+	case ItemFiltered:
+		feed.Filtered++
+	case ItemSkipped:
+		feed.Skipped++
+	case ItemDownloaded:
+		feed.Downloaded++
+		feed.BytesDownloaded += bytes
+	case ItemFailed:
+		feed.Failed++
+	}
+}
+
+// AddDownloads records the outcome of downloading pending after DownloadVideos returned err
+func (feed *FeedReport) AddDownloads(outputFolder string, pending []*VideoData, err error) {
+	var failed *VideoData
+	if itemErr, ok := err.(ItemError); ok {
+		failed = itemErr.Item
+	}
+
+	for i, item := range pending {
+		if item == failed {
+			feed.AddItem(item, ItemFailed, err.Error(), 0)
+			feed.AddItems(pending[i+1:], ItemSkipped, "an earlier download failed")
+			return
+		}
+
+		fileInfo, statErr := os.Stat(getFileName(outputFolder, item))
+		if statErr != nil {
+			// The run stopped before this item without blaming a particular one, like when it is interrupted
+			reason := "not downloaded"
+			if err != nil {
+				reason = err.Error()
+			}
+
+			feed.AddItems(pending[i:], ItemSkipped, reason)
+			return
+		}
+
+		feed.AddItem(item, ItemDownloaded, "", fileInfo.Size())
+	}
+}
@@ -0,0 +1,171 @@
+package command_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestFeedReportAddDownloads(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	item1, item2, item3 := videoData1, videoData2, videoData2
+	item3.GUID = "vId3"
+	feed := command.NewFeedReport(command.SourceConfig{Type: "channel", ID: "awesome"}, "", outputFolder)
+	feed.AddDownloads(outputFolder, []*command.VideoData{&item1, &item2, &item3}, command.ItemError{Item: &item2, Err: errors.New("could not download")})
+	assert.Equal(
+		t,
+		[]*command.ItemReport{
+			{GUID: "vId1", Title: "t", Status: command.ItemDownloaded, Bytes: 7},
+			{GUID: "vId2", Title: "t2", Status: command.ItemFailed, Reason: "could not download"},
+			{GUID: "vId3", Title: "t2", Status: command.ItemSkipped, Reason: "an earlier download failed"},
+		},
+		feed.Items,
+	)
+	assert.Equal(t, "channel:awesome", feed.Source)
+	assert.Equal(t, 1, feed.Downloaded)
+	assert.Equal(t, 1, feed.Failed)
+	assert.Equal(t, 1, feed.Skipped)
+	assert.Equal(t, int64(7), feed.BytesDownloaded)
+}
+
+func TestFeedReportAddDownloadsInterrupted(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	item1 := videoData1
+	feed := command.NewFeedReport(command.SourceConfig{}, "", outputFolder)
+	feed.AddDownloads(outputFolder, []*command.VideoData{&item1}, errors.New("context canceled"))
+	assert.Equal(t, []*command.ItemReport{{GUID: "vId1", Title: "t", Status: command.ItemSkipped, Reason: "context canceled"}}, feed.Items)
+}
+
+func TestRunReportWriteError(t *testing.T) {
+	err := command.NewRunReport().Write("/notadir/report.json")
+	assert.EqualError(t, err, "could not write report: open /notadir/report.json: no such file or directory")
+}
+
+func TestCmdChannelReport(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	reportFile := fmt.Sprintf("%s/report.json", getOutputFolder())
+	// A report from an earlier run isn't cleaned up
+	writeOutputFiles(t, outputFolder, "junk", "report.json")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, writer, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.String("filter", "t2", "doc")
+	set.String("report", reportFile, "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := getReportRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "", writer.String())
+
+	reportBytes, err := ioutil.ReadFile(reportFile)
+	require.Nil(t, err)
+	report := getReport(t, reportBytes)
+	require.Equal(t, 1, len(report.Feeds))
+	feed := report.Feeds[0]
+	assert.Equal(t, "channel:awesome", feed.Source)
+	assert.Equal(t, fmt.Sprintf("%s/xmlFile", outputFolder), feed.XMLFile)
+	assert.Equal(t, 2, feed.Found)
+	assert.Equal(t, 1, feed.Filtered)
+	assert.Equal(t, 1, feed.Downloaded)
+	assert.Equal(t, int64(7), feed.BytesDownloaded)
+	assert.Equal(t, 202, feed.QuotaUsed)
+	assert.True(t, feed.FeedChanged)
+	assert.Equal(t, []string{fmt.Sprintf("%s/junk", outputFolder)}, feed.RemovedFiles)
+	assert.Equal(
+		t,
+		[]*command.ItemReport{
+			{GUID: "vId1", Title: "t", Status: command.ItemFiltered, Reason: "does not match filter t2"},
+			{GUID: "vId2", Title: "t2", Status: command.ItemDownloaded, Bytes: 7},
+		},
+		feed.Items,
+	)
+	for _, step := range []string{"fetch", "download", "process", "feed", "cleanup", "total"} {
+		assert.Contains(t, feed.Timings, step)
+	}
+}
+
+func TestCmdChannelOutputJSON(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, writer, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.String("filter", "t2", "doc")
+	set.String("output", "json", "doc")
+	set.Int("quotaBudget", 10000, "doc")
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand(
+				"",
+				fmt.Sprintf("/usr/bin/youtube-dl -x --audio-format mp3 --audio-quality 0 -o %s/t2-vId2.%%\\(ext\\)s https://youtu.be/vId2", outputFolder),
+				"ERROR: Video unavailable",
+				1,
+			),
+		},
+	}
+	err := command.CmdChannel(cb)(cli.NewContext(app, set, nil))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not download t2-vId2: exit status 1")
+	assert.Equal(t, []error(nil), cb.Errors)
+	// Other messages move to ErrWriter so Writer is only the report
+	assert.Equal(t, "Quota used: 202 units (channels: 2, search: 200), budget 10000\n", errWriter.String())
+	report := getReport(t, writer.Bytes())
+	require.Equal(t, 1, len(report.Feeds))
+	feed := report.Feeds[0]
+	assert.Equal(t, 1, feed.Failed)
+	assert.Equal(t, err.Error(), feed.Error)
+	assert.Equal(t, command.ItemFailed, feed.Items[1].Status)
+	assert.Equal(t, err.Error(), feed.Items[1].Reason)
+}
+
+func TestCmdChannelInvalidOutput(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("output", "yaml", "doc")
+	err := command.CmdChannel(&runner.Test{})(cli.NewContext(app, set, nil))
+	assert.EqualError(t, err, "invalid output yaml: must be text or json")
+}
+
+func getReportRunner() *runner.Test {
+	download := runner.NewExpectedCommand(
+		"",
+		fmt.Sprintf("/usr/bin/youtube-dl -x --audio-format mp3 --audio-quality 0 -o %s/t2-vId2.%%\\(ext\\)s https://youtu.be/vId2", getOutputFolder()),
+		"",
+		0,
+	)
+	download.Closure = func(string) {
+		_ = ioutil.WriteFile(fmt.Sprintf("%s/t2-vId2.mp3", getOutputFolder()), []byte("content"), 0644)
+	}
+
+	return &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			download,
+			runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t2-vId2.mp3", getOutputFolder()), "Duration: 00:13:45.22, start", 0),
+		},
+	}
+}
+
+func getReport(t *testing.T, reportBytes []byte) *command.RunReport {
+	report := &command.RunReport{}
+	require.Nil(t, json.NewDecoder(bytes.NewReader(reportBytes)).Decode(report))
+	return report
+}
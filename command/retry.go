@@ -0,0 +1,128 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxRetryDelay = time.Minute
+
+// permanentDownloadErrors are youtube-dl errors that retrying won't fix
+var permanentDownloadErrors = []string{
+	"Video unavailable",
+	"Private video",
+	"This video has been removed",
+	"members-only",
+	"Sign in to confirm your age",
+	"copyright",
+}
+
+// RetryPolicy retries failed operations with jittered exponential backoff
+type RetryPolicy struct {
+	retries int
+	delay   time.Duration
+}
+
+type retryingTransport struct {
+	base   http.RoundTripper
+	policy *RetryPolicy
+}
+
+// NewRetryPolicy returns a RetryPolicy that retries up to retries times, waiting around delay before the first retry and twice as long each time after
+func NewRetryPolicy(retries int, delay time.Duration) *RetryPolicy {
+	return &RetryPolicy{retries: retries, delay: delay}
+}
+
+// Do runs operation until it doesn't ask to be retried or the retries run out and returns its last error.
+// A nil policy runs operation once.  Waiting stops early when ctx is done.
+func (policy *RetryPolicy) Do(ctx context.Context, operation func() (bool, error)) error {
+	for attempt := 0; ; attempt++ {
+		retry, err := operation()
+		if !retry || policy == nil || attempt >= policy.retries {
+			return err
+		}
+
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff doubles the delay for each attempt and picks a random point in the upper half so parallel runs spread out
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.delay << uint(attempt)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+
+	if policy.delay == 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Transport wraps base so server errors, rate limits and network errors are retried
+func (policy *RetryPolicy) Transport(base http.RoundTripper) http.RoundTripper {
+	return &retryingTransport{base: base, policy: policy}
+}
+
+// RoundTrip retries the request and returns the last response when the retries run out
+func (transport retryingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var response *http.Response
+	err := transport.policy.Do(request.Context(), func() (bool, error) {
+		if response != nil {
+			_ = response.Body.Close()
+		}
+
+		var err error
+		response, err = transport.base.RoundTrip(request)
+		if err != nil {
+			// Requests with a body can't be sent again and a call over the quota budget stays over it
+			_, overBudget := err.(QuotaExceededError)
+			return request.Body == nil && request.Context().Err() == nil && !overBudget, err
+		}
+
+		return request.Body == nil && isRetryableResponse(response), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// isRetryableResponse reports server errors and rate limits.  YouTube reports rate limits as a 403 that is only told apart from other 403s by its body.
+func isRetryableResponse(response *http.Response) bool {
+	if response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	if response.StatusCode != http.StatusForbidden {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return err == nil && strings.Contains(strings.ToLower(string(body)), "ratelimitexceeded")
+}
+
+func isRetryableDownloadError(out []byte) bool {
+	for _, permanentError := range permanentDownloadErrors {
+		if bytes.Contains(out, []byte(permanentError)) {
+			return false
+		}
+	}
+
+	return true
+}
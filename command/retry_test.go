@@ -0,0 +1,206 @@
+package command_test
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestRetryPolicyTransportRetriesServerErrors(t *testing.T) {
+	attempts := 0
+	ts := getFlakyTestServer(&attempts, 2, http.StatusServiceUnavailable, "")
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewRetryPolicy(3, 0).Transport(http.DefaultTransport)}
+	response, err := client.Get(ts.URL)
+	require.Nil(t, err)
+	body, err := ioutil.ReadAll(response.Body)
+	require.Nil(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "response 3", string(body))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryPolicyTransportRetriesRateLimits(t *testing.T) {
+	attempts := 0
+	ts := getFlakyTestServer(&attempts, 1, http.StatusForbidden, `{"error": {"errors": [{"reason": "userRateLimitExceeded"}]}}`)
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewRetryPolicy(3, 0).Transport(http.DefaultTransport)}
+	response, err := client.Get(ts.URL)
+	require.Nil(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRetryPolicyTransportDoesNotRetryOtherForbidden(t *testing.T) {
+	attempts := 0
+	ts := getFlakyTestServer(&attempts, 1, http.StatusForbidden, `{"error": {"errors": [{"reason": "quotaExceeded"}]}}`)
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewRetryPolicy(3, 0).Transport(http.DefaultTransport)}
+	response, err := client.Get(ts.URL)
+	require.Nil(t, err)
+	body, err := ioutil.ReadAll(response.Body)
+	require.Nil(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Equal(t, `{"error": {"errors": [{"reason": "quotaExceeded"}]}}`, string(body))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryPolicyTransportGivesUp(t *testing.T) {
+	attempts := 0
+	ts := getFlakyTestServer(&attempts, 5, http.StatusInternalServerError, "")
+	defer ts.Close()
+	client := &http.Client{Transport: command.NewRetryPolicy(2, 0).Transport(http.DefaultTransport)}
+	response, err := client.Get(ts.URL)
+	require.Nil(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryPolicyTransportChargesEachAttempt(t *testing.T) {
+	attempts := 0
+	ts := getFlakyTestServer(&attempts, 5, http.StatusInternalServerError, "")
+	defer ts.Close()
+	tracker := command.NewQuotaTracker("", 2)
+	charged := &countingTransport{base: tracker.Transport(http.DefaultTransport)}
+	client := &http.Client{Transport: command.NewRetryPolicy(3, 0).Transport(charged)}
+	_, err := client.Get(fmt.Sprintf("%s/channels", ts.URL))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "quota budget exceeded: channels costs 1 units and 2 of 2 are used")
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 2, tracker.Used())
+	// The budget error isn't retried
+	assert.Equal(t, 3, charged.calls)
+}
+
+func TestRetryPolicyStopsWaitingWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts := 0
+	start := time.Now()
+	err := command.NewRetryPolicy(3, time.Hour).Do(ctx, func() (bool, error) {
+		attempts++
+		return true, errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, 1, attempts)
+	assert.True(t, time.Since(start) < time.Minute)
+}
+
+func TestRetryPolicyBacksOff(t *testing.T) {
+	attempts := make([]time.Time, 0, 3)
+	err := command.NewRetryPolicy(2, 20*time.Millisecond).Do(context.Background(), func() (bool, error) {
+		attempts = append(attempts, time.Now())
+		return true, errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	require.Equal(t, 3, len(attempts))
+	// The jitter keeps each wait in the upper half of the doubled delay
+	assert.True(t, attempts[1].Sub(attempts[0]) >= 10*time.Millisecond)
+	assert.True(t, attempts[2].Sub(attempts[1]) >= 20*time.Millisecond)
+}
+
+func TestNilRetryPolicy(t *testing.T) {
+	attempts := 0
+	var policy *command.RetryPolicy
+	err := policy.Do(context.Background(), func() (bool, error) {
+		attempts++
+		return true, errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetriesOffByDefault(t *testing.T) {
+	checked := 0
+	for _, cmd := range command.Commands {
+		set := flag.NewFlagSet(cmd.Name, 0)
+		for _, cmdFlag := range cmd.Flags {
+			cmdFlag.Apply(set)
+		}
+
+		if retries := set.Lookup("retries"); retries != nil {
+			assert.Equal(t, "0", retries.DefValue, cmd.Name)
+			checked++
+		}
+	}
+
+	assert.NotEqual(t, 0, checked)
+}
+
+func TestCmdChannelRetries(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	attempts := 0
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response, err := http.Get(fmt.Sprintf("%s%s", ts.URL, r.URL.String()))
+		require.Nil(t, err)
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		w.WriteHeader(response.StatusCode)
+		_, _ = io.Copy(w, response.Body)
+	}))
+	defer flaky.Close()
+	command.YoutubeAPIURLBase = flaky.URL
+	app, writer, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Int("retries", 1, "doc")
+	set.Int("quotaBudget", 10000, "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, 5, attempts)
+	// The retried request is charged for both attempts
+	assert.Equal(t, "Quota used: 203 units (channels: 3, search: 200), budget 10000\n", writer.String())
+}
+
+type countingTransport struct {
+	base  http.RoundTripper
+	calls int
+}
+
+func (transport *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.calls++
+	return transport.base.RoundTrip(request)
+}
+
+// getFlakyTestServer answers the first failures requests with status and body
+func getFlakyTestServer(attempts *int, failures, status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*attempts++
+		if *attempts <= failures {
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+			return
+		}
+
+		fmt.Fprintf(w, "response %d", *attempts)
+	}))
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a feed runs next
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// IntervalSchedule runs a feed every Interval
+type IntervalSchedule struct {
+	Interval time.Duration
+}
+
+// Next returns after plus the interval
+func (schedule IntervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(schedule.Interval)
+}
+
+// CronSchedule runs a feed at the times matched by a five field cron expression
+type CronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// Like cron, when both days and weekdays are restricted a time matching either one runs
+	anyDay     bool
+	anyWeekday bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7}}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSearchLimit stops Next from looking forever for an expression like 0 0 30 2 * that never matches
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// ParseCronSchedule parses a cron expression with minute, hour, day of month, month and day of week fields.
+// Fields may be *, numbers, ranges like 1-5, steps like */15 or 1-30/5 and comma separated lists of those.
+// The macros @hourly, @daily, @midnight, @weekly, @monthly, @yearly and @annually are also accepted.
+func ParseCronSchedule(expression string) (*CronSchedule, error) {
+	spec := strings.TrimSpace(expression)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %s: expected 5 fields", expression)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		bits[i], err = parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %s: %v", expression, err)
+		}
+	}
+
+	schedule := &CronSchedule{
+		minutes:    bits[0],
+		hours:      bits[1],
+		days:       bits[2],
+		months:     bits[3],
+		weekdays:   bits[4],
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}
+	// 7 is Sunday too
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid cron expression %s: it never matches", expression)
+	}
+
+	return schedule, nil
+}
+
+func parseCronField(field string, limits cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if index := strings.Index(part, "/"); index >= 0 {
+			var err error
+			rangePart = part[:index]
+			step, err = strconv.Atoi(part[index+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s field %s", limits.name, part)
+			}
+		}
+
+		low, high, err := parseCronRange(rangePart, limits)
+		if err != nil {
+			return 0, err
+		}
+
+		if rangePart != "*" && !strings.Contains(rangePart, "-") && step > 1 {
+			// 5/15 means every 15 starting at 5
+			high = limits.max
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronRange(rangePart string, limits cronField) (int, int, error) {
+	if rangePart == "*" {
+		return limits.min, limits.max, nil
+	}
+
+	bounds := strings.SplitN(rangePart, "-", 2)
+	low, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid %s %s", limits.name, rangePart)
+	}
+
+	high := low
+	if len(bounds) == 2 {
+		high, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s %s", limits.name, rangePart)
+		}
+	}
+
+	if low < limits.min || high > limits.max || low > high {
+		return 0, 0, fmt.Errorf("%s %s is out of range %d-%d", limits.name, rangePart, limits.min, limits.max)
+	}
+
+	return low, high, nil
+}
+
+// Next returns the first matching minute after after or the zero time if none is found in the next five years
+func (schedule *CronSchedule) Next(after time.Time) time.Time {
+	next := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+	for next.Before(limit) {
+		switch {
+		case schedule.months&(1<<uint(next.Month())) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !schedule.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case schedule.hours&(1<<uint(next.Hour())) == 0:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case schedule.minutes&(1<<uint(next.Minute())) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+func (schedule *CronSchedule) matchesDay(day time.Time) bool {
+	dayMatches := schedule.days&(1<<uint(day.Day())) != 0
+	weekdayMatches := schedule.weekdays&(1<<uint(day.Weekday())) != 0
+	if schedule.anyDay || schedule.anyWeekday {
+		return dayMatches && weekdayMatches
+	}
+
+	return dayMatches || weekdayMatches
+}
@@ -0,0 +1,68 @@
+package command_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalSchedule(t *testing.T) {
+	now := time.Date(2017, 3, 10, 10, 7, 30, 0, time.UTC)
+	assert.Equal(t, now.Add(90*time.Minute), command.IntervalSchedule{Interval: 90 * time.Minute}.Next(now))
+}
+
+func TestCronSchedule(t *testing.T) {
+	// A Friday
+	now := time.Date(2017, 3, 10, 10, 7, 30, 0, time.UTC)
+	tests := map[string]time.Time{
+		"*/15 * * * *":  time.Date(2017, 3, 10, 10, 15, 0, 0, time.UTC),
+		"5/20 * * * *":  time.Date(2017, 3, 10, 10, 25, 0, 0, time.UTC),
+		"7 10 * * *":    time.Date(2017, 3, 11, 10, 7, 0, 0, time.UTC),
+		"0 9 * * 1-5":   time.Date(2017, 3, 13, 9, 0, 0, 0, time.UTC),
+		"0 0 * * 7":     time.Date(2017, 3, 12, 0, 0, 0, 0, time.UTC),
+		"30 4 1,15 * *": time.Date(2017, 3, 15, 4, 30, 0, 0, time.UTC),
+		"0 0 1 * 6":     time.Date(2017, 3, 11, 0, 0, 0, 0, time.UTC),
+		"0 12 * 2 *":    time.Date(2018, 2, 1, 12, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":    time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"@hourly":       time.Date(2017, 3, 10, 11, 0, 0, 0, time.UTC),
+		"@daily":        time.Date(2017, 3, 11, 0, 0, 0, 0, time.UTC),
+		"@weekly":       time.Date(2017, 3, 12, 0, 0, 0, 0, time.UTC),
+		"@monthly":      time.Date(2017, 4, 1, 0, 0, 0, 0, time.UTC),
+		"@yearly":       time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for expression, expected := range tests {
+		schedule, err := command.ParseCronSchedule(expression)
+		require.Nil(t, err, expression)
+		assert.Equal(t, expected, schedule.Next(now), expression)
+	}
+}
+
+func TestCronScheduleNextIsAfter(t *testing.T) {
+	schedule, err := command.ParseCronSchedule("0 * * * *")
+	require.Nil(t, err)
+	now := time.Date(2017, 3, 10, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2017, 3, 10, 11, 0, 0, 0, time.UTC), schedule.Next(now))
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	tests := map[string]string{
+		"* * *":         "invalid cron expression * * *: expected 5 fields",
+		"@often":        "invalid cron expression @often: expected 5 fields",
+		"60 * * * *":    "invalid cron expression 60 * * * *: minute 60 is out of range 0-59",
+		"* 5-2 * * *":   "invalid cron expression * 5-2 * * *: hour 5-2 is out of range 0-23",
+		"* * 0 * *":     "invalid cron expression * * 0 * *: day of month 0 is out of range 1-31",
+		"*/0 * * * *":   "invalid cron expression */0 * * * *: invalid step in minute field */0",
+		"a * * * *":     "invalid cron expression a * * * *: invalid minute a",
+		"* * * 1-b *":   "invalid cron expression * * * 1-b *: invalid month 1-b",
+		"0 0 30 2 *":    "invalid cron expression 0 0 30 2 *: it never matches",
+		"0 0 * * 8":     "invalid cron expression 0 0 * * 8: day of week 8 is out of range 0-7",
+		"0 0 * * 1/two": "invalid cron expression 0 0 * * 1/two: invalid step in day of week field 1/two",
+	}
+	for expression, expected := range tests {
+		_, err := command.ParseCronSchedule(expression)
+		assert.EqualError(t, err, expected, expression)
+	}
+}
@@ -0,0 +1,11 @@
+package command
+
+import (
+	"github.com/guywithnose/runner"
+	"github.com/urfave/cli"
+)
+
+// CmdSearch builds an rss feed from a youtube search
+func CmdSearch(cmdBuilder runner.Builder) func(c *cli.Context) error {
+	return CmdSource("search", "Usage: \"feedTube search {query}\"", cmdBuilder)
+}
@@ -0,0 +1,209 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+const maxSearchPageSize = 50
+
+// Defaults for searches so that a search never pages through every result
+const (
+	defaultSearchDays  = 30
+	defaultSearchLimit = 50
+	defaultSearchOrder = "date"
+)
+
+// SearchScraper retrieves youtube videos matching a search query
+type SearchScraper struct {
+	youtubeService *youtube.Service
+	logger         *slog.Logger
+}
+
+// NewSearchScraper returns a SearchScraper
+func NewSearchScraper(apiKey string, wrappers ...TransportWrapper) *SearchScraper {
+	youtubeService := getYoutubeService(apiKey, wrappers...)
+	return &SearchScraper{youtubeService: youtubeService, logger: discardLogger}
+}
+
+// SetLogger sets the logger for the videos found by searches
+func (scraper *SearchScraper) SetLogger(logger *slog.Logger) {
+	scraper.logger = logger
+}
+
+type searchSource struct {
+	scraper  *SearchScraper
+	query    string
+	days     int
+	order    string
+	limit    int
+	seenFile string
+	dryRun   bool
+}
+
+func newSearchSource(config SourceConfig) (Source, error) {
+	order := config.Order
+	if order == "" {
+		order = "date"
+	}
+
+	if order != "date" && order != "relevance" {
+		return nil, fmt.Errorf("invalid search order %s: must be date or relevance", order)
+	}
+
+	scraper := NewSearchScraper(config.APIKey, config.Transports...)
+	scraper.SetLogger(sourceLogger(config))
+	return &searchSource{
+		scraper:  scraper,
+		query:    config.ID,
+		days:     config.Days,
+		order:    order,
+		limit:    config.Limit,
+		seenFile: config.SeenFile,
+		dryRun:   config.DryRun,
+	}, nil
+}
+
+// GetVideos returns the videos matching the search query merged with any previously seen results
+func (source searchSource) GetVideos(ctx context.Context) ([]*VideoData, *ChannelInfo, error) {
+	var publishedAfter time.Time
+	if source.days > 0 {
+		publishedAfter = time.Now().AddDate(0, 0, -source.days)
+	}
+
+	items, info, err := source.scraper.GetVideosForSearch(ctx, source.query, publishedAfter, source.order, source.limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if source.seenFile == "" {
+		return items, info, nil
+	}
+
+	seen, err := loadSeenVideos(source.seenFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := len(items)
+	items = mergeSeenVideos(seen, items, publishedAfter)
+	source.scraper.logger.Debug("Merged seen videos", "seenFile", source.seenFile, "seen", len(seen), "found", found, "kept", len(items))
+	if source.dryRun {
+		return items, info, nil
+	}
+
+	err = saveSeenVideos(source.seenFile, items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return items, info, nil
+}
+
+// GetVideosForSearch returns up to limit videos matching query that were published after publishedAfter
+// A zero publishedAfter does not limit the publish date and a limit of 0 retrieves every page of results
+func (scraper SearchScraper) GetVideosForSearch(
+	ctx context.Context,
+	query string,
+	publishedAfter time.Time,
+	order string,
+	limit int,
+) ([]*VideoData, *ChannelInfo, error) {
+	listCall := scraper.youtubeService.Search.List("snippet").Q(query).Type("video").Order(order)
+	if !publishedAfter.IsZero() {
+		listCall = listCall.PublishedAfter(publishedAfter.UTC().Format(time.RFC3339))
+	}
+
+	if limit > 0 && limit < maxSearchPageSize {
+		listCall = listCall.MaxResults(int64(limit))
+	} else {
+		listCall = listCall.MaxResults(maxSearchPageSize)
+	}
+
+	items, err := getSearchResults(ctx, scraper.logger.With("query", query), listCall, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &ChannelInfo{
+		Title:       query,
+		Link:        fmt.Sprintf("https://www.youtube.com/results?search_query=%s", url.QueryEscape(query)),
+		Description: fmt.Sprintf("YouTube videos matching \"%s\"", query),
+	}
+
+	return items, info, nil
+}
+
+func loadSeenVideos(seenFile string) ([]*VideoData, error) {
+	seenBytes, err := ioutil.ReadFile(seenFile)
+	if os.IsNotExist(err) {
+		return []*VideoData{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read seen file: %v", err)
+	}
+
+	seen := []*VideoData{}
+	err = json.Unmarshal(seenBytes, &seen)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse seen file %s: %v", seenFile, err)
+	}
+
+	return seen, nil
+}
+
+func saveSeenVideos(seenFile string, items []*VideoData) error {
+	seenBytes, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(seenFile, seenBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write seen file: %v", err)
+	}
+
+	return nil
+}
+
+// mergeSeenVideos combines the videos from previous runs with the current results so items stay put as rankings change.
+// A video that was found again keeps its place but takes the current details, and anything published before cutoff is dropped.
+func mergeSeenVideos(seen, found []*VideoData, cutoff time.Time) []*VideoData {
+	current := make(map[string]*VideoData, len(found))
+	for _, item := range found {
+		if _, ok := current[item.GUID]; !ok {
+			current[item.GUID] = item
+		}
+	}
+
+	merged := make([]*VideoData, 0, len(seen)+len(found))
+	guids := make(map[string]bool, len(seen)+len(found))
+	for _, item := range append(seen, found...) {
+		if foundItem, ok := current[item.GUID]; ok {
+			item = foundItem
+		}
+
+		if guids[item.GUID] || (!cutoff.IsZero() && item.PubDate.Before(cutoff)) {
+			continue
+		}
+
+		guids[item.GUID] = true
+		merged = append(merged, item)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].PubDate.After(merged[j].PubDate)
+	})
+
+	return merged
+}
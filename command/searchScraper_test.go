@@ -0,0 +1,108 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	youtube "google.golang.org/api/youtube/v3"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetVideosForSearch(t *testing.T) {
+	ts := getTestServer(getDefaultSearchResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	videoData, info, err := command.NewSearchScraper("fakeApiKey").GetVideosForSearch(context.Background(), "golang talks", time.Time{}, "date", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []*command.VideoData{&videoData1, &videoData2}, videoData)
+	assert.Equal(t, &awesomeSearchInfo, info)
+}
+
+func TestGetVideosForSearchWithLimitAndPublishedAfter(t *testing.T) {
+	ts := getTestServer(getDefaultSearchResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	videoData, info, err := command.NewSearchScraper("fakeApiKey").GetVideosForSearch(
+		context.Background(),
+		"golang talks",
+		time.Date(2006, time.July, 7, 0, 0, 0, 0, time.UTC),
+		"relevance",
+		1,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []*command.VideoData{&videoData1}, videoData)
+	assert.Equal(t, &awesomeSearchInfo, info)
+}
+
+func TestGetVideosForSearchPage2Failure(t *testing.T) {
+	responses := getDefaultSearchResponses()
+	responses["/search?alt=json&key=fakeApiKey&maxResults=50&order=date&pageToken=page2&part=snippet&q=golang+talks&type=video"] = "error"
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	_, _, err := command.NewSearchScraper("fakeApiKey").GetVideosForSearch(context.Background(), "golang talks", time.Time{}, "date", 0)
+	assert.EqualError(t, err, "search request failed: googleapi: got HTTP response code 500 with body: ")
+}
+
+func TestNewSearchSourceInvalidOrder(t *testing.T) {
+	_, err := command.NewSource(command.SourceConfig{Type: "search", ID: "golang talks", Order: "views"})
+	assert.EqualError(t, err, "invalid search order views: must be date or relevance")
+}
+
+var awesomeSearchInfo = command.ChannelInfo{
+	Title:       "golang talks",
+	Description: `YouTube videos matching "golang talks"`,
+	Link:        "https://www.youtube.com/results?search_query=golang+talks",
+}
+
+func getDefaultSearchResponses() map[string]string {
+	responses := map[string]string{}
+	searchPage1 := youtube.SearchListResponse{
+		NextPageToken: "page2",
+		Items: []*youtube.SearchResult{
+			{
+				Snippet: &youtube.SearchResultSnippet{
+					Title:       "t",
+					Description: "d",
+					PublishedAt: "2007-01-02T15:04:05Z",
+					Thumbnails: &youtube.ThumbnailDetails{
+						Default: &youtube.Thumbnail{
+							Url: "https://images.com/vid1Thumb.jpg",
+						},
+					},
+					LiveBroadcastContent: "none",
+				},
+				Id: &youtube.ResourceId{
+					VideoId: "vId1",
+				},
+			},
+		},
+	}
+	bytes, _ := json.Marshal(searchPage1)
+	responses["/search?alt=json&key=fakeApiKey&maxResults=50&order=date&part=snippet&q=golang+talks&type=video"] = string(bytes)
+	responses["/search?alt=json&key=fakeApiKey&maxResults=1&order=relevance&part=snippet&publishedAfter=2006-07-07T00%3A00%3A00Z&q=golang+talks&type=video"] =
+		string(bytes)
+
+	searchPage2 := youtube.SearchListResponse{
+		Items: []*youtube.SearchResult{
+			{
+				Snippet: &youtube.SearchResultSnippet{
+					Title:                "t2",
+					Description:          "d2",
+					PublishedAt:          "2006-01-02T15:04:05Z",
+					LiveBroadcastContent: "none",
+				},
+				Id: &youtube.ResourceId{
+					VideoId: "vId2",
+				},
+			},
+		},
+	}
+	bytes, _ = json.Marshal(searchPage2)
+	responses["/search?alt=json&key=fakeApiKey&maxResults=50&order=date&pageToken=page2&part=snippet&q=golang+talks&type=video"] = string(bytes)
+	return responses
+}
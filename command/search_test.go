@@ -0,0 +1,155 @@
+package command_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	youtube "google.golang.org/api/youtube/v3"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestCmdSearchKeepsPreviouslySeenVideos(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	seenFile := fmt.Sprintf("%s/seen.json", outputFolder)
+	ts := getTestServer(getDefaultSearchResponses())
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getSearchAppAndFlagSet(t, outputFolder, seenFile)
+	cb := getBaseRunner()
+	assert.Nil(t, command.CmdSearch(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	ts.Close()
+
+	responses := getDefaultSearchResponses()
+	bytes, _ := json.Marshal(youtube.SearchListResponse{Items: []*youtube.SearchResult{}})
+	responses["/search?alt=json&key=fakeApiKey&maxResults=50&order=date&part=snippet&q=golang+talks&type=video"] = string(bytes)
+	ts = getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set = getSearchAppAndFlagSet(t, outputFolder, seenFile)
+	cb = getBaseRunner()
+	assert.Nil(t, command.CmdSearch(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	xmlLines := strings.Split(string(xmlBytes), "\n")
+	assert.Equal(t, "      <guid>vId1</guid>", xmlLines[11])
+	assert.Equal(t, "      <guid>vId2</guid>", xmlLines[20])
+}
+
+func TestCmdSearchUpdatesSeenVideos(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	seenFile := fmt.Sprintf("%s/seen.json", outputFolder)
+	stale := videoData1
+	stale.Title = "old title"
+	stale.Description = "old description"
+	stale.Image = "https://images.com/oldThumb.jpg"
+	seenBytes, _ := json.Marshal([]*command.VideoData{&stale})
+	assert.Nil(t, ioutil.WriteFile(seenFile, seenBytes, 0644))
+	ts := getTestServer(getDefaultSearchResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getSearchAppAndFlagSet(t, outputFolder, seenFile)
+	cb := getBaseRunner()
+	assert.Nil(t, command.CmdSearch(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+
+	seenBytes, err := ioutil.ReadFile(seenFile)
+	assert.Nil(t, err)
+	seen := []*command.VideoData{}
+	assert.Nil(t, json.Unmarshal(seenBytes, &seen))
+	assert.Equal(t, []*command.VideoData{&videoData1, &videoData2}, seen)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(xmlBytes), "old")
+}
+
+func TestCmdSearchCleanupKeepsSeenFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	seenFile := fmt.Sprintf("%s/seen.json", outputFolder)
+	ts := getTestServer(getDefaultSearchResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getSearchAppAndFlagSet(t, outputFolder, seenFile)
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := getBaseRunner()
+	assert.Nil(t, command.CmdSearch(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "", errWriter.String())
+	_, err := os.Stat(seenFile)
+	assert.Nil(t, err)
+}
+
+func TestCmdSearchDryRunDoesNotSaveSeenFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	seenFile := fmt.Sprintf("%s/seen.json", outputFolder)
+	ts := getTestServer(getDefaultSearchResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getSearchAppAndFlagSet(t, outputFolder, seenFile)
+	set.Bool("dryRun", true, "doc")
+	cb := &runner.Test{}
+	assert.Nil(t, command.CmdSearch(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []error(nil), cb.Errors)
+	_, err := os.Stat(seenFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCmdSearchInvalidSeenFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	seenFile := fmt.Sprintf("%s/seen.json", outputFolder)
+	assert.Nil(t, ioutil.WriteFile(seenFile, []byte("not json"), 0644))
+	ts := getTestServer(getDefaultSearchResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getSearchAppAndFlagSet(t, outputFolder, seenFile)
+	cb := &runner.Test{}
+	assert.EqualError(
+		t,
+		command.CmdSearch(cb)(cli.NewContext(app, set, nil)),
+		fmt.Sprintf("could not parse seen file %s: invalid character 'o' in literal null (expecting 'u')", seenFile),
+	)
+}
+
+func TestCmdSearchUsage(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	app, _, _ := appWithTestWriters()
+	assert.EqualError(t, command.CmdSearch(&runner.Test{})(cli.NewContext(app, set, nil)), `Usage: "feedTube search {query}"`)
+}
+
+func getSearchAppAndFlagSet(t *testing.T, outputFolder, seenFile string) (*cli.App, *bytes.Buffer, *bytes.Buffer, *flag.FlagSet) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("apiKey", "fakeApiKey", "doc")
+	set.String("outputFolder", outputFolder, "doc")
+	set.String("xmlFile", fmt.Sprintf("%s/xmlFile", outputFolder), "doc")
+	set.String("baseURL", "http://foo.com", "doc")
+	set.String("quality", "0", "doc")
+	set.String("order", "date", "doc")
+	set.String("seenFile", seenFile, "doc")
+	assert.Nil(t, set.Parse([]string{"golang talks"}))
+	app, writer, errWriter := appWithTestWriters()
+	return app, writer, errWriter, set
+}
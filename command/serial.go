@@ -0,0 +1,47 @@
+package command
+
+import (
+	"sort"
+	"time"
+)
+
+const serialFeedType = "serial"
+
+// orderSerialItems sorts items by season and episode and numbers any episodes without a playlist position.
+// The publish dates are rewritten a minute apart starting at the earliest real publish date so that
+// podcatchers that ignore itunes:type still list the episodes in order.
+func orderSerialItems(items []*VideoData) {
+	if len(items) == 0 {
+		return
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Season != items[j].Season {
+			return items[i].Season < items[j].Season
+		}
+
+		if items[i].Episode != items[j].Episode {
+			return items[i].Episode < items[j].Episode
+		}
+
+		return items[i].PubDate.Before(items[j].PubDate)
+	})
+
+	start := items[0].PubDate
+	lastEpisodes := make(map[int]int)
+	for _, item := range items {
+		if item.PubDate.Before(start) {
+			start = item.PubDate
+		}
+
+		if item.Episode == 0 {
+			item.Episode = lastEpisodes[item.Season] + 1
+		}
+
+		lastEpisodes[item.Season] = item.Episode
+	}
+
+	for i, item := range items {
+		item.PubDate = start.Add(time.Duration(i) * time.Minute)
+	}
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderSerialItems(t *testing.T) {
+	start := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	items := []*VideoData{
+		{GUID: "s2e2", Season: 2, Episode: 2, PubDate: start.AddDate(1, 0, 0)},
+		{GUID: "s1late", Season: 1, PubDate: start.AddDate(0, 2, 0)},
+		{GUID: "s2e1", Season: 2, Episode: 1, PubDate: start.AddDate(2, 0, 0)},
+		{GUID: "s1early", Season: 1, PubDate: start.AddDate(0, 1, 0)},
+	}
+	orderSerialItems(items)
+	actual := make([][]interface{}, 0, len(items))
+	for _, item := range items {
+		actual = append(actual, []interface{}{item.GUID, item.Season, item.Episode, item.PubDate})
+	}
+
+	assert.Equal(
+		t,
+		[][]interface{}{
+			{"s1early", 1, 1, start.AddDate(0, 1, 0)},
+			{"s1late", 1, 2, start.AddDate(0, 1, 0).Add(time.Minute)},
+			{"s2e1", 2, 1, start.AddDate(0, 1, 0).Add(2 * time.Minute)},
+			{"s2e2", 2, 2, start.AddDate(0, 1, 0).Add(3 * time.Minute)},
+		},
+		actual,
+	)
+}
+
+func TestOrderSerialItemsEmpty(t *testing.T) {
+	items := []*VideoData{}
+	orderSerialItems(items)
+	assert.Equal(t, []*VideoData{}, items)
+}
@@ -0,0 +1,52 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// showNotesLinkRegex matches the URLs and the timestamps like 05:12 or 1:02:03 that are linked in show notes
+var showNotesLinkRegex = regexp.MustCompile(`(https?://[^\s<>"]+)|\b((?:\d{1,2}:)?\d{1,2}:\d{2})\b`)
+
+var paragraphRegex = regexp.MustCompile(`\n\s*\n`)
+
+// RenderShowNotes renders the description of item as HTML.
+// URLs are linked, timestamps link to that point in the video and line breaks are kept.  Everything else is escaped.
+func RenderShowNotes(item *VideoData) string {
+	paragraphs := make([]string, 0)
+	for _, paragraph := range paragraphRegex.Split(strings.TrimSpace(item.Description), -1) {
+		lines := strings.Split(paragraph, "\n")
+		for i, line := range lines {
+			lines[i] = linkShowNotesLine(item.GUID, strings.TrimSpace(line))
+		}
+
+		paragraphs = append(paragraphs, fmt.Sprintf("<p>%s</p>", strings.Join(lines, "<br>")))
+	}
+
+	return strings.Join(paragraphs, "\n")
+}
+
+func linkShowNotesLine(videoID, line string) string {
+	rendered := &bytes.Buffer{}
+	last := 0
+	for _, match := range showNotesLinkRegex.FindAllStringSubmatchIndex(line, -1) {
+		rendered.WriteString(html.EscapeString(line[last:match[0]]))
+		last = match[1]
+		if match[2] != -1 {
+			linkURL := strings.TrimRight(line[match[2]:match[3]], ".,;:!?)]}'")
+			last = match[2] + len(linkURL)
+			fmt.Fprintf(rendered, `<a href="%s">%s</a>`, html.EscapeString(linkURL), html.EscapeString(linkURL))
+			continue
+		}
+
+		timestamp := line[match[4]:match[5]]
+		seconds := int(parseTimestamp(timestamp).Seconds())
+		fmt.Fprintf(rendered, `<a href="https://youtu.be/%s?t=%d">%s</a>`, html.EscapeString(videoID), seconds, timestamp)
+	}
+
+	rendered.WriteString(html.EscapeString(line[last:]))
+	return rendered.String()
+}
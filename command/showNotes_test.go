@@ -0,0 +1,88 @@
+package command_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestRenderShowNotes(t *testing.T) {
+	item := videoData1
+	item.Description = "Today <b>we</b> talk about Tom & Jerry\n\n00:00 Intro\n(05:12) The first topic, see https://example.com/a?b=1&c=2.\n" +
+		"1:02:03 Wrap up at 10:30am\n\n\nSupport us (https://patreon.com/us) https://youtu.be/vId1"
+	assert.Equal(
+		t,
+		"<p>Today &lt;b&gt;we&lt;/b&gt; talk about Tom &amp; Jerry</p>\n"+
+			`<p><a href="https://youtu.be/vId1?t=0">00:00</a> Intro<br>(<a href="https://youtu.be/vId1?t=312">05:12</a>) The first topic, see `+
+			`<a href="https://example.com/a?b=1&amp;c=2">https://example.com/a?b=1&amp;c=2</a>.<br>`+
+			`<a href="https://youtu.be/vId1?t=3723">1:02:03</a> Wrap up at 10:30am</p>`+"\n"+
+			`<p>Support us (<a href="https://patreon.com/us">https://patreon.com/us</a>) <a href="https://youtu.be/vId1">https://youtu.be/vId1</a></p>`,
+		command.RenderShowNotes(&item),
+	)
+}
+
+func TestXMLBuilderShowNotes(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	xmlFileName := fmt.Sprintf("%s/xmlFile", outputFolder)
+	item := videoData1
+	item.Duration = "01:10:00"
+	item.ShowNotes = `<p><a href="https://youtu.be/vId1">https://youtu.be/vId1</a></p>`
+	_, err := getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), []*command.VideoData{&item})
+	assert.Nil(t, err)
+	xmlBytes, err := ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	assert.Contains(
+		t,
+		string(xmlBytes),
+		`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:content="http://purl.org/rss/1.0/modules/content/">`,
+	)
+	assert.Contains(t, string(xmlBytes), "<description>d https://youtu.be/vId1</description>")
+	assert.Contains(
+		t,
+		string(xmlBytes),
+		`<content:encoded><![CDATA[<p><a href="https://youtu.be/vId1">https://youtu.be/vId1</a></p>]]></content:encoded>`,
+	)
+}
+
+func TestCmdChannelShowNotes(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	responses := getDefaultChannelResponses()
+	responses["/search?alt=json&channelId=awesomeChannelId&key=fakeApiKey&part=snippet&type=video"] = getChannelSearchPageWithDescription(
+		"Links:\nhttps://example.com\n\n05:12 Topic",
+	)
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("showNotes", true, "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	require.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), "<description>Links:&#xA;https://example.com&#xA;&#xA;05:12 Topic https://youtu.be/vId1</description>")
+	assert.Contains(
+		t,
+		string(xmlBytes),
+		`<content:encoded><![CDATA[<p>Links:<br><a href="https://example.com">https://example.com</a></p>`+"\n"+
+			`<p><a href="https://youtu.be/vId1?t=312">05:12</a> Topic <a href="https://youtu.be/vId1">https://youtu.be/vId1</a></p>]]></content:encoded>`,
+	)
+	assert.Contains(
+		t,
+		string(xmlBytes),
+		`<content:encoded><![CDATA[<p>d2 <a href="https://youtu.be/vId2">https://youtu.be/vId2</a></p>]]></content:encoded>`,
+	)
+}
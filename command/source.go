@@ -0,0 +1,81 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// Source retrieves the videos and metadata that make up a feed
+type Source interface {
+	GetVideos(ctx context.Context) ([]*VideoData, *ChannelInfo, error)
+}
+
+// SourceConfig holds everything needed to build a Source
+type SourceConfig struct {
+	Type       string
+	ID         string
+	APIKey     string
+	After      string
+	Days       int
+	Order      string
+	Limit      int
+	SeenFile   string
+	Filter     string
+	Sources    []SourceConfig
+	Seasons    bool
+	Transports []TransportWrapper
+	// DryRun keeps sources from saving any state
+	DryRun bool
+	// Logger gets what the scrapers found at debug level, nothing is logged when it is nil
+	Logger *slog.Logger
+}
+
+// SourceFactory builds a Source from a SourceConfig
+type SourceFactory func(config SourceConfig) (Source, error)
+
+var sourceFactories = map[string]SourceFactory{}
+
+func init() {
+	RegisterSource("channel", newChannelSource)
+	RegisterSource("list", newVideoListSource)
+	RegisterSource("merge", newMergedSource)
+	RegisterSource("playlist", newPlaylistSource)
+	RegisterSource("search", newSearchSource)
+}
+
+// RegisterSource makes a source type available to NewSource
+func RegisterSource(sourceType string, factory SourceFactory) {
+	sourceFactories[sourceType] = factory
+}
+
+// NewSource builds a Source using the factory registered for config.Type
+func NewSource(config SourceConfig) (Source, error) {
+	factory, ok := sourceFactories[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown source type: %s", config.Type)
+	}
+
+	return factory(config)
+}
+
+// sourceLogger returns the logger for the scrapers of config
+func sourceLogger(config SourceConfig) *slog.Logger {
+	if config.Logger == nil {
+		return discardLogger
+	}
+
+	return config.Logger
+}
+
+// SourceTypes returns the registered source types in alphabetical order
+func SourceTypes() []string {
+	sourceTypes := make([]string, 0, len(sourceFactories))
+	for sourceType := range sourceFactories {
+		sourceTypes = append(sourceTypes, sourceType)
+	}
+
+	sort.Strings(sourceTypes)
+	return sourceTypes
+}
@@ -0,0 +1,99 @@
+package command_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+type staticSource struct {
+	items []*command.VideoData
+	info  *command.ChannelInfo
+	err   error
+}
+
+func (source staticSource) GetVideos(ctx context.Context) ([]*command.VideoData, *command.ChannelInfo, error) {
+	return source.items, source.info, source.err
+}
+
+func TestNewSourceUnknownType(t *testing.T) {
+	_, err := command.NewSource(command.SourceConfig{Type: "nope"})
+	assert.EqualError(t, err, "unknown source type: nope")
+}
+
+func TestSourceTypes(t *testing.T) {
+	sourceTypes := command.SourceTypes()
+	for _, sourceType := range []string{"channel", "list", "merge", "playlist", "search"} {
+		assert.Contains(t, sourceTypes, sourceType)
+	}
+
+	assert.True(t, sort.StringsAreSorted(sourceTypes))
+}
+
+func TestRegisterSource(t *testing.T) {
+	command.RegisterSource("static", func(config command.SourceConfig) (command.Source, error) {
+		return staticSource{err: fmt.Errorf("static %s", config.ID)}, nil
+	})
+	source, err := command.NewSource(command.SourceConfig{Type: "static", ID: "foo"})
+	assert.Nil(t, err)
+	_, _, err = source.GetVideos(context.Background())
+	assert.EqualError(t, err, "static foo")
+}
+
+func TestBuildWithCustomSource(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.String("overrideTitle", "ovride", "doc")
+	video := &command.VideoData{
+		GUID:        "vId1",
+		Link:        "https://youtu.be/vId1",
+		Title:       "t",
+		Description: "d https://youtu.be/vId1",
+		FileName:    "t-vId1",
+		PubDate:     time.Date(2007, 1, 2, 15, 4, 5, 0, time.UTC),
+	}
+	source := staticSource{
+		items: []*command.VideoData{video},
+		info:  &command.ChannelInfo{Title: "t", Description: "d", Link: "https://example.com"},
+	}
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand(
+				"",
+				fmt.Sprintf("/usr/bin/youtube-dl -x --audio-format mp3 --audio-quality 0 -o %s/t-vId1.%%\\(ext\\)s https://youtu.be/vId1", outputFolder),
+				"video 1 output",
+				0,
+			),
+		},
+	}
+	assert.Nil(t, command.Build(cli.NewContext(app, set, nil), cb, source))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	xmlLines := strings.Split(string(xmlBytes), "\n")
+	assert.Equal(t, "    <title>ovride</title>", xmlLines[3])
+	assert.Equal(t, "      <guid>vId1</guid>", xmlLines[11])
+}
+
+func TestBuildSourceError(t *testing.T) {
+	outputFolder := getOutputFolder()
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	cb := &runner.Test{}
+	assert.EqualError(t, command.Build(cli.NewContext(app, set, nil), cb, staticSource{err: errors.New("source failed")}), "source failed")
+	assert.Equal(t, []error(nil), cb.Errors)
+}
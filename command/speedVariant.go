@@ -0,0 +1,141 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guywithnose/runner"
+)
+
+const (
+	minSpeed    = 0.5
+	maxSpeed    = 4.0
+	maxAtempo   = 2.0
+	speedSuffix = "-%sx"
+)
+
+// SpeedVariant renders sped up copies of downloaded files into a sibling folder
+type SpeedVariant struct {
+	cmdBuilder   runner.Builder
+	sourceFolder string
+	speed        float64
+	quality      string
+}
+
+// NewSpeedVariant returns a SpeedVariant for the files in sourceFolder
+func NewSpeedVariant(cmdBuilder runner.Builder, sourceFolder string, speed float64, quality string) (*SpeedVariant, error) {
+	if speed < minSpeed || speed > maxSpeed {
+		return nil, fmt.Errorf("invalid speed %s: must be between %s and %s", formatSpeed(speed), formatSpeed(minSpeed), formatSpeed(maxSpeed))
+	}
+
+	return &SpeedVariant{cmdBuilder: cmdBuilder, sourceFolder: sourceFolder, speed: speed, quality: quality}, nil
+}
+
+// OutputFolder returns the sibling folder holding the sped up files
+func (variant SpeedVariant) OutputFolder() string {
+	return fmt.Sprintf("%s%s", strings.TrimRight(variant.sourceFolder, "/"), variant.suffix())
+}
+
+// XMLFile returns the name of the variant feed next to xmlFile
+func (variant SpeedVariant) XMLFile(xmlFile string) string {
+	extension := filepath.Ext(xmlFile)
+	return fmt.Sprintf("%s%s%s", strings.TrimSuffix(xmlFile, extension), variant.suffix(), extension)
+}
+
+// BaseURL returns the URL of the sibling folder given the URL of the source folder
+func (variant SpeedVariant) BaseURL(baseURL string) (string, error) {
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid baseURL %s: %v", baseURL, err)
+	}
+
+	if strings.Trim(parsedURL.Path, "/") == "" {
+		return "", fmt.Errorf("could not derive the speed variant URL from %s, use --speedBaseURL", baseURL)
+	}
+
+	parsedURL.Path = fmt.Sprintf("%s%s", strings.TrimRight(parsedURL.Path, "/"), variant.suffix())
+	return parsedURL.String(), nil
+}
+
+// Info returns a copy of info for the variant feed
+func (variant SpeedVariant) Info(info *ChannelInfo) *ChannelInfo {
+	variantInfo := *info
+	variantInfo.Title = fmt.Sprintf("%s (%sx)", info.Title, formatSpeed(variant.speed))
+	return &variantInfo
+}
+
+// Items returns copies of items for the variant feed.
+// The durations are cleared and the chapters are moved since they change with the speed.
+func (variant SpeedVariant) Items(items []*VideoData) []*VideoData {
+	variantItems := make([]*VideoData, 0, len(items))
+	for _, item := range items {
+		variantItem := *item
+		variantItem.Duration = ""
+		variantItem.Chapters = nil
+		for _, chapter := range item.Chapters {
+			chapter.Start = time.Duration(float64(chapter.Start) / variant.speed).Round(time.Second)
+			variantItem.Chapters = append(variantItem.Chapters, chapter)
+		}
+
+		variantItems = append(variantItems, &variantItem)
+	}
+
+	return variantItems
+}
+
+// RenderFiles renders every downloaded item that doesn't have a sped up copy yet.  ffmpeg is killed when ctx is done.
+func (variant SpeedVariant) RenderFiles(ctx context.Context, items []*VideoData) error {
+	err := os.MkdirAll(variant.OutputFolder(), 0777)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", variant.OutputFolder(), err)
+	}
+
+	for _, item := range items {
+		sourceFileName := getFileName(variant.sourceFolder, item)
+		if !fileExists(sourceFileName) || fileExists(getFileName(variant.OutputFolder(), item)) {
+			continue
+		}
+
+		err = variant.renderFile(ctx, sourceFileName, getFileName(variant.OutputFolder(), item))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (variant SpeedVariant) renderFile(ctx context.Context, sourceFileName, fileName string) error {
+	args := []string{"-af", variant.atempoFilter()}
+	if variant.quality != "" {
+		args = append(args, "-q:a", variant.quality)
+	}
+
+	return runFfmpeg(ctx, variant.cmdBuilder, "speed up", sourceFileName, fileName, args...)
+}
+
+// atempoFilter changes the speed without changing the pitch.  atempo only goes up to 2x so faster speeds are chained.
+func (variant SpeedVariant) atempoFilter() string {
+	filters := make([]string, 0, 2)
+	speed := variant.speed
+	for speed > maxAtempo {
+		filters = append(filters, fmt.Sprintf("atempo=%s", formatSpeed(maxAtempo)))
+		speed /= maxAtempo
+	}
+
+	return strings.Join(append(filters, fmt.Sprintf("atempo=%s", formatSpeed(speed))), ",")
+}
+
+func (variant SpeedVariant) suffix() string {
+	return fmt.Sprintf(speedSuffix, formatSpeed(variant.speed))
+}
+
+func formatSpeed(speed float64) string {
+	return strconv.FormatFloat(speed, 'f', -1, 64)
+}
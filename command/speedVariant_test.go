@@ -0,0 +1,186 @@
+package command_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestSpeedVariantNames(t *testing.T) {
+	variant, err := command.NewSpeedVariant(&runner.Test{}, "/tmp/podcast/", 1.5, "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/podcast-1.5x", variant.OutputFolder())
+	assert.Equal(t, "/tmp/xmlFile-1.5x", variant.XMLFile("/tmp/xmlFile"))
+	assert.Equal(t, "/tmp/feeds/podcast-1.5x.xml", variant.XMLFile("/tmp/feeds/podcast.xml"))
+	baseURL, err := variant.BaseURL("http://foo.com/podcast/")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://foo.com/podcast-1.5x", baseURL)
+	_, err = variant.BaseURL("http://foo.com")
+	assert.EqualError(t, err, "could not derive the speed variant URL from http://foo.com, use --speedBaseURL")
+	info := awesomeChannelInfo
+	assert.Equal(t, "t (1.5x)", variant.Info(&info).Title)
+	assert.Equal(t, "t", info.Title)
+	item := videoData1
+	item.Duration = "01:00:00"
+	variantItems := variant.Items([]*command.VideoData{&item})
+	assert.Equal(t, "", variantItems[0].Duration)
+	assert.Equal(t, "01:00:00", item.Duration)
+}
+
+func TestNewSpeedVariantInvalidSpeed(t *testing.T) {
+	_, err := command.NewSpeedVariant(&runner.Test{}, "/tmp/podcast", 5, "0")
+	assert.EqualError(t, err, "invalid speed 5: must be between 0.5 and 4")
+}
+
+func TestSpeedVariantRenderFiles(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	defer removeFile(t, fmt.Sprintf("%s-3x", outputFolder))
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -af atempo=2,atempo=1.5 -q:a 0 %s-3x/t-vId1.processing.mp3",
+					outputFolder,
+					outputFolder,
+				),
+				"",
+				0,
+			),
+		},
+	}
+	cb.ExpectedCommands[0].Closure = writeProcessedFile(t)
+	variant, err := command.NewSpeedVariant(cb, outputFolder, 3, "0")
+	assert.Nil(t, err)
+	assert.Nil(t, variant.RenderFiles(context.Background(), []*command.VideoData{&videoData1, &videoData2}))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assertFileContents(t, fmt.Sprintf("%s-3x/t-vId1.mp3", outputFolder), "processed")
+
+	// Files that have already been sped up are left alone
+	cb = &runner.Test{}
+	variant, err = command.NewSpeedVariant(cb, outputFolder, 3, "0")
+	assert.Nil(t, err)
+	assert.Nil(t, variant.RenderFiles(context.Background(), []*command.VideoData{&videoData1}))
+	assert.Equal(t, []error(nil), cb.Errors)
+}
+
+func TestSpeedVariantRenderFailure(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	defer removeFile(t, fmt.Sprintf("%s-1.5x", outputFolder))
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -af atempo=1.5 %s-1.5x/t-vId1.processing.mp3",
+					outputFolder,
+					outputFolder,
+				),
+				"bad audio",
+				1,
+			),
+		},
+	}
+	variant, err := command.NewSpeedVariant(cb, outputFolder, 1.5, "")
+	assert.Nil(t, err)
+	assert.EqualError(
+		t,
+		variant.RenderFiles(context.Background(), []*command.VideoData{&videoData1}),
+		fmt.Sprintf(
+			"could not speed up %s/t-vId1.mp3: exit status 1\nParams: '/usr/bin/ffmpeg' '-y' '-hide_banner' '-nostats' '-i' '%s/t-vId1.mp3' "+
+				"'-map' '0' '-map_metadata' '0' '-c:v' 'copy' '-af' 'atempo=1.5' '%s-1.5x/t-vId1.processing.mp3': bad audio",
+			outputFolder,
+			outputFolder,
+			outputFolder,
+		),
+	)
+	assert.Equal(t, []error(nil), cb.Errors)
+}
+
+func TestCmdChannelSpeed(t *testing.T) {
+	outputFolder := getOutputFolder()
+	variantFolder := fmt.Sprintf("%s-1.5x", outputFolder)
+	defer removeFile(t, outputFolder)
+	defer removeFile(t, variantFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	writeOutputFiles(t, variantFolder, "old-vId0.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Float64("speed", 1.5, "doc")
+	set.String("speedBaseURL", "http://foo.com/fast", "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := getFfprobeRunner()
+	renderCommand := newExpectedFfmpegCommand(
+		fmt.Sprintf(
+			"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -af atempo=1.5 -q:a 0 %s/t-vId1.processing.mp3",
+			outputFolder,
+			variantFolder,
+		),
+		"",
+		0,
+	)
+	renderCommand.Closure = writeProcessedFile(t)
+	variantFfprobe := runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t-vId1.mp3", variantFolder), "Duration: 01:29:10.15, start", 0)
+	cb.ExpectedCommands = []*runner.ExpectedCommand{cb.ExpectedCommands[0], renderCommand, cb.ExpectedCommands[1], variantFfprobe}
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, fmt.Sprintf("Removing file: %s/old-vId0.mp3\n", variantFolder), errWriter.String())
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile-1.5x", outputFolder))
+	assert.Nil(t, err)
+	xml := string(xmlBytes)
+	assert.Contains(t, xml, "<title>t (1.5x)</title>")
+	assert.Contains(t, xml, `<enclosure url="http://foo.com/fast/t-vId1.mp3" length="9" type="audio/mpeg"></enclosure>`)
+	assert.Contains(t, xml, "<itunes:duration>01:29:10</itunes:duration>")
+	mainXMLBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	assert.Nil(t, err)
+	assert.Contains(t, string(mainXMLBytes), "<itunes:duration>02:13:45</itunes:duration>")
+}
+
+func TestCmdChannelSpeedNoBaseURL(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	defer removeFile(t, fmt.Sprintf("%s-1.5x", outputFolder))
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Float64("speed", 1.5, "doc")
+	cb := getFfprobeRunner()
+	renderCommand := newExpectedFfmpegCommand(
+		fmt.Sprintf(
+			"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.mp3 -map 0 -map_metadata 0 -c:v copy -af atempo=1.5 -q:a 0 %s-1.5x/t-vId1.processing.mp3",
+			outputFolder,
+			outputFolder,
+		),
+		"",
+		0,
+	)
+	renderCommand.Closure = writeProcessedFile(t)
+	cb.ExpectedCommands = []*runner.ExpectedCommand{cb.ExpectedCommands[0], renderCommand, cb.ExpectedCommands[1]}
+	err := command.CmdChannel(cb)(cli.NewContext(app, set, nil))
+	assert.EqualError(t, err, "could not derive the speed variant URL from http://foo.com, use --speedBaseURL")
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+}
+
+func TestCmdChannelInvalidSpeed(t *testing.T) {
+	app, _, _, set := getBaseAppAndFlagSet(t, getOutputFolder())
+	set.Float64("speed", 0.1, "doc")
+	err := command.CmdChannel(&runner.Test{})(cli.NewContext(app, set, nil))
+	assert.EqualError(t, err, "invalid speed 0.1: must be between 0.5 and 4")
+}
@@ -0,0 +1,333 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guywithnose/runner"
+)
+
+const (
+	segmentsStateFileName = ".feedTube-segments.json"
+	skipActionType        = "skip"
+)
+
+// SponsorBlockURLBase is the default SponsorBlock API server
+const SponsorBlockURLBase = "https://sponsor.ajay.app"
+
+// sponsorBlockTimeout bounds each SponsorBlock request so a slow server can't hold up a download
+const sponsorBlockTimeout = 30 * time.Second
+
+// Segment is a part of a video, in seconds, that should be removed
+type Segment struct {
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Category string  `json:"category"`
+}
+
+// SegmentSource looks up the segments to remove from a video
+type SegmentSource interface {
+	Segments(ctx context.Context, videoID string) ([]Segment, error)
+}
+
+// SponsorBlock is a SegmentSource backed by a SponsorBlock compatible API
+type SponsorBlock struct {
+	urlBase    string
+	categories []string
+	client     *http.Client
+}
+
+type sponsorBlockSegment struct {
+	Category   string    `json:"category"`
+	ActionType string    `json:"actionType"`
+	Segment    []float64 `json:"segment"`
+}
+
+// NewSponsorBlock returns a SponsorBlock that fetches the segments in categories from the API at urlBase.
+// A nil client uses one that gives up on requests after sponsorBlockTimeout.
+func NewSponsorBlock(urlBase string, categories []string, client *http.Client) *SponsorBlock {
+	if client == nil {
+		client = &http.Client{Timeout: sponsorBlockTimeout}
+	}
+
+	return &SponsorBlock{urlBase: strings.TrimRight(urlBase, "/"), categories: categories, client: client}
+}
+
+// Segments fetches the skip segments for videoID.  Videos nobody has submitted segments for have none.
+func (sponsorBlock SponsorBlock) Segments(ctx context.Context, videoID string) ([]Segment, error) {
+	categoryBytes, err := json.Marshal(sponsorBlock.categories)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"videoID": {videoID}, "categories": {string(categoryBytes)}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/skipSegments?%s", sponsorBlock.urlBase, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := sponsorBlock.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch segments for %s: %v", videoID, err)
+	}
+
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch segments for %s: %s", videoID, response.Status)
+	}
+
+	apiSegments := make([]sponsorBlockSegment, 0)
+	err = json.NewDecoder(response.Body).Decode(&apiSegments)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse segments for %s: %v", videoID, err)
+	}
+
+	return skipSegments(apiSegments), nil
+}
+
+// skipSegments returns the segments that should be cut out.  Other actions like mute or full video labels don't remove anything.
+func skipSegments(apiSegments []sponsorBlockSegment) []Segment {
+	segments := make([]Segment, 0, len(apiSegments))
+	for _, apiSegment := range apiSegments {
+		if (apiSegment.ActionType != "" && apiSegment.ActionType != skipActionType) || len(apiSegment.Segment) != 2 {
+			continue
+		}
+
+		segments = append(segments, Segment{Start: apiSegment.Segment[0], End: apiSegment.Segment[1], Category: apiSegment.Category})
+	}
+
+	return segments
+}
+
+// SegmentRemover is a PostProcessor that cuts the segments from a SegmentSource out of downloaded files.
+// The removed segments are recorded in the output folder so the chapters and transcripts can be moved to match.
+type SegmentRemover struct {
+	cmdBuilder   runner.Builder
+	outputFolder string
+	source       SegmentSource
+	quality      string
+}
+
+// NewSegmentRemover returns a new SegmentRemover
+func NewSegmentRemover(cmdBuilder runner.Builder, outputFolder string, source SegmentSource, quality string) *SegmentRemover {
+	return &SegmentRemover{cmdBuilder: cmdBuilder, outputFolder: outputFolder, source: source, quality: quality}
+}
+
+// StateFile returns the file recording the segments removed from each file
+func (remover SegmentRemover) StateFile() string {
+	return filepath.Join(remover.outputFolder, segmentsStateFileName)
+}
+
+// Process removes the segments of item from fileName and moves the item chapters to match
+func (remover SegmentRemover) Process(ctx context.Context, item *VideoData, fileName string) error {
+	segments, err := remover.source.Segments(ctx, item.GUID)
+	if err != nil {
+		return err
+	}
+
+	segments = mergeSegments(segments)
+	if len(segments) != 0 {
+		err = remover.cutSegments(ctx, fileName, segments)
+		if err != nil {
+			return err
+		}
+
+		// The duration is probed again from the shorter file
+		item.Duration = ""
+		item.Chapters = removeSegmentsFromChapters(item.Chapters, segments)
+	}
+
+	state, err := remover.loadState()
+	if err != nil {
+		return err
+	}
+
+	state[filepath.Base(fileName)] = segments
+	return remover.saveState(state)
+}
+
+// AdjustItems moves the chapters of items whose files had segments removed on an earlier run.
+// Items whose file is gone are left alone since they are downloaded again and Process moves their chapters then.
+func (remover SegmentRemover) AdjustItems(items []*VideoData) error {
+	state, err := remover.loadState()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		fileName := getFileName(remover.outputFolder, item)
+		segments := state[filepath.Base(fileName)]
+		if len(segments) != 0 && fileExists(fileName) {
+			item.Chapters = removeSegmentsFromChapters(item.Chapters, segments)
+		}
+	}
+
+	return nil
+}
+
+// RemovedSegments returns the segments removed from each file, keyed by the file name without its folder
+func (remover SegmentRemover) RemovedSegments() (map[string][]Segment, error) {
+	return remover.loadState()
+}
+
+func (remover SegmentRemover) cutSegments(ctx context.Context, fileName string, segments []Segment) error {
+	between := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		between = append(between, fmt.Sprintf("between(t,%s,%s)", formatSeconds(segment.Start), formatSeconds(segment.End)))
+	}
+
+	args := []string{"-af", fmt.Sprintf("aselect='not(%s)',asetpts=N/SR/TB", strings.Join(between, "+"))}
+	if remover.quality != "" {
+		args = append(args, "-q:a", remover.quality)
+	}
+
+	return runFfmpeg(ctx, remover.cmdBuilder, "remove segments from", fileName, fileName, args...)
+}
+
+func (remover SegmentRemover) loadState() (map[string][]Segment, error) {
+	stateBytes, err := ioutil.ReadFile(remover.StateFile())
+	if os.IsNotExist(err) {
+		return map[string][]Segment{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read segments state: %v", err)
+	}
+
+	state := map[string][]Segment{}
+	err = json.Unmarshal(stateBytes, &state)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse segments state %s: %v", remover.StateFile(), err)
+	}
+
+	return state, nil
+}
+
+// saveState writes the segments state, dropping any files that no longer exist
+func (remover SegmentRemover) saveState(state map[string][]Segment) error {
+	for fileName := range state {
+		if !fileExists(filepath.Join(remover.outputFolder, fileName)) {
+			delete(state, fileName)
+		}
+	}
+
+	stateBytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(remover.StateFile(), stateBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write segments state: %v", err)
+	}
+
+	return nil
+}
+
+// mergeSegments sorts the segments and joins the ones that overlap so nothing is removed twice
+func mergeSegments(segments []Segment) []Segment {
+	sorted := make([]Segment, 0, len(segments))
+	for _, segment := range segments {
+		if segment.End > segment.Start {
+			sorted = append(sorted, segment)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	merged := make([]Segment, 0, len(sorted))
+	for _, segment := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && segment.Start <= merged[last].End {
+			if segment.End > merged[last].End {
+				merged[last].End = segment.End
+			}
+
+			continue
+		}
+
+		merged = append(merged, segment)
+	}
+
+	return merged
+}
+
+// removeSegmentsFromChapters moves each chapter back by the time removed before it.
+// A chapter that started inside a removed segment starts where the segment was and is replaced by any later chapter that lands there too.
+func removeSegmentsFromChapters(chapters []Chapter, segments []Segment) []Chapter {
+	if chapters == nil {
+		return nil
+	}
+
+	moved := make([]Chapter, 0, len(chapters))
+	for _, chapter := range chapters {
+		chapter.Start = removeSegmentsFromTime(chapter.Start, segments).Round(time.Second)
+		if len(moved) != 0 && moved[len(moved)-1].Start >= chapter.Start {
+			moved[len(moved)-1] = chapter
+			continue
+		}
+
+		moved = append(moved, chapter)
+	}
+
+	return moved
+}
+
+// removeSegmentsFromCues moves each cue back by the time removed before it and drops the cues that were entirely removed
+func removeSegmentsFromCues(cues []cue, segments []Segment) []cue {
+	moved := make([]cue, 0, len(cues))
+	for _, current := range cues {
+		current.start = removeSegmentsFromTime(current.start, segments)
+		current.end = removeSegmentsFromTime(current.end, segments)
+		if current.end > current.start {
+			moved = append(moved, current)
+		}
+	}
+
+	return moved
+}
+
+// removeSegmentsFromTime maps a time in the original file to the same moment in the file with segments removed.
+// A time inside a removed segment maps to where the segment was.
+func removeSegmentsFromTime(original time.Duration, segments []Segment) time.Duration {
+	moved := original
+	for _, segment := range segments {
+		segmentStart := secondsToDuration(segment.Start)
+		if original <= segmentStart {
+			break
+		}
+
+		removed := secondsToDuration(segment.End) - segmentStart
+		if original < secondsToDuration(segment.End) {
+			removed = original - segmentStart
+		}
+
+		moved -= removed
+	}
+
+	return moved
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
@@ -0,0 +1,272 @@
+package command_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+const skipSegmentsResponse = `[
+	{"category": "sponsor", "actionType": "skip", "segment": [60, 90], "UUID": "a"},
+	{"category": "sponsor", "actionType": "mute", "segment": [100, 110], "UUID": "b"},
+	{"category": "interaction", "actionType": "skip", "segment": [305.5, 320], "UUID": "c"}
+]`
+
+type stubSegmentSource struct {
+	segments []command.Segment
+	err      error
+}
+
+func (source stubSegmentSource) Segments(_ context.Context, videoID string) ([]command.Segment, error) {
+	return source.segments, source.err
+}
+
+func TestSponsorBlockSegments(t *testing.T) {
+	ts := getSponsorBlockServer()
+	defer ts.Close()
+	sponsorBlock := command.NewSponsorBlock(ts.URL+"/", []string{"sponsor", "interaction"}, http.DefaultClient)
+	segments, err := sponsorBlock.Segments(context.Background(), "vId1")
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]command.Segment{{Start: 60, End: 90, Category: "sponsor"}, {Start: 305.5, End: 320, Category: "interaction"}},
+		segments,
+	)
+	segments, err = sponsorBlock.Segments(context.Background(), "vId2")
+	assert.Nil(t, err)
+	assert.Nil(t, segments)
+}
+
+func TestSponsorBlockSegmentsError(t *testing.T) {
+	ts := getSponsorBlockServer()
+	defer ts.Close()
+	_, err := command.NewSponsorBlock(ts.URL, []string{"sponsor"}, http.DefaultClient).Segments(context.Background(), "broken")
+	assert.EqualError(t, err, "could not fetch segments for broken: 500 Internal Server Error")
+	_, err = command.NewSponsorBlock(ts.URL, []string{"sponsor"}, http.DefaultClient).Segments(context.Background(), "invalid")
+	assert.EqualError(t, err, "could not parse segments for invalid: unexpected EOF")
+}
+
+func TestSponsorBlockSegmentsCanceled(t *testing.T) {
+	ts := getSponsorBlockServer()
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := command.NewSponsorBlock(ts.URL, []string{"sponsor"}, nil).Segments(ctx, "vId1")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not fetch segments for vId1: ")
+	assert.Contains(t, err.Error(), "context canceled")
+}
+
+func TestSegmentRemoverProcess(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	fileName := fmt.Sprintf("%s/t-vId1.mp3", outputFolder)
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s -map 0 -map_metadata 0 -c:v copy "+
+						"-af aselect='not(between(t,60,100)+between(t,305.5,320))',asetpts=N/SR/TB -q:a 0 %s/t-vId1.processing.mp3",
+					fileName,
+					outputFolder,
+				),
+				"",
+				0,
+			),
+		},
+	}
+	cb.ExpectedCommands[0].Closure = writeProcessedFile(t)
+	source := stubSegmentSource{
+		segments: []command.Segment{
+			{Start: 305.5, End: 320, Category: "interaction"},
+			{Start: 60, End: 90, Category: "sponsor"},
+			{Start: 80, End: 100, Category: "selfpromo"},
+		},
+	}
+	remover := command.NewSegmentRemover(cb, outputFolder, source, "0")
+	item := videoData1
+	item.Duration = "00:10:00"
+	item.Chapters = []command.Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 60 * time.Second, Title: "Sponsor"},
+		{Start: 100 * time.Second, Title: "Topic"},
+		{Start: 310 * time.Second, Title: "Subscribe"},
+		{Start: 400 * time.Second, Title: "Wrap up"},
+	}
+	assert.Nil(t, remover.Process(context.Background(), &item, fileName))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assertFileContents(t, fileName, "processed")
+	assert.Equal(t, "", item.Duration)
+	expectedChapters := []command.Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 60 * time.Second, Title: "Topic"},
+		{Start: 266 * time.Second, Title: "Subscribe"},
+		{Start: 346 * time.Second, Title: "Wrap up"},
+	}
+	assert.Equal(t, expectedChapters, item.Chapters)
+	assertFileContents(
+		t,
+		remover.StateFile(),
+		"{\n  \"t-vId1.mp3\": [\n    {\n      \"start\": 60,\n      \"end\": 100,\n      \"category\": \"sponsor\"\n    },\n"+
+			"    {\n      \"start\": 305.5,\n      \"end\": 320,\n      \"category\": \"interaction\"\n    }\n  ]\n}",
+	)
+
+	// Later runs parse the original chapters again and move them with the recorded segments
+	item.Chapters = []command.Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 60 * time.Second, Title: "Sponsor"},
+		{Start: 100 * time.Second, Title: "Topic"},
+		{Start: 310 * time.Second, Title: "Subscribe"},
+		{Start: 400 * time.Second, Title: "Wrap up"},
+	}
+	assert.Nil(t, remover.AdjustItems([]*command.VideoData{&item, &videoData2}))
+	assert.Equal(t, expectedChapters, item.Chapters)
+}
+
+func TestSegmentRemoverAdjustItemsRemovedFile(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	// A download that failed a later post processor was removed but its segments were already recorded
+	writeOutputFiles(t, outputFolder)
+	require.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/.feedTube-segments.json", outputFolder), []byte(`{"t-vId1.mp3": [{"start": 60, "end": 100}]}`), 0644))
+	fileName := fmt.Sprintf("%s/t-vId1.mp3", outputFolder)
+	cb := &runner.Test{ExpectedCommands: []*runner.ExpectedCommand{runner.NewExpectedCommand("", "/usr/bin/ffmpeg .*", "", 0)}}
+	cb.ExpectedCommands[0].Closure = writeProcessedFile(t)
+	remover := command.NewSegmentRemover(cb, outputFolder, stubSegmentSource{segments: []command.Segment{{Start: 60, End: 100}}}, "")
+	item := videoData1
+	item.Chapters = []command.Chapter{{Start: 0, Title: "Intro"}, {Start: 200 * time.Second, Title: "Topic"}}
+	assert.Nil(t, remover.AdjustItems([]*command.VideoData{&item}))
+	assert.Equal(t, []command.Chapter{{Start: 0, Title: "Intro"}, {Start: 200 * time.Second, Title: "Topic"}}, item.Chapters)
+
+	// The chapters are only moved once when the file is downloaded again
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	assert.Nil(t, remover.Process(context.Background(), &item, fileName))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, []command.Chapter{{Start: 0, Title: "Intro"}, {Start: 160 * time.Second, Title: "Topic"}}, item.Chapters)
+}
+
+func TestSegmentRemoverProcessNoSegments(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	cb := &runner.Test{}
+	remover := command.NewSegmentRemover(cb, outputFolder, stubSegmentSource{}, "0")
+	item := videoData1
+	item.Duration = "00:10:00"
+	assert.Nil(t, remover.Process(context.Background(), &item, fmt.Sprintf("%s/t-vId1.mp3", outputFolder)))
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "00:10:00", item.Duration)
+	assertFileContents(t, remover.StateFile(), "{\n  \"t-vId1.mp3\": []\n}")
+}
+
+func TestSegmentRemoverProcessSourceError(t *testing.T) {
+	remover := command.NewSegmentRemover(&runner.Test{}, getOutputFolder(), stubSegmentSource{err: errors.New("source failed")}, "0")
+	assert.EqualError(t, remover.Process(context.Background(), &videoData1, "t-vId1.mp3"), "source failed")
+}
+
+func TestSegmentRemoverFfmpegFailure(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	fileName := fmt.Sprintf("%s/t-vId1.mp3", outputFolder)
+	params := fmt.Sprintf(
+		"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s -map 0 -map_metadata 0 -c:v copy "+
+			"-af aselect='not(between(t,1,2))',asetpts=N/SR/TB %s/t-vId1.processing.mp3",
+		fileName,
+		outputFolder,
+	)
+	cb := &runner.Test{ExpectedCommands: []*runner.ExpectedCommand{newExpectedFfmpegCommand(params, "ffmpeg failed", 1)}}
+	remover := command.NewSegmentRemover(cb, outputFolder, stubSegmentSource{segments: []command.Segment{{Start: 1, End: 2}}}, "")
+	err := remover.Process(context.Background(), &videoData1, fileName)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("could not remove segments from %s: exit status 1", fileName))
+	assertFileContents(t, fileName, "content")
+}
+
+func TestSegmentRemoverInvalidState(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, ".feedTube-segments.json")
+	remover := command.NewSegmentRemover(&runner.Test{}, outputFolder, stubSegmentSource{}, "0")
+	assert.EqualError(
+		t,
+		remover.AdjustItems([]*command.VideoData{&videoData1}),
+		fmt.Sprintf("could not parse segments state %s/.feedTube-segments.json: invalid character 'c' looking for beginning of value", outputFolder),
+	)
+}
+
+func TestCmdChannelSponsorBlock(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	responses := getDefaultChannelResponses()
+	responses["/api/skipSegments?categories=%5B%22sponsor%22%5D&videoID=vId2"] = `[{"category": "sponsor", "actionType": "skip", "segment": [5, 10.25]}]`
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, _, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.String("sponsorBlock", "sponsor", "doc")
+	set.String("sponsorBlockURL", ts.URL, "doc")
+	cb := getFfprobeRunner()
+	cb.ExpectedCommands[0].Closure = func(string) {
+		writeOutputFiles(t, outputFolder, "t2-vId2.mp3")
+	}
+	cutCommand := newExpectedFfmpegCommand(
+		fmt.Sprintf(
+			"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t2-vId2.mp3 -map 0 -map_metadata 0 -c:v copy "+
+				"-af aselect='not(between(t,5,10.25))',asetpts=N/SR/TB -q:a 0 %s/t2-vId2.processing.mp3",
+			outputFolder,
+			outputFolder,
+		),
+		"",
+		0,
+	)
+	cutCommand.Closure = writeProcessedFile(t)
+	cb.ExpectedCommands = append(
+		cb.ExpectedCommands[:1],
+		cutCommand,
+		cb.ExpectedCommands[1],
+		runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t2-vId2.mp3", outputFolder), "Duration: 00:04:50.00, start", 0),
+	)
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assertFileContents(
+		t,
+		fmt.Sprintf("%s/.feedTube-segments.json", outputFolder),
+		"{\n  \"t2-vId2.mp3\": [\n    {\n      \"start\": 5,\n      \"end\": 10.25,\n      \"category\": \"sponsor\"\n    }\n  ]\n}",
+	)
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	require.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), "<itunes:duration>00:04:50</itunes:duration>")
+}
+
+func getSponsorBlockServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/api/skipSegments?categories=%5B%22sponsor%22%2C%22interaction%22%5D&videoID=vId1":
+			fmt.Fprint(w, skipSegmentsResponse)
+		case "/api/skipSegments?categories=%5B%22sponsor%22%2C%22interaction%22%5D&videoID=vId2":
+			http.NotFound(w, r)
+		case "/api/skipSegments?categories=%5B%22sponsor%22%5D&videoID=invalid":
+			fmt.Fprint(w, "[{")
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+}
@@ -0,0 +1,147 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/guywithnose/runner"
+)
+
+// PostProcessor handles a freshly downloaded file before it is added to the feed
+type PostProcessor interface {
+	Process(ctx context.Context, item *VideoData, fileName string) error
+}
+
+// Tags holds the metadata embedded into a downloaded audio file
+type Tags struct {
+	Title       string
+	Artist      string
+	Album       string
+	Date        time.Time
+	Track       int
+	Comment     string
+	Artwork     []byte
+	ArtworkMIME string
+	Chapters    []Chapter
+	Duration    time.Duration
+}
+
+// Tagger embeds the video metadata and thumbnail into downloaded audio files
+type Tagger struct {
+	cmdBuilder    runner.Builder
+	info          *ChannelInfo
+	client        *http.Client
+	embedChapters bool
+}
+
+// NewTagger returns a Tagger that uses client to fetch artwork.  embedChapters adds the item chapters to mp3 files.
+// cmdBuilder runs ffprobe to find where the last chapter ends.  A nil client uses one that gives up on downloads after imageTimeout.
+func NewTagger(cmdBuilder runner.Builder, info *ChannelInfo, client *http.Client, embedChapters bool) *Tagger {
+	return &Tagger{cmdBuilder: cmdBuilder, info: info, client: getImageClient(client), embedChapters: embedChapters}
+}
+
+// Process writes the tags for item into fileName.  Nothing is written once ctx is done.
+func (tagger Tagger) Process(ctx context.Context, item *VideoData, fileName string) error {
+	tags, err := tagger.getTags(ctx, item, fileName)
+	if err != nil {
+		return err
+	}
+
+	// A canceled artwork fetch is ignored like any other so it is caught here
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return WriteTags(fileName, tags)
+}
+
+func (tagger Tagger) getTags(ctx context.Context, item *VideoData, fileName string) (Tags, error) {
+	tags := Tags{
+		Title:   item.Title,
+		Artist:  item.Author,
+		Album:   tagger.info.Title,
+		Date:    item.PubDate,
+		Track:   item.Episode,
+		Comment: item.Link,
+	}
+
+	if tags.Artist == "" {
+		tags.Artist = tagger.info.Title
+	}
+
+	if tagger.embedChapters && len(item.Chapters) > 0 {
+		tags.Chapters = item.Chapters
+		duration := item.Duration
+		if duration == "" {
+			// The duration is only known once ffprobe has looked at the downloaded file
+			var err error
+			duration, err = probeDuration(ctx, tagger.cmdBuilder, fileName)
+			if err != nil {
+				return Tags{}, fmt.Errorf("could not tag %s: %v", fileName, err)
+			}
+		}
+
+		tags.Duration, _ = parseDuration(duration)
+	}
+
+	image := item.Image
+	if image == "" {
+		image = tagger.info.Thumbnail
+	}
+
+	// Artwork is a nice to have so a missing thumbnail doesn't stop the file from being tagged
+	tags.Artwork, tags.ArtworkMIME, _ = fetchImage(ctx, tagger.client, image)
+	return tags, nil
+}
+
+// WriteTags embeds tags into fileName, replacing any existing tags.  The format is chosen by the file extension.
+func WriteTags(fileName string, tags Tags) error {
+	var err error
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".mp3":
+		err = rewriteFile(fileName, func(in *os.File, out *os.File) error { return writeID3File(in, out, tags) })
+	case ".m4a", ".mp4":
+		err = rewriteFile(fileName, func(in *os.File, out *os.File) error { return writeMP4File(in, out, tags) })
+	default:
+		return fmt.Errorf("could not tag %s: unsupported file type", fileName)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not tag %s: %v", fileName, err)
+	}
+
+	return nil
+}
+
+// rewriteFile writes a new version of fileName next to it and swaps it in once it is complete
+func rewriteFile(fileName string, rewrite func(in *os.File, out *os.File) error) error {
+	in, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = in.Close() }()
+	tempFileName := fmt.Sprintf("%s.tmp", fileName)
+	out, err := os.Create(tempFileName)
+	if err != nil {
+		return err
+	}
+
+	err = rewrite(in, out)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tempFileName)
+		return err
+	}
+
+	return os.Rename(tempFileName, fileName)
+}
@@ -0,0 +1,162 @@
+package command_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+)
+
+var pngArtwork = []byte("\x89PNG\r\n\x1a\nartwork")
+
+func TestTaggerProcess(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	fileName := writeAudioFixture(t)
+	defer removeFile(t, fileName)
+	item := videoData1
+	item.Author = "channel"
+	item.Episode = 3
+	item.Image = fmt.Sprintf("%s/vid1Thumb.png", ts.URL)
+	info := awesomeChannelInfo
+	assert.Nil(t, command.NewTagger(&runner.Test{}, &info, http.DefaultClient, false).Process(context.Background(), &item, fileName))
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	tag := string(contents)
+	assert.True(t, strings.HasPrefix(tag, "ID3\x04"))
+	assert.Contains(t, tag, "TIT2\x00\x00\x00\x02\x00\x00\x03t")
+	assert.Contains(t, tag, "TPE1\x00\x00\x00\x08\x00\x00\x03channel")
+	assert.Contains(t, tag, "TALB\x00\x00\x00\x02\x00\x00\x03t")
+	assert.Contains(t, tag, "TDRC\x00\x00\x00\x0b\x00\x00\x032007-01-02")
+	assert.Contains(t, tag, "TRCK\x00\x00\x00\x02\x00\x00\x033")
+	assert.Contains(t, tag, "COMM\x00\x00\x00\x1a\x00\x00\x03eng\x00https://youtu.be/vId1")
+	assert.Contains(t, tag, "APIC\x00\x00\x00\x1c\x00\x00\x03image/png\x00\x03\x00"+string(pngArtwork))
+	assert.True(t, strings.HasSuffix(tag, "\xff\xfbaudio"))
+}
+
+func TestTaggerProcessFallsBackToFeedData(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	fileName := writeAudioFixture(t)
+	defer removeFile(t, fileName)
+	item := videoData2
+	info := awesomeChannelInfo
+	info.Title = "feed"
+	info.Thumbnail = fmt.Sprintf("%s/channelThumb.png", ts.URL)
+	assert.Nil(t, command.NewTagger(&runner.Test{}, &info, http.DefaultClient, false).Process(context.Background(), &item, fileName))
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), "TPE1\x00\x00\x00\x05\x00\x00\x03feed")
+	assert.Contains(t, string(contents), "APIC")
+	assert.NotContains(t, string(contents), "TRCK")
+}
+
+func TestTaggerProcessMissingArtwork(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	fileName := writeAudioFixture(t)
+	defer removeFile(t, fileName)
+	item := videoData1
+	item.Image = fmt.Sprintf("%s/missing.png", ts.URL)
+	info := awesomeChannelInfo
+	assert.Nil(t, command.NewTagger(&runner.Test{}, &info, http.DefaultClient, false).Process(context.Background(), &item, fileName))
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), "TIT2")
+	assert.NotContains(t, string(contents), "APIC")
+}
+
+func TestTaggerProcessUnsupportedArtwork(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	fileName := writeAudioFixture(t)
+	defer removeFile(t, fileName)
+	item := videoData1
+	item.Image = fmt.Sprintf("%s/thumb.gif", ts.URL)
+	info := awesomeChannelInfo
+	assert.Nil(t, command.NewTagger(&runner.Test{}, &info, http.DefaultClient, false).Process(context.Background(), &item, fileName))
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(contents), "APIC")
+}
+
+func TestTaggerProcessEmbedChapters(t *testing.T) {
+	fileName := writeAudioFixture(t)
+	defer removeFile(t, fileName)
+	item := videoData2
+	item.Chapters = []command.Chapter{{Start: 0, Title: "Intro"}, {Start: time.Minute, Title: "Topic"}}
+	info := awesomeChannelInfo
+	assert.Nil(t, command.NewTagger(&runner.Test{}, &info, http.DefaultClient, false).Process(context.Background(), &item, fileName))
+	contents, err := ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(contents), "CTOC")
+	// The duration isn't known yet when a fresh download is tagged so the file is probed for the end of the last chapter
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s", fileName), "Duration: 00:02:00.00, start", 0),
+		},
+	}
+	assert.Nil(t, command.NewTagger(cb, &info, http.DefaultClient, true).Process(context.Background(), &item, fileName))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	contents, err = ioutil.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), "CTOC\x00\x00\x00\x10\x00\x00toc\x00\x03\x02chp0\x00chp1\x00")
+	assert.Contains(t, string(contents), "CHAP\x00\x00\x00\x25\x00\x00chp1\x00\x00\x00\xea\x60\x00\x01\xd4\xc0")
+	assert.True(t, strings.HasSuffix(string(contents), "\xff\xfbaudio"))
+}
+
+func TestTaggerProcessCanceled(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	fileName := writeAudioFixture(t)
+	defer removeFile(t, fileName)
+	item := videoData1
+	item.Image = fmt.Sprintf("%s/vid1Thumb.png", ts.URL)
+	info := awesomeChannelInfo
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, command.NewTagger(&runner.Test{}, &info, nil, false).Process(ctx, &item, fileName))
+	assertFileContents(t, fileName, "\xff\xfbaudio")
+}
+
+func TestTaggerProcessEmbedChaptersProbeError(t *testing.T) {
+	fileName := writeAudioFixture(t)
+	defer removeFile(t, fileName)
+	item := videoData2
+	item.Chapters = []command.Chapter{{Start: 0, Title: "Intro"}}
+	info := awesomeChannelInfo
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s", fileName), "garbage", 0)},
+	}
+	err := command.NewTagger(cb, &info, http.DefaultClient, true).Process(context.Background(), &item, fileName)
+	assert.EqualError(t, err, fmt.Sprintf("could not tag %s: could not parse duration from output: garbage", fileName))
+}
+
+func getArtworkServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vid1Thumb.png", "/channelThumb.png":
+			_, _ = w.Write(pngArtwork)
+		case "/thumb.gif":
+			_, _ = w.Write([]byte("GIF89a"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func writeAudioFixture(t *testing.T) string {
+	fileName := fmt.Sprintf("%s/t-vId1.mp3", os.TempDir())
+	assert.Nil(t, ioutil.WriteFile(fileName, []byte("\xff\xfbaudio"), 0644))
+	return fileName
+}
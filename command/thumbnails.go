@@ -0,0 +1,229 @@
+package command
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/guywithnose/runner"
+)
+
+const (
+	minArtworkSize = 1400
+	maxArtworkSize = 3000
+	coverFileName  = "cover"
+)
+
+// imageTimeout bounds each image download so a stalled image host can't hold up a run
+const imageTimeout = 30 * time.Second
+
+var imageExtensions = map[string]string{"image/jpeg": ".jpg", "image/png": ".png"}
+
+// squareFilters are the ffmpeg filters that make an image square before it is scaled into the size Apple requires
+var squareFilters = map[string]string{
+	"crop": "crop='min(iw,ih)':'min(iw,ih)'",
+	"pad":  "pad='max(iw,ih)':'max(iw,ih)':'(ow-iw)/2':'(oh-ih)/2'",
+}
+
+// ImageLocalizer downloads the channel and video artwork into the output folder so it is served next to the media
+type ImageLocalizer struct {
+	cmdBuilder   runner.Builder
+	client       *http.Client
+	outputFolder string
+	baseURL      string
+	square       string
+}
+
+// NewImageLocalizer returns a new ImageLocalizer.  square can be crop or pad to make the images square, or empty to keep them as they are.
+// A nil client uses one that gives up on downloads after imageTimeout.
+func NewImageLocalizer(cmdBuilder runner.Builder, client *http.Client, outputFolder, baseURL, square string) (*ImageLocalizer, error) {
+	if _, ok := squareFilters[square]; square != "" && !ok {
+		return nil, fmt.Errorf("invalid square mode %s: must be crop or pad", square)
+	}
+
+	return &ImageLocalizer{
+		cmdBuilder:   cmdBuilder,
+		client:       getImageClient(client),
+		outputFolder: outputFolder,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		square:       square,
+	}, nil
+}
+
+// Localize points the channel and item images at local copies, downloading the ones that aren't in the output folder yet.
+// Images that can't be downloaded keep their original URL.  The downloads stop when ctx is done.
+func (localizer ImageLocalizer) Localize(ctx context.Context, info *ChannelInfo, items []*VideoData) error {
+	return localizer.localizeAll(ctx, info, items, true)
+}
+
+// LocalizeExisting points the channel and item images at the local copies already in the output folder without downloading or writing anything.
+// Dry runs use it so the images that are already local don't show up as changes or unrelated files.
+func (localizer ImageLocalizer) LocalizeExisting(info *ChannelInfo, items []*VideoData) {
+	_ = localizer.localizeAll(context.Background(), info, items, false)
+}
+
+func (localizer ImageLocalizer) localizeAll(ctx context.Context, info *ChannelInfo, items []*VideoData, download bool) error {
+	if info.Thumbnail != "" {
+		hash := sha256.Sum256([]byte(info.Thumbnail))
+		// The name follows the source so a new channel image replaces the old one
+		thumbnail, err := localizer.localize(ctx, fmt.Sprintf("%s-%x", coverFileName, hash[:4]), info.Thumbnail, download)
+		if err != nil {
+			return err
+		}
+
+		info.Thumbnail = thumbnail
+	}
+
+	for _, item := range items {
+		if item.Image == "" {
+			continue
+		}
+
+		image, err := localizer.localize(ctx, item.FileName, item.Image, download)
+		if err != nil {
+			return err
+		}
+
+		item.Image = image
+	}
+
+	return nil
+}
+
+// LocalFiles returns the files in the output folder that the images of info and items point at
+func (localizer ImageLocalizer) LocalFiles(info *ChannelInfo, items []*VideoData) []string {
+	urls := []string{info.Thumbnail}
+	for _, item := range items {
+		urls = append(urls, item.Image)
+	}
+
+	fileNames := make([]string, 0, len(urls))
+	for _, imageURL := range urls {
+		if strings.HasPrefix(imageURL, localizer.baseURL+"/") {
+			fileNames = append(fileNames, filepath.Join(localizer.outputFolder, strings.TrimPrefix(imageURL, localizer.baseURL+"/")))
+		}
+	}
+
+	return getAbsolutePaths(fileNames...)
+}
+
+func (localizer ImageLocalizer) localize(ctx context.Context, name, imageURL string, download bool) (string, error) {
+	for _, extension := range []string{imageExtensions["image/jpeg"], imageExtensions["image/png"]} {
+		if fileExists(filepath.Join(localizer.outputFolder, name+extension)) {
+			return localizer.getURL(name + extension), nil
+		}
+	}
+
+	if !download {
+		return imageURL, nil
+	}
+
+	image, mimeType, err := fetchImage(ctx, localizer.client, imageURL)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	// Hot linking the original image is better than no image
+	if err != nil || image == nil {
+		return imageURL, nil
+	}
+
+	fileName := filepath.Join(localizer.outputFolder, name+imageExtensions[mimeType])
+	if localizer.square != "" {
+		fileName = filepath.Join(localizer.outputFolder, name+imageExtensions["image/jpeg"])
+		err = localizer.squareImage(image, fileName)
+	} else {
+		err = ioutil.WriteFile(fileName, image, 0644)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return localizer.getURL(filepath.Base(fileName)), nil
+}
+
+// squareImage crops or pads image into a square jpeg between 1400 and 3000 pixels wide
+func (localizer ImageLocalizer) squareImage(image []byte, fileName string) error {
+	sourceFileName := fmt.Sprintf("%s.download", fileName)
+	err := ioutil.WriteFile(sourceFileName, image, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %v", sourceFileName, err)
+	}
+
+	defer func() { _ = os.Remove(sourceFileName) }()
+	size := fmt.Sprintf("'min(%d,max(%d,iw))'", maxArtworkSize, minArtworkSize)
+	params := []string{
+		"/usr/bin/ffmpeg",
+		"-y",
+		"-hide_banner",
+		"-nostats",
+		"-i",
+		sourceFileName,
+		"-vf",
+		fmt.Sprintf("%s,scale=%s:%s", squareFilters[localizer.square], size, strings.Replace(size, "iw", "ih", 1)),
+		"-q:v",
+		"2",
+		fileName,
+	}
+	out, err := localizer.cmdBuilder.New("", params...).CombinedOutput()
+	if err != nil {
+		_ = os.Remove(fileName)
+		return fmt.Errorf("could not square %s: %v\nParams: '%s': %s", fileName, err, strings.Join(params, "' '"), string(out))
+	}
+
+	return nil
+}
+
+func (localizer ImageLocalizer) getURL(fileName string) string {
+	return fmt.Sprintf("%s/%s", localizer.baseURL, fileName)
+}
+
+// getImageClient returns client, or a client with imageTimeout when it is nil
+func getImageClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: imageTimeout}
+	}
+
+	return client
+}
+
+// fetchImage downloads a jpeg or png image, giving up when ctx is done
+func fetchImage(ctx context.Context, client *http.Client, imageURL string) ([]byte, string, error) {
+	if imageURL == "" {
+		return nil, "", nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("could not fetch image %s: %s", imageURL, resp.Status)
+	}
+
+	image, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mimeType := http.DetectContentType(image)
+	if _, ok := imageExtensions[mimeType]; !ok {
+		return nil, "", fmt.Errorf("unsupported image type %s", mimeType)
+	}
+
+	return image, mimeType, nil
+}
@@ -0,0 +1,206 @@
+package command_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+func TestImageLocalizerLocalize(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t2-vId2.jpg")
+	localizer, err := command.NewImageLocalizer(&runner.Test{}, http.DefaultClient, outputFolder, "http://foo.com/", "")
+	require.Nil(t, err)
+	info := &command.ChannelInfo{Title: "t", Thumbnail: fmt.Sprintf("%s/channelThumb.png", ts.URL)}
+	hash := sha256.Sum256([]byte(info.Thumbnail))
+	cover := fmt.Sprintf("cover-%x.png", hash[:4])
+	item1 := videoData1
+	item1.Image = fmt.Sprintf("%s/vid1Thumb.png", ts.URL)
+	item2 := videoData2
+	item2.Image = fmt.Sprintf("%s/notFetched.jpg", ts.URL)
+	missing := command.VideoData{GUID: "vId3", FileName: "t3-vId3", Image: fmt.Sprintf("%s/missing.jpg", ts.URL)}
+	items := []*command.VideoData{&item1, &item2, &missing}
+	assert.Nil(t, localizer.Localize(context.Background(), info, items))
+	assert.Equal(t, fmt.Sprintf("http://foo.com/%s", cover), info.Thumbnail)
+	assert.Equal(t, "http://foo.com/t-vId1.png", item1.Image)
+	assert.Equal(t, "http://foo.com/t2-vId2.jpg", item2.Image)
+	assert.Equal(t, fmt.Sprintf("%s/missing.jpg", ts.URL), missing.Image)
+	assertFileContents(t, fmt.Sprintf("%s/%s", outputFolder, cover), string(pngArtwork))
+	assertFileContents(t, fmt.Sprintf("%s/t-vId1.png", outputFolder), string(pngArtwork))
+	assert.Equal(
+		t,
+		[]string{
+			fmt.Sprintf("%s/%s", outputFolder, cover),
+			fmt.Sprintf("%s/t-vId1.png", outputFolder),
+			fmt.Sprintf("%s/t2-vId2.jpg", outputFolder),
+		},
+		localizer.LocalFiles(info, items),
+	)
+}
+
+func TestImageLocalizerLocalizeExisting(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t2-vId2.jpg")
+	localizer, err := command.NewImageLocalizer(&runner.Test{}, http.DefaultClient, outputFolder, "http://foo.com/", "")
+	require.Nil(t, err)
+	info := &command.ChannelInfo{Title: "t", Thumbnail: fmt.Sprintf("%s/channelThumb.png", ts.URL)}
+	item1 := videoData1
+	item1.Image = fmt.Sprintf("%s/vid1Thumb.png", ts.URL)
+	item2 := videoData2
+	item2.Image = fmt.Sprintf("%s/notFetched.jpg", ts.URL)
+	localizer.LocalizeExisting(info, []*command.VideoData{&item1, &item2})
+	assert.Equal(t, fmt.Sprintf("%s/channelThumb.png", ts.URL), info.Thumbnail)
+	assert.Equal(t, fmt.Sprintf("%s/vid1Thumb.png", ts.URL), item1.Image)
+	assert.Equal(t, "http://foo.com/t2-vId2.jpg", item2.Image)
+	files, err := ioutil.ReadDir(outputFolder)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestImageLocalizerLocalizeCanceled(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	localizer, err := command.NewImageLocalizer(&runner.Test{}, nil, outputFolder, "http://foo.com/", "")
+	require.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	item := videoData1
+	item.Image = fmt.Sprintf("%s/vid1Thumb.png", ts.URL)
+	assert.Equal(t, context.Canceled, localizer.Localize(ctx, &command.ChannelInfo{}, []*command.VideoData{&item}))
+	assert.Equal(t, fmt.Sprintf("%s/vid1Thumb.png", ts.URL), item.Image)
+	files, err := ioutil.ReadDir(outputFolder)
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(files))
+}
+
+func TestImageLocalizerSquare(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			newExpectedFfmpegCommand(
+				fmt.Sprintf(
+					"/usr/bin/ffmpeg -y -hide_banner -nostats -i %s/t-vId1.jpg.download -vf pad='max(iw,ih)':'max(iw,ih)':'(ow-iw)/2':'(oh-ih)/2',"+
+						"scale='min(3000,max(1400,iw))':'min(3000,max(1400,ih))' -q:v 2 %s/t-vId1.jpg",
+					outputFolder,
+					outputFolder,
+				),
+				"",
+				0,
+			),
+		},
+	}
+	cb.ExpectedCommands[0].Closure = writeProcessedFile(t)
+	localizer, err := command.NewImageLocalizer(cb, http.DefaultClient, outputFolder, "http://foo.com", "pad")
+	require.Nil(t, err)
+	item := videoData1
+	item.Image = fmt.Sprintf("%s/vid1Thumb.png", ts.URL)
+	assert.Nil(t, localizer.Localize(context.Background(), &command.ChannelInfo{}, []*command.VideoData{&item}))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, "http://foo.com/t-vId1.jpg", item.Image)
+	assertFileContents(t, fmt.Sprintf("%s/t-vId1.jpg", outputFolder), "processed")
+	_, err = os.Stat(fmt.Sprintf("%s/t-vId1.jpg.download", outputFolder))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestImageLocalizerSquareFailure(t *testing.T) {
+	ts := getArtworkServer()
+	defer ts.Close()
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	cb := &runner.Test{ExpectedCommands: []*runner.ExpectedCommand{runner.NewExpectedCommand("", "/usr/bin/ffmpeg .*", "ffmpeg failed", 1)}}
+	localizer, err := command.NewImageLocalizer(cb, http.DefaultClient, outputFolder, "http://foo.com", "crop")
+	require.Nil(t, err)
+	item := videoData1
+	item.Image = fmt.Sprintf("%s/vid1Thumb.png", ts.URL)
+	err = localizer.Localize(context.Background(), &command.ChannelInfo{}, []*command.VideoData{&item})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("could not square %s/t-vId1.jpg: exit status 1", outputFolder))
+	assert.Contains(t, err.Error(), "crop='min(iw,ih)':'min(iw,ih)'")
+}
+
+func TestNewImageLocalizerInvalidSquare(t *testing.T) {
+	_, err := command.NewImageLocalizer(&runner.Test{}, http.DefaultClient, getOutputFolder(), "http://foo.com", "stretch")
+	assert.EqualError(t, err, "invalid square mode stretch: must be crop or pad")
+}
+
+func TestCmdChannelLocalImages(t *testing.T) {
+	artworkServer := getArtworkServer()
+	defer artworkServer.Close()
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "cover-old.jpg")
+	responses := getDefaultChannelResponses()
+	searchURL := "/search?alt=json&channelId=awesomeChannelId&key=fakeApiKey&part=snippet&type=video"
+	searchPage := youtube.SearchListResponse{}
+	require.Nil(t, json.Unmarshal([]byte(responses[searchURL]), &searchPage))
+	searchPage.Items[1].Snippet.Thumbnails.Medium = &youtube.Thumbnail{Url: "https://images.com/vid1Medium.jpg"}
+	searchPage.Items[1].Snippet.Thumbnails.High = &youtube.Thumbnail{Url: fmt.Sprintf("%s/vid1Thumb.png", artworkServer.URL)}
+	searchBytes, err := json.Marshal(searchPage)
+	require.Nil(t, err)
+	responses[searchURL] = string(searchBytes)
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("localImages", true, "doc")
+	set.String("overrideImage", fmt.Sprintf("%s/thumb.gif", artworkServer.URL), "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := getFfprobeRunner()
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, fmt.Sprintf("Removing file: %s/cover-old.jpg\n", outputFolder), errWriter.String())
+	assertFileContents(t, fmt.Sprintf("%s/t-vId1.png", outputFolder), string(pngArtwork))
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	require.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), `<itunes:image href="http://foo.com/t-vId1.png"></itunes:image>`)
+	// Unsupported images are still hot linked
+	assert.Contains(t, string(xmlBytes), fmt.Sprintf(`<itunes:image href="%s/thumb.gif"></itunes:image>`, artworkServer.URL))
+
+	// A dry run points at the images that are already local instead of reporting them as changes or unrelated files
+	app, writer, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.Bool("localImages", true, "doc")
+	set.String("overrideImage", fmt.Sprintf("%s/thumb.gif", artworkServer.URL), "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	set.Bool("dryRun", true, "doc")
+	cb = getFfprobeRunner()
+	cb.ExpectedCommands = cb.ExpectedCommands[1:]
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(
+		t,
+		fmt.Sprintf("Would download: t2-vId2 (https://youtu.be/vId2)\nAlready downloaded: t-vId1\nFeed unchanged: %s/xmlFile\n", outputFolder),
+		writer.String(),
+	)
+	assert.Equal(t, "", errWriter.String())
+}
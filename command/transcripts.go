@@ -0,0 +1,187 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transcriptFormats are the transcript files written for each video and the types they are linked with
+var transcriptFormats = []struct {
+	extension string
+	mimeType  string
+}{
+	{extension: ".vtt", mimeType: "text/vtt"},
+	{extension: ".srt", mimeType: "application/x-subrip"},
+	{extension: ".txt", mimeType: "text/plain"},
+}
+
+var (
+	cueTimingRegex = regexp.MustCompile(`^((?:\d+:)?\d{2}:\d{2}\.\d{3})\s+-->\s+((?:\d+:)?\d{2}:\d{2}\.\d{3})`)
+	cueTagRegex    = regexp.MustCompile(`<[^>]*>`)
+)
+
+type cue struct {
+	start time.Duration
+	end   time.Duration
+	text  []string
+}
+
+func getTranscriptFileName(outputFolder string, item *VideoData, extension string) string {
+	return fmt.Sprintf("%s/%s%s", outputFolder, item.FileName, extension)
+}
+
+// ConvertTranscripts converts the subtitles youtube-dl wrote for language into WebVTT, SRT and plain text transcripts.
+// The downloaded subtitles are removed once they are converted.
+// segments holds the segments removed from each file, keyed by the file name without its folder, so the cues line up with the shorter file.
+func ConvertTranscripts(items []*VideoData, outputFolder, language string, segments map[string][]Segment) error {
+	for _, item := range items {
+		subtitleFileName := getTranscriptFileName(outputFolder, item, fmt.Sprintf(".%s.vtt", language))
+		subtitleBytes, err := ioutil.ReadFile(subtitleFileName)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("could not read subtitles: %v", err)
+		}
+
+		cues, err := parseVTT(subtitleBytes)
+		if err != nil {
+			return fmt.Errorf("could not parse subtitles %s: %v", subtitleFileName, err)
+		}
+
+		if removed := segments[filepath.Base(getFileName(outputFolder, item))]; len(removed) != 0 {
+			cues = removeSegmentsFromCues(cues, removed)
+		}
+
+		transcripts := map[string]string{".vtt": formatVTT(cues), ".srt": formatSRT(cues), ".txt": formatText(cues)}
+		for _, format := range transcriptFormats {
+			err = ioutil.WriteFile(getTranscriptFileName(outputFolder, item, format.extension), []byte(transcripts[format.extension]), 0644)
+			if err != nil {
+				return fmt.Errorf("could not write transcript: %v", err)
+			}
+		}
+
+		err = os.Remove(subtitleFileName)
+		if err != nil {
+			return fmt.Errorf("could not remove subtitles: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// parseVTT reads the cues from a WebVTT file.
+// Styling tags are dropped and lines repeated from the previous cue, which auto-captions use to scroll, are removed.
+func parseVTT(vttBytes []byte) ([]cue, error) {
+	cues := make([]cue, 0)
+	var current *cue
+	lastLine := ""
+	scanner := bufio.NewScanner(bytes.NewReader(vttBytes))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if matches := cueTimingRegex.FindStringSubmatch(line); matches != nil {
+			current = &cue{start: parseCueTime(matches[1]), end: parseCueTime(matches[2])}
+			continue
+		}
+
+		if line == "" {
+			cues = appendCue(cues, current)
+			current = nil
+			continue
+		}
+
+		if current == nil {
+			// Headers, cue identifiers, notes and styles
+			continue
+		}
+
+		text := strings.TrimSpace(html.UnescapeString(cueTagRegex.ReplaceAllString(line, "")))
+		if text == "" || text == lastLine {
+			continue
+		}
+
+		current.text = append(current.text, text)
+		lastLine = text
+	}
+
+	return appendCue(cues, current), scanner.Err()
+}
+
+// appendCue adds current to cues unless it is missing or has no text
+func appendCue(cues []cue, current *cue) []cue {
+	if current == nil || len(current.text) == 0 {
+		return cues
+	}
+
+	return append(cues, *current)
+}
+
+func parseCueTime(timestamp string) time.Duration {
+	parts := strings.Split(timestamp, ":")
+	// The regex only lets digits through
+	seconds, _ := strconv.ParseFloat(parts[len(parts)-1], 64)
+	total := time.Duration(seconds * float64(time.Second))
+	multiplier := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		value, _ := strconv.Atoi(parts[i])
+		total += time.Duration(value) * multiplier
+		multiplier *= 60
+	}
+
+	return total.Round(time.Millisecond)
+}
+
+func formatCueTime(timestamp time.Duration, separator string) string {
+	milliseconds := int64(timestamp / time.Millisecond)
+	return fmt.Sprintf(
+		"%02d:%02d:%02d%s%03d",
+		milliseconds/3600000,
+		milliseconds/60000%60,
+		milliseconds/1000%60,
+		separator,
+		milliseconds%1000,
+	)
+}
+
+func formatVTT(cues []cue) string {
+	vtt := &bytes.Buffer{}
+	vtt.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		fmt.Fprintf(vtt, "\n%s --> %s\n%s\n", formatCueTime(cue.start, "."), formatCueTime(cue.end, "."), strings.Join(cue.text, "\n"))
+	}
+
+	return vtt.String()
+}
+
+func formatSRT(cues []cue) string {
+	srt := &bytes.Buffer{}
+	for i, cue := range cues {
+		if i != 0 {
+			srt.WriteString("\n")
+		}
+
+		fmt.Fprintf(srt, "%d\n%s --> %s\n%s\n", i+1, formatCueTime(cue.start, ","), formatCueTime(cue.end, ","), strings.Join(cue.text, "\n"))
+	}
+
+	return srt.String()
+}
+
+func formatText(cues []cue) string {
+	text := &bytes.Buffer{}
+	for _, cue := range cues {
+		text.WriteString(strings.Join(cue.text, "\n"))
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
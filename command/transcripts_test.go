@@ -0,0 +1,139 @@
+package command_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/guywithnose/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+// autoCaptions mimics youtube's automatic captions which repeat the previous line as the next one scrolls in
+const autoCaptions = `WEBVTT
+Kind: captions
+Language: en
+
+00:00:00.000 --> 00:00:02.500 align:start position:0%
+hello<00:00:00.500><c> and</c><00:00:01.000><c> welcome</c>
+
+00:00:02.500 --> 00:00:05.000 align:start position:0%
+hello and welcome
+today we talk about things &amp; stuff
+
+NOTE this is ignored
+
+1:02:03.040 --> 1:02:04.000
+bye
+`
+
+func TestConvertTranscripts(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	subtitleFileName := fmt.Sprintf("%s/t-vId1.en.vtt", outputFolder)
+	require.Nil(t, ioutil.WriteFile(subtitleFileName, []byte(autoCaptions), 0644))
+	assert.Nil(t, command.ConvertTranscripts([]*command.VideoData{&videoData1, &videoData2}, outputFolder, "en", nil))
+	assertFileContents(
+		t,
+		fmt.Sprintf("%s/t-vId1.vtt", outputFolder),
+		"WEBVTT\n\n00:00:00.000 --> 00:00:02.500\nhello and welcome\n\n00:00:02.500 --> 00:00:05.000\ntoday we talk about things & stuff\n\n"+
+			"01:02:03.040 --> 01:02:04.000\nbye\n",
+	)
+	assertFileContents(
+		t,
+		fmt.Sprintf("%s/t-vId1.srt", outputFolder),
+		"1\n00:00:00,000 --> 00:00:02,500\nhello and welcome\n\n2\n00:00:02,500 --> 00:00:05,000\ntoday we talk about things & stuff\n\n"+
+			"3\n01:02:03,040 --> 01:02:04,000\nbye\n",
+	)
+	assertFileContents(t, fmt.Sprintf("%s/t-vId1.txt", outputFolder), "hello and welcome\ntoday we talk about things & stuff\nbye\n")
+	_, err := os.Stat(subtitleFileName)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(fmt.Sprintf("%s/t2-vId2.vtt", outputFolder))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConvertTranscriptsRemovedSegments(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3")
+	require.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/t-vId1.en.vtt", outputFolder), []byte(autoCaptions), 0644))
+	segments := map[string][]command.Segment{"t-vId1.mp3": {{Start: 2.5, End: 5}, {Start: 3600, End: 3601}}}
+	assert.Nil(t, command.ConvertTranscripts([]*command.VideoData{&videoData1}, outputFolder, "en", segments))
+	assertFileContents(
+		t,
+		fmt.Sprintf("%s/t-vId1.vtt", outputFolder),
+		"WEBVTT\n\n00:00:00.000 --> 00:00:02.500\nhello and welcome\n\n01:01:59.540 --> 01:02:00.500\nbye\n",
+	)
+}
+
+func TestConvertTranscriptsReadError(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(fmt.Sprintf("%s/t-vId1.en.vtt", outputFolder), 0777))
+	err := command.ConvertTranscripts([]*command.VideoData{&videoData1}, outputFolder, "en", nil)
+	assert.EqualError(t, err, fmt.Sprintf("could not read subtitles: read %s/t-vId1.en.vtt: is a directory", outputFolder))
+}
+
+func TestXMLBuilderTranscripts(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "t-vId1.vtt", "t-vId1.srt", "t-vId1.txt")
+	xmlFileName := fmt.Sprintf("%s/xmlFile", outputFolder)
+	item := videoData1
+	item.Duration = "01:10:00"
+	_, err := getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), []*command.VideoData{&item})
+	assert.Nil(t, err)
+	xmlBytes, err := ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), `xmlns:podcast="https://podcastindex.org/namespace/1.0"`)
+	assert.Contains(
+		t,
+		string(xmlBytes),
+		`<podcast:transcript url="http://foo.com/t-vId1.vtt" type="text/vtt"></podcast:transcript>
+      <podcast:transcript url="http://foo.com/t-vId1.srt" type="application/x-subrip"></podcast:transcript>
+      <podcast:transcript url="http://foo.com/t-vId1.txt" type="text/plain"></podcast:transcript>`,
+	)
+}
+
+func TestCmdChannelTranscripts(t *testing.T) {
+	outputFolder := getOutputFolder()
+	defer removeFile(t, outputFolder)
+	writeOutputFiles(t, outputFolder, "t-vId1.mp3", "vId3.srt")
+	require.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s/t-vId1.en.vtt", outputFolder), []byte(autoCaptions), 0644))
+	ts := getTestServer(getDefaultChannelResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	app, _, errWriter, set := getBaseAppAndFlagSet(t, outputFolder)
+	set.String("quality", "0", "doc")
+	set.String("transcripts", "en", "doc")
+	set.Bool("cleanupUnrelatedFiles", true, "doc")
+	cb := &runner.Test{
+		ExpectedCommands: []*runner.ExpectedCommand{
+			runner.NewExpectedCommand(
+				"",
+				fmt.Sprintf(
+					"/usr/bin/youtube-dl -x --audio-format mp3 --audio-quality 0 --write-sub --write-auto-sub --sub-lang en --sub-format vtt "+
+						"-o %s/t2-vId2.%%\\(ext\\)s https://youtu.be/vId2",
+					getOutputFolder(),
+				),
+				"video 2 output",
+				0,
+			),
+			runner.NewExpectedCommand("", fmt.Sprintf("/usr/bin/ffprobe %s/t-vId1.mp3", getOutputFolder()), "Duration: 02:13:45.22, start", 0),
+		},
+	}
+	assert.Nil(t, command.CmdChannel(cb)(cli.NewContext(app, set, nil)))
+	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
+	assert.Equal(t, []error(nil), cb.Errors)
+	assert.Equal(t, fmt.Sprintf("Removing file: %s/vId3.srt\n", outputFolder), errWriter.String())
+	assertFileContents(t, fmt.Sprintf("%s/t-vId1.txt", outputFolder), "hello and welcome\ntoday we talk about things & stuff\nbye\n")
+	xmlBytes, err := ioutil.ReadFile(fmt.Sprintf("%s/xmlFile", outputFolder))
+	require.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), `<podcast:transcript url="http://foo.com/t-vId1.vtt" type="text/vtt"></podcast:transcript>`)
+}
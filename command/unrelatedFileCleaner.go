@@ -3,6 +3,7 @@ package command
 import (
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
@@ -10,21 +11,29 @@ import (
 // DirectoryCleaner cleans up unrelated files
 type DirectoryCleaner struct {
 	outputFolder string
+	logger       *slog.Logger
 }
 
 // NewDirectoryCleaner returns a new directoryCleaner
 func NewDirectoryCleaner(outputFolder string) *DirectoryCleaner {
 	return &DirectoryCleaner{
 		outputFolder: outputFolder,
+		logger:       discardLogger,
 	}
 }
 
+// SetLogger sets the logger for removed files
+func (cleaner *DirectoryCleaner) SetLogger(logger *slog.Logger) {
+	cleaner.logger = logger
+}
+
 // CleanupUnrelatedFiles searches the outputFolder for files that are not in relatedFiles and deletes them
 func (cleaner DirectoryCleaner) CleanupUnrelatedFiles(relatedFiles []string, writer io.Writer) error {
-	unrelatedFiles := cleaner.findUnrelatedFiles(relatedFiles)
+	unrelatedFiles := cleaner.UnrelatedFiles(relatedFiles)
 
 	for _, unrelatedFile := range unrelatedFiles {
 		fmt.Fprintf(writer, "Removing file: %s\n", unrelatedFile)
+		cleaner.logger.Info("Removing unrelated file", "file", unrelatedFile)
 		err := os.Remove(unrelatedFile)
 		if err != nil {
 			return fmt.Errorf("could not remove unrelated file: %v", err)
@@ -34,7 +43,8 @@ func (cleaner DirectoryCleaner) CleanupUnrelatedFiles(relatedFiles []string, wri
 	return nil
 }
 
-func (cleaner DirectoryCleaner) findUnrelatedFiles(relatedFiles []string) []string {
+// UnrelatedFiles returns the files in the outputFolder that CleanupUnrelatedFiles would delete
+func (cleaner DirectoryCleaner) UnrelatedFiles(relatedFiles []string) []string {
 	dir, _ := os.Open(cleaner.outputFolder)
 	files, _ := dir.Readdir(-1)
 
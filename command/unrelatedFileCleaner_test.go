@@ -34,6 +34,22 @@ func TestCleanupUnrelatedFilesDoesntRemoveRelatedFiles(t *testing.T) {
 	assert.Equal(t, "", writer.String())
 }
 
+func TestUnrelatedFiles(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	defer removeFile(t, outputFolder)
+	relatedFile := fmt.Sprintf("%s/t-vId1.mp3", outputFolder)
+	unrelatedFile := fmt.Sprintf("%s/t-vId2.mp3", outputFolder)
+	for _, fileName := range []string{relatedFile, unrelatedFile} {
+		_, err := os.Create(fileName)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, []string{unrelatedFile}, command.NewDirectoryCleaner(outputFolder).UnrelatedFiles([]string{relatedFile}))
+	_, err := os.Stat(unrelatedFile)
+	assert.Nil(t, err)
+}
+
 func TestCleanupUnrelatedFilesDoesntRemoveDirectories(t *testing.T) {
 	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
 	unrelatedDirectory := fmt.Sprintf("%s/dir", outputFolder)
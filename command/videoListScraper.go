@@ -0,0 +1,234 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+const videoListBatchSize = 50
+
+// VideoListEntry is a single video in a hand curated list
+type VideoListEntry struct {
+	ID          string `json:"id"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// VideoListScraper retrieves data about an explicit list of youtube videos
+type VideoListScraper struct {
+	youtubeService *youtube.Service
+	logger         *slog.Logger
+}
+
+// NewVideoListScraper returns a VideoListScraper
+func NewVideoListScraper(apiKey string, wrappers ...TransportWrapper) *VideoListScraper {
+	youtubeService := getYoutubeService(apiKey, wrappers...)
+	return &VideoListScraper{youtubeService: youtubeService, logger: discardLogger}
+}
+
+// SetLogger sets the logger for the listed videos
+func (scraper *VideoListScraper) SetLogger(logger *slog.Logger) {
+	scraper.logger = logger
+}
+
+type videoListSource struct {
+	scraper  *VideoListScraper
+	listFile string
+}
+
+func newVideoListSource(config SourceConfig) (Source, error) {
+	scraper := NewVideoListScraper(config.APIKey, config.Transports...)
+	scraper.SetLogger(sourceLogger(config))
+	return &videoListSource{scraper: scraper, listFile: config.ID}, nil
+}
+
+// GetVideos returns the videos listed in the list file
+func (source videoListSource) GetVideos(ctx context.Context) ([]*VideoData, *ChannelInfo, error) {
+	entries, err := ReadVideoList(source.listFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items, err := source.scraper.GetVideosForList(ctx, entries)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	title := strings.TrimSuffix(filepath.Base(source.listFile), filepath.Ext(source.listFile))
+	info := &ChannelInfo{
+		Title:       title,
+		Link:        "https://www.youtube.com",
+		Description: fmt.Sprintf("Videos listed in %s", filepath.Base(source.listFile)),
+	}
+
+	return items, info, nil
+}
+
+// ReadVideoList reads a list of videos from a file.
+// The file is either a JSON array of VideoListEntry or one video ID or URL per line.
+// Blank lines and lines starting with # are ignored.
+func ReadVideoList(listFile string) ([]VideoListEntry, error) {
+	listBytes, err := ioutil.ReadFile(listFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read video list: %v", err)
+	}
+
+	listBytes = bytes.TrimSpace(listBytes)
+	if bytes.HasPrefix(listBytes, []byte("[")) {
+		return parseJSONVideoList(listFile, listBytes)
+	}
+
+	entries := make([]VideoListEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(listBytes))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		videoID, err := parseVideoID(line)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, VideoListEntry{ID: videoID})
+	}
+
+	return entries, nil
+}
+
+func parseJSONVideoList(listFile string, listBytes []byte) ([]VideoListEntry, error) {
+	entries := make([]VideoListEntry, 0)
+	err := json.Unmarshal(listBytes, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse video list %s: %v", listFile, err)
+	}
+
+	for i := range entries {
+		entries[i].ID, err = parseVideoID(entries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// parseVideoID extracts the video ID from a bare ID or a youtube.com or youtu.be URL
+func parseVideoID(video string) (string, error) {
+	if !strings.Contains(video, "/") {
+		return video, nil
+	}
+
+	videoURL, err := url.Parse(video)
+	if err != nil {
+		return "", fmt.Errorf("invalid video %s: %v", video, err)
+	}
+
+	host := strings.TrimPrefix(videoURL.Host, "www.")
+	path := strings.Trim(videoURL.Path, "/")
+	switch {
+	case host == "youtu.be" && path != "":
+		return path, nil
+	case strings.HasSuffix(host, "youtube.com") && videoURL.Query().Get("v") != "":
+		return videoURL.Query().Get("v"), nil
+	case strings.HasSuffix(host, "youtube.com") && strings.HasPrefix(path, "shorts/"):
+		return strings.TrimPrefix(path, "shorts/"), nil
+	}
+
+	return "", fmt.Errorf("could not find a video ID in %s", video)
+}
+
+// GetVideosForList returns the data for each listed video in list order.
+// Videos that youtube does not return (deleted or private) are skipped and a video listed more than once uses its first entry.
+func (scraper VideoListScraper) GetVideosForList(ctx context.Context, entries []VideoListEntry) ([]*VideoData, error) {
+	entries = uniqueEntries(entries)
+	videos := make(map[string]*youtube.Video, len(entries))
+	for start := 0; start < len(entries); start += videoListBatchSize {
+		end := start + videoListBatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		ids := make([]string, 0, end-start)
+		for _, entry := range entries[start:end] {
+			ids = append(ids, entry.ID)
+		}
+
+		resp, err := scraper.youtubeService.Videos.List("snippet").Id(strings.Join(ids, ",")).MaxResults(videoListBatchSize).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("videos request failed: %v", err)
+		}
+
+		scraper.logger.Debug("Fetched video batch", "requested", len(ids), "videos", len(resp.Items))
+		for _, video := range resp.Items {
+			videos[video.Id] = video
+		}
+	}
+
+	items := make([]*VideoData, 0, len(entries))
+	for _, entry := range entries {
+		video, ok := videos[entry.ID]
+		if !ok {
+			scraper.logger.Debug("Skipped listed video that youtube did not return", "video", entry.ID)
+			continue
+		}
+
+		item, err := parseListedVideo(entry, video)
+		if err != nil {
+			return nil, err
+		}
+
+		scraper.logger.Debug("Found video", "video", item.GUID, "title", item.Title)
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// uniqueEntries drops the entries for videos that were already listed
+func uniqueEntries(entries []VideoListEntry) []VideoListEntry {
+	seen := make(map[string]bool, len(entries))
+	unique := make([]VideoListEntry, 0, len(entries))
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			continue
+		}
+
+		seen[entry.ID] = true
+		unique = append(unique, entry)
+	}
+
+	return unique
+}
+
+func parseListedVideo(entry VideoListEntry, video *youtube.Video) (*VideoData, error) {
+	publishedTime, err := time.Parse(time.RFC3339, video.Snippet.PublishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing publish date on video %s: %v", video.Id, err)
+	}
+
+	title := video.Snippet.Title
+	if entry.Title != "" {
+		title = entry.Title
+	}
+
+	description := video.Snippet.Description
+	if entry.Description != "" {
+		description = entry.Description
+	}
+
+	return newVideoData(video.Id, title, video.Snippet.ChannelTitle, description, publishedTime, video.Snippet.Thumbnails), nil
+}
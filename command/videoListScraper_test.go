@@ -0,0 +1,197 @@
+package command_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	youtube "google.golang.org/api/youtube/v3"
+
+	"github.com/guywithnose/feedTube/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadVideoListLines(t *testing.T) {
+	listFile := writeVideoList(
+		t,
+		"# talks\nvId1\n\nhttps://youtu.be/vId2\nhttps://www.youtube.com/watch?v=vId3&t=10\nhttps://youtube.com/shorts/vId4\n",
+	)
+	defer removeFile(t, listFile)
+	entries, err := command.ReadVideoList(listFile)
+	assert.Nil(t, err)
+	assert.Equal(t, []command.VideoListEntry{{ID: "vId1"}, {ID: "vId2"}, {ID: "vId3"}, {ID: "vId4"}}, entries)
+}
+
+func TestReadVideoListJSON(t *testing.T) {
+	listFile := writeVideoList(t, `[{"id": "https://youtu.be/vId1", "title": "better title"}, {"id": "vId2", "description": "better description"}]`)
+	defer removeFile(t, listFile)
+	entries, err := command.ReadVideoList(listFile)
+	assert.Nil(t, err)
+	assert.Equal(t, []command.VideoListEntry{{ID: "vId1", Title: "better title"}, {ID: "vId2", Description: "better description"}}, entries)
+}
+
+func TestReadVideoListInvalidJSON(t *testing.T) {
+	listFile := writeVideoList(t, `[{"id": }]`)
+	defer removeFile(t, listFile)
+	_, err := command.ReadVideoList(listFile)
+	assert.EqualError(
+		t,
+		err,
+		fmt.Sprintf("could not parse video list %s: invalid character '}' looking for beginning of value", listFile),
+	)
+}
+
+func TestReadVideoListInvalidURL(t *testing.T) {
+	listFile := writeVideoList(t, "https://example.com/vId1\n")
+	defer removeFile(t, listFile)
+	_, err := command.ReadVideoList(listFile)
+	assert.EqualError(t, err, "could not find a video ID in https://example.com/vId1")
+}
+
+func TestReadVideoListMissingFile(t *testing.T) {
+	_, err := command.ReadVideoList("/notAFile")
+	assert.EqualError(t, err, "could not read video list: open /notAFile: no such file or directory")
+}
+
+func TestGetVideosForList(t *testing.T) {
+	ts := getTestServer(getDefaultVideoListResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	videoData, err := command.NewVideoListScraper("fakeApiKey").GetVideosForList(
+		context.Background(),
+		[]command.VideoListEntry{{ID: "vId2"}, {ID: "vIdDeleted"}, {ID: "vId1", Title: "better title", Description: "better description"}},
+	)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]*command.VideoData{
+			&videoData2,
+			{
+				GUID:        "vId1",
+				Link:        "https://youtu.be/vId1",
+				Title:       "better title",
+				Description: "better description https://youtu.be/vId1",
+				FileName:    "better-title-vId1",
+				Image:       "https://images.com/vid1Thumb.jpg",
+				PubDate:     time.Date(2007, time.January, 02, 15, 04, 05, 0, time.UTC),
+			},
+		},
+		videoData,
+	)
+}
+
+func TestGetVideosForListLogger(t *testing.T) {
+	ts := getTestServer(getDefaultVideoListResponses())
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	var out bytes.Buffer
+	logger, err := command.NewLogger(&out, "text", slog.LevelDebug)
+	require.Nil(t, err)
+	scraper := command.NewVideoListScraper("fakeApiKey")
+	scraper.SetLogger(logger)
+	_, err = scraper.GetVideosForList(context.Background(), []command.VideoListEntry{{ID: "vId2"}, {ID: "vIdDeleted"}, {ID: "vId1"}})
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"Fetched video batch\" requested=3 videos=2\n")
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"Skipped listed video that youtube did not return\" video=vIdDeleted\n")
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"Found video\" video=vId1 title=t\n")
+}
+
+func TestGetVideosForListDuplicates(t *testing.T) {
+	responses := getDefaultVideoListResponses()
+	// The duplicates are dropped before the videos are requested
+	responses["/videos?alt=json&id=vId2%2CvId1&key=fakeApiKey&maxResults=50&part=snippet"] =
+		responses["/videos?alt=json&id=vId1%2CvId2&key=fakeApiKey&maxResults=50&part=snippet"]
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	videoData, err := command.NewVideoListScraper("fakeApiKey").GetVideosForList(
+		context.Background(),
+		[]command.VideoListEntry{{ID: "vId2"}, {ID: "vId1"}, {ID: "vId2", Title: "later title"}, {ID: "vId1", Title: "later title"}},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []*command.VideoData{&videoData2, &videoData1}, videoData)
+}
+
+func TestGetVideosForListBatches(t *testing.T) {
+	entries := make([]command.VideoListEntry, 0, 51)
+	firstBatch := make([]string, 0, 50)
+	for i := 0; i < 51; i++ {
+		entries = append(entries, command.VideoListEntry{ID: fmt.Sprintf("v%d", i)})
+		if i < 50 {
+			firstBatch = append(firstBatch, fmt.Sprintf("v%d", i))
+		}
+	}
+
+	bytes, _ := json.Marshal(youtube.VideoListResponse{Items: []*youtube.Video{}})
+	responses := map[string]string{
+		fmt.Sprintf("/videos?alt=json&id=%s&key=fakeApiKey&maxResults=50&part=snippet", strings.Join(firstBatch, "%2C")): string(bytes),
+		"/videos?alt=json&id=v50&key=fakeApiKey&maxResults=50&part=snippet":                                              "error",
+	}
+	ts := getTestServer(responses)
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	_, err := command.NewVideoListScraper("fakeApiKey").GetVideosForList(context.Background(), entries)
+	assert.EqualError(t, err, "videos request failed: googleapi: got HTTP response code 500 with body: ")
+}
+
+func TestGetVideosForListInvalidVideo(t *testing.T) {
+	bytes, _ := json.Marshal(youtube.VideoListResponse{
+		Items: []*youtube.Video{{Id: "vId1", Snippet: &youtube.VideoSnippet{Title: "t", PublishedAt: "2006-01-02"}}},
+	})
+	ts := getTestServer(map[string]string{"/videos?alt=json&id=vId1&key=fakeApiKey&maxResults=50&part=snippet": string(bytes)})
+	defer ts.Close()
+	command.YoutubeAPIURLBase = ts.URL
+	_, err := command.NewVideoListScraper("fakeApiKey").GetVideosForList(context.Background(), []command.VideoListEntry{{ID: "vId1"}})
+	assert.EqualError(
+		t,
+		err,
+		`error parsing publish date on video vId1: parsing time "2006-01-02" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "T"`,
+	)
+}
+
+func writeVideoList(t *testing.T, contents string) string {
+	listFile := fmt.Sprintf("%s/feedTubeVideoList.txt", os.TempDir())
+	assert.Nil(t, ioutil.WriteFile(listFile, []byte(contents), 0644))
+	return listFile
+}
+
+func getDefaultVideoListResponses() map[string]string {
+	videos := youtube.VideoListResponse{
+		Items: []*youtube.Video{
+			{
+				Id: "vId1",
+				Snippet: &youtube.VideoSnippet{
+					Title:       "t",
+					Description: "d",
+					PublishedAt: "2007-01-02T15:04:05Z",
+					Thumbnails: &youtube.ThumbnailDetails{
+						Default: &youtube.Thumbnail{
+							Url: "https://images.com/vid1Thumb.jpg",
+						},
+					},
+				},
+			},
+			{
+				Id: "vId2",
+				Snippet: &youtube.VideoSnippet{
+					Title:       "t2",
+					Description: "d2",
+					PublishedAt: "2006-01-02T15:04:05Z",
+				},
+			},
+		},
+	}
+	bytes, _ := json.Marshal(videos)
+	return map[string]string{
+		"/videos?alt=json&id=vId1%2CvId2&key=fakeApiKey&maxResults=50&part=snippet":              string(bytes),
+		"/videos?alt=json&id=vId2%2CvIdDeleted%2CvId1&key=fakeApiKey&maxResults=50&part=snippet": string(bytes),
+	}
+}
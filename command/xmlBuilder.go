@@ -1,7 +1,13 @@
 package command
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/xml"
 	"fmt"
+	"io/ioutil"
+	"log/slog"
 	"os"
 	"regexp"
 	"time"
@@ -17,13 +23,53 @@ type XMLBuilder struct {
 	outputFolder string
 	baseURL      string
 	generator    string
-	feed         *podcast.Podcast
+	feed         *feedChannel
+	logger       *slog.Logger
 }
 
+// The podcast library has no support for newer itunes or podcast namespace tags, so its types are wrapped to add them
+type rssFeed struct {
+	XMLName      xml.Name `xml:"rss"`
+	Version      string   `xml:"version,attr"`
+	XMLNS        string   `xml:"xmlns:itunes,attr"`
+	PodcastXMLNS string   `xml:"xmlns:podcast,attr,omitempty"`
+	ContentXMLNS string   `xml:"xmlns:content,attr,omitempty"`
+	Channel      *feedChannel
+}
+
+type feedChannel struct {
+	podcast.Podcast
+	IType string `xml:"itunes:type,omitempty"`
+	Items []*feedItem
+}
+
+type feedItem struct {
+	podcast.Item
+	ISeason     int           `xml:"itunes:season,omitempty"`
+	IEpisode    int           `xml:"itunes:episode,omitempty"`
+	Chapters    *podcastLink  `xml:"podcast:chapters,omitempty"`
+	Transcripts []podcastLink `xml:"podcast:transcript"`
+	Content     *cdata        `xml:"content:encoded,omitempty"`
+}
+
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+type podcastLink struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+var lastBuildDateRegex = regexp.MustCompile(`(?m)^\s*<lastBuildDate>.*</lastBuildDate>\n`)
+
 // NewXMLBuilder returns a new XMLBuilder
 func NewXMLBuilder(cmdBuilder runner.Builder, xmlFileName, outputFolder, baseURL, generator string, channelInfo *ChannelInfo) *XMLBuilder {
 	now := time.Now()
-	feed := podcast.New(channelInfo.Title, channelInfo.Link, channelInfo.Description, &now, &now)
+	feed := &feedChannel{
+		Podcast: podcast.New(channelInfo.Title, channelInfo.Link, channelInfo.Description, &now, &now),
+		IType:   channelInfo.Type,
+	}
 	if channelInfo.Thumbnail != "" {
 		feed.AddImage(channelInfo.Thumbnail)
 	}
@@ -34,31 +80,72 @@ func NewXMLBuilder(cmdBuilder runner.Builder, xmlFileName, outputFolder, baseURL
 		outputFolder: outputFolder,
 		baseURL:      baseURL,
 		generator:    generator,
-		feed:         &feed,
+		feed:         feed,
+		logger:       discardLogger,
 	}
 }
 
+// SetLogger sets the logger for feed writes and ffprobe runs
+func (xmlBuilder *XMLBuilder) SetLogger(logger *slog.Logger) {
+	xmlBuilder.logger = logger
+}
+
 // BuildRss builds an RSS XML feed from an list of VideoData
-func (xmlBuilder XMLBuilder) BuildRss(items []*VideoData) error {
-	xmlBuilder.appendDataToFeed()
-	its := xmlBuilder.buildItems(items)
-	return xmlBuilder.buildXML(its)
+// The file is only written when its content changed and BuildRss reports whether it was written.
+// When ctx is done before the feed is written the existing file is left alone.
+func (xmlBuilder XMLBuilder) BuildRss(ctx context.Context, items []*VideoData) (bool, error) {
+	xmlBytes, err := xmlBuilder.buildXML(ctx, items)
+	if err != nil || !xmlBuilder.changed(xmlBytes) {
+		return false, err
+	}
+
+	xmlBuilder.logger.Info("Writing feed", "file", xmlBuilder.xmlFileName, "items", len(items))
+	return true, xmlBuilder.writeToFile(xmlBytes)
 }
 
-func (xmlBuilder XMLBuilder) appendDataToFeed() {
-	now := time.Now()
-	xmlBuilder.feed.AddLastBuildDate(&now)
+// WouldChange reports whether BuildRss would write the feed without writing it
+func (xmlBuilder XMLBuilder) WouldChange(ctx context.Context, items []*VideoData) (bool, error) {
+	xmlBytes, err := xmlBuilder.buildXML(ctx, items)
+	if err != nil {
+		return false, err
+	}
+
+	return xmlBuilder.changed(xmlBytes), nil
+}
+
+// appendDataToFeed sets the channel pubDate to the newest item so that it only moves when the content does
+func (xmlBuilder XMLBuilder) appendDataToFeed(items []*VideoData) {
+	xmlBuilder.feed.PubDate = ""
+	var newest time.Time
+	for _, item := range items {
+		if item.PubDate.After(newest) {
+			newest = item.PubDate
+			xmlBuilder.feed.AddPubDate(&newest)
+		}
+	}
+
 	xmlBuilder.feed.Generator = xmlBuilder.generator
 }
 
-func (xmlBuilder XMLBuilder) buildItems(items []*VideoData) []*podcast.Item {
-	its := make([]*podcast.Item, 0, len(items))
+func (xmlBuilder XMLBuilder) buildItems(ctx context.Context, items []*VideoData) ([]*feedItem, error) {
+	its := make([]*feedItem, 0, len(items))
 	for _, item := range items {
-		it := &podcast.Item{
-			GUID:        item.GUID,
-			Link:        item.Link,
-			Title:       item.Title,
-			Description: item.Description,
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		it := &feedItem{
+			Item: podcast.Item{
+				GUID:        item.GUID,
+				Link:        item.Link,
+				Title:       item.Title,
+				Description: item.Description,
+			},
+		}
+
+		if xmlBuilder.feed.IType == serialFeedType {
+			it.ISeason = item.Season
+			it.IEpisode = item.Episode
 		}
 
 		it.AddImage(item.Image)
@@ -66,19 +153,38 @@ func (xmlBuilder XMLBuilder) buildItems(items []*VideoData) []*podcast.Item {
 
 		length, err := getFileSize(getFileName(xmlBuilder.outputFolder, item))
 		// Fail silently since duration is not important
-		if err == nil {
-			duration, durationErr := xmlBuilder.getFileDuration(item)
+		if err == nil && item.Duration != "" {
+			it.IDuration = item.Duration
+		} else if err == nil {
+			duration, durationErr := xmlBuilder.getFileDuration(ctx, item)
 			if durationErr == nil {
 				it.IDuration = duration
 			}
 		}
 
 		it.AddEnclosure(xmlBuilder.getFileURL(item), podcast.MP3, length)
-
+		xmlBuilder.addRelatedFiles(it, item)
 		its = append(its, it)
 	}
 
-	return its
+	return its, nil
+}
+
+// addRelatedFiles links the chapters and transcripts written next to the item's file and adds its show notes
+func (xmlBuilder XMLBuilder) addRelatedFiles(it *feedItem, item *VideoData) {
+	if fileExists(getChaptersFileName(xmlBuilder.outputFolder, item)) {
+		it.Chapters = &podcastLink{URL: xmlBuilder.getRelatedFileURL(item, chaptersExtension), Type: chaptersMIMEType}
+	}
+
+	if item.ShowNotes != "" {
+		it.Content = &cdata{Text: item.ShowNotes}
+	}
+
+	for _, format := range transcriptFormats {
+		if fileExists(getTranscriptFileName(xmlBuilder.outputFolder, item, format.extension)) {
+			it.Transcripts = append(it.Transcripts, podcastLink{URL: xmlBuilder.getRelatedFileURL(item, format.extension), Type: format.mimeType})
+		}
+	}
 }
 
 func getFileSize(fileName string) (int64, error) {
@@ -90,9 +196,15 @@ func getFileSize(fileName string) (int64, error) {
 	return fileInfo.Size(), nil
 }
 
-func (xmlBuilder XMLBuilder) getFileDuration(item *VideoData) (string, error) {
-	cmd := xmlBuilder.cmdBuilder.New("", "/usr/bin/ffprobe", getFileName(xmlBuilder.outputFolder, item))
-	out, err := cmd.CombinedOutput()
+func (xmlBuilder XMLBuilder) getFileDuration(ctx context.Context, item *VideoData) (string, error) {
+	xmlBuilder.logger.Debug("Running ffprobe", "video", item.GUID)
+	return probeDuration(ctx, xmlBuilder.cmdBuilder, getFileName(xmlBuilder.outputFolder, item))
+}
+
+// probeDuration runs ffprobe on fileName and returns its duration as HH:MM:SS.  ffprobe is killed when ctx is done.
+func probeDuration(ctx context.Context, cmdBuilder runner.Builder, fileName string) (string, error) {
+	DefaultMetrics.Add(MetricFfprobeCalls, 1)
+	out, err := runCommand(ctx, cmdBuilder.New("", "/usr/bin/ffprobe", fileName))
 	if err != nil {
 		return "", err
 	}
@@ -112,36 +224,114 @@ func parseDurationOutput(out []byte) (string, error) {
 }
 
 func (xmlBuilder XMLBuilder) getFileURL(item *VideoData) string {
-	return fmt.Sprintf("%s/%s.mp3", xmlBuilder.baseURL, item.FileName)
+	return xmlBuilder.getRelatedFileURL(item, ".mp3")
 }
 
-func (xmlBuilder XMLBuilder) buildXML(items []*podcast.Item) error {
-	for _, item := range items {
-		err := xmlBuilder.addItemToFeed(item)
+func (xmlBuilder XMLBuilder) getRelatedFileURL(item *VideoData, extension string) string {
+	return fmt.Sprintf("%s/%s%s", xmlBuilder.baseURL, item.FileName, extension)
+}
+
+func (xmlBuilder XMLBuilder) buildXML(ctx context.Context, items []*VideoData) ([]byte, error) {
+	xmlBuilder.appendDataToFeed(items)
+	its, err := xmlBuilder.buildItems(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range its {
+		err = xmlBuilder.addItemToFeed(item)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return xmlBuilder.writeToFile()
+	return xmlBuilder.encode()
 }
 
-func (xmlBuilder XMLBuilder) addItemToFeed(item *podcast.Item) error {
-	numItems, err := xmlBuilder.feed.AddItem(*item)
+func (xmlBuilder XMLBuilder) addItemToFeed(item *feedItem) error {
+	numItems, err := xmlBuilder.feed.AddItem(item.Item)
 	if err != nil {
 		return fmt.Errorf("could not parse item to xml: %v", err)
 	}
 
 	// podcast library sets the GUID as the link
-	xmlBuilder.feed.Items[numItems-1].GUID = item.GUID
+	guid := item.GUID
+	item.Item = *xmlBuilder.feed.Podcast.Items[numItems-1]
+	item.GUID = guid
+	xmlBuilder.feed.Items = append(xmlBuilder.feed.Items, item)
 	return nil
 }
 
-func (xmlBuilder XMLBuilder) writeToFile() error {
-	xmlFile, err := os.Create(xmlBuilder.xmlFileName)
+// changed compares content hashes with the existing file.
+// lastBuildDate is left out of the hash so that it only changes when something else does.
+func (xmlBuilder XMLBuilder) changed(xmlBytes []byte) bool {
+	existingBytes, err := ioutil.ReadFile(xmlBuilder.xmlFileName)
+	return err != nil || contentHash(existingBytes) != contentHash(xmlBytes)
+}
+
+// writeToFile writes the feed next to the old one and renames it over it so readers never see it half written
+func (xmlBuilder XMLBuilder) writeToFile(xmlBytes []byte) error {
+	tempFileName := fmt.Sprintf("%s.tmp", xmlBuilder.xmlFileName)
+	err := ioutil.WriteFile(tempFileName, xmlBytes, 0644)
+	if pathErr, ok := err.(*os.PathError); ok {
+		// Errors name the xmlFile that was asked for rather than the temp file
+		return &os.PathError{Op: pathErr.Op, Path: xmlBuilder.xmlFileName, Err: pathErr.Err}
+	}
+
 	if err != nil {
 		return err
 	}
 
-	return xmlBuilder.feed.Encode(xmlFile)
+	err = os.Rename(tempFileName, xmlBuilder.xmlFileName)
+	if linkErr, ok := err.(*os.LinkError); ok {
+		_ = os.Remove(tempFileName)
+		return &os.PathError{Op: linkErr.Op, Path: xmlBuilder.xmlFileName, Err: linkErr.Err}
+	}
+
+	return err
+}
+
+func contentHash(xmlBytes []byte) [sha256.Size]byte {
+	return sha256.Sum256(lastBuildDateRegex.ReplaceAll(xmlBytes, nil))
+}
+
+func (xmlBuilder XMLBuilder) usesPodcastNamespace() bool {
+	for _, item := range xmlBuilder.feed.Items {
+		if item.Chapters != nil || len(item.Transcripts) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (xmlBuilder XMLBuilder) usesContentNamespace() bool {
+	for _, item := range xmlBuilder.feed.Items {
+		if item.Content != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (xmlBuilder XMLBuilder) encode() ([]byte, error) {
+	xmlBytes := bytes.NewBufferString(xml.Header)
+	encoder := xml.NewEncoder(xmlBytes)
+	encoder.Indent("", "  ")
+	feed := rssFeed{Version: "2.0", XMLNS: itunesNamespace, Channel: xmlBuilder.feed}
+	if xmlBuilder.usesPodcastNamespace() {
+		feed.PodcastXMLNS = podcastNamespace
+	}
+
+	if xmlBuilder.usesContentNamespace() {
+		feed.ContentXMLNS = contentNamespace
+	}
+
+	err := encoder.Encode(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	return xmlBytes.Bytes(), nil
 }
@@ -1,6 +1,7 @@
 package command_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -38,7 +39,7 @@ func TestXMLBuilder(t *testing.T) {
 		xmlFileName,
 		outputFolder,
 		"http://foo.com",
-		"feedTube v0.3.0 (github.com/guywithnose/feedTube)",
+		fmt.Sprintf("feedTube v%s (github.com/guywithnose/feedTube)", command.Version),
 		&command.ChannelInfo{
 			Title:       "t",
 			Description: "d",
@@ -46,7 +47,8 @@ func TestXMLBuilder(t *testing.T) {
 			Thumbnail:   "https://images.com/thumb.jpg",
 		},
 	)
-	err = xmlBuilder.BuildRss(
+	changed, err := xmlBuilder.BuildRss(
+		context.Background(),
 		[]*command.VideoData{
 			{
 				GUID:        "vId1",
@@ -69,6 +71,7 @@ func TestXMLBuilder(t *testing.T) {
 		},
 	)
 	assert.Nil(t, err)
+	assert.True(t, changed)
 	assert.Equal(t, []*runner.ExpectedCommand{}, cb.ExpectedCommands)
 	assert.Equal(t, []error(nil), cb.Errors)
 	xmlBytes, err := ioutil.ReadFile(xmlFileName)
@@ -102,7 +105,7 @@ func TestXMLBuilderGetDurationFailure(t *testing.T) {
 		xmlFileName,
 		outputFolder,
 		"http://foo.com",
-		"feedTube v0.3.0 (github.com/guywithnose/feedTube)",
+		fmt.Sprintf("feedTube v%s (github.com/guywithnose/feedTube)", command.Version),
 		&command.ChannelInfo{
 			Title:       "t",
 			Description: "d",
@@ -110,7 +113,8 @@ func TestXMLBuilderGetDurationFailure(t *testing.T) {
 			Thumbnail:   "https://images.com/thumb.jpg",
 		},
 	)
-	err = xmlBuilder.BuildRss(
+	_, err = xmlBuilder.BuildRss(
+		context.Background(),
 		[]*command.VideoData{
 			{
 				GUID:        "vId1",
@@ -165,7 +169,7 @@ func TestXMLBuilderInvalidtDuration(t *testing.T) {
 		xmlFileName,
 		outputFolder,
 		"http://foo.com",
-		"feedTube v0.3.0 (github.com/guywithnose/feedTube)",
+		fmt.Sprintf("feedTube v%s (github.com/guywithnose/feedTube)", command.Version),
 		&command.ChannelInfo{
 			Title:       "t",
 			Description: "d",
@@ -173,7 +177,8 @@ func TestXMLBuilderInvalidtDuration(t *testing.T) {
 			Thumbnail:   "https://images.com/thumb.jpg",
 		},
 	)
-	err = xmlBuilder.BuildRss(
+	_, err = xmlBuilder.BuildRss(
+		context.Background(),
 		[]*command.VideoData{
 			{
 				GUID:        "vId1",
@@ -228,7 +233,7 @@ func TestXMLBuilderInvalidtXmlFile(t *testing.T) {
 		xmlFileName,
 		outputFolder,
 		"http://foo.com",
-		"feedTube v0.3.0 (github.com/guywithnose/feedTube)",
+		fmt.Sprintf("feedTube v%s (github.com/guywithnose/feedTube)", command.Version),
 		&command.ChannelInfo{
 			Title:       "t",
 			Description: "d",
@@ -236,7 +241,8 @@ func TestXMLBuilderInvalidtXmlFile(t *testing.T) {
 			Thumbnail:   "https://images.com/thumb.jpg",
 		},
 	)
-	err = xmlBuilder.BuildRss(
+	_, err = xmlBuilder.BuildRss(
+		context.Background(),
 		[]*command.VideoData{
 			{
 				GUID:        "vId1",
@@ -284,7 +290,7 @@ func TestXMLBuilderInvalidVideo(t *testing.T) {
 		xmlFileName,
 		outputFolder,
 		"http://foo.com",
-		"feedTube v0.3.0 (github.com/guywithnose/feedTube)",
+		fmt.Sprintf("feedTube v%s (github.com/guywithnose/feedTube)", command.Version),
 		&command.ChannelInfo{
 			Title:       "t",
 			Description: "d",
@@ -292,7 +298,8 @@ func TestXMLBuilderInvalidVideo(t *testing.T) {
 			Thumbnail:   "https://images.com/thumb.jpg",
 		},
 	)
-	err = xmlBuilder.BuildRss(
+	_, err = xmlBuilder.BuildRss(
+		context.Background(),
 		[]*command.VideoData{
 			{
 				GUID:        "vId1",
@@ -316,3 +323,119 @@ func TestXMLBuilderInvalidVideo(t *testing.T) {
 	)
 	assert.EqualError(t, err, "could not parse item to xml: Title and Description are reuired")
 }
+
+func TestXMLBuilderUnchanged(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFileName := fmt.Sprintf("%s/xmlFile", outputFolder)
+	items := []*command.VideoData{
+		{
+			GUID:        "vId1",
+			Link:        "https://youtu.be/vId1",
+			Title:       "t",
+			Description: "d https://youtu.be/vId1",
+			FileName:    "t-vId1",
+			PubDate:     time.Date(2007, 1, 2, 15, 4, 5, 0, time.UTC),
+		},
+	}
+	changed, err := getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), items)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	xmlBytes, err := ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	xmlLines := strings.Split(string(xmlBytes), "\n")
+	assert.Equal(t, "    <pubDate>Tue, 02 Jan 2007 15:04:05 +0000</pubDate>", xmlLines[9])
+
+	xmlLines[8] = "    <lastBuildDate>Mon, 02 Jan 2006 15:04:05 +0000</lastBuildDate>"
+	require.Nil(t, ioutil.WriteFile(xmlFileName, []byte(strings.Join(xmlLines, "\n")), 0644))
+	changed, err = getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), items)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	xmlBytes, err = ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	assert.Equal(t, strings.Join(xmlLines, "\n"), string(xmlBytes))
+
+	items[0].Title = "new title"
+	changed, err = getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), items)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	xmlBytes, err = ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	xmlLines = strings.Split(string(xmlBytes), "\n")
+	assert.NotEqual(t, "    <lastBuildDate>Mon, 02 Jan 2006 15:04:05 +0000</lastBuildDate>", xmlLines[8])
+	assert.Equal(t, "      <title>new title</title>", xmlLines[12])
+}
+
+func TestXMLBuilderNoItems(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFileName := fmt.Sprintf("%s/xmlFile", outputFolder)
+	changed, err := getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), []*command.VideoData{})
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	xmlBytes, err := ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	assert.NotContains(t, string(xmlBytes), "<pubDate>")
+}
+
+func TestXMLBuilderCancelledLeavesFeed(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFileName := fmt.Sprintf("%s/xmlFile", outputFolder)
+	require.Nil(t, ioutil.WriteFile(xmlFileName, []byte("previous feed"), 0644))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	item := videoData1
+	changed, err := getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(ctx, []*command.VideoData{&item})
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, changed)
+	xmlBytes, err := ioutil.ReadFile(xmlFileName)
+	require.Nil(t, err)
+	assert.Equal(t, "previous feed", string(xmlBytes))
+	_, err = os.Stat(fmt.Sprintf("%s.tmp", xmlFileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestXMLBuilderWouldChange(t *testing.T) {
+	outputFolder := fmt.Sprintf("%s/testFeedTube", os.TempDir())
+	defer removeFile(t, outputFolder)
+	assert.Nil(t, os.MkdirAll(outputFolder, 0777))
+	xmlFileName := fmt.Sprintf("%s/xmlFile", outputFolder)
+	item := videoData1
+	item.Duration = "01:10:00"
+	items := []*command.VideoData{&item}
+	changed, err := getTestXMLBuilder(xmlFileName, outputFolder).WouldChange(context.Background(), items)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	_, err = os.Stat(xmlFileName)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = getTestXMLBuilder(xmlFileName, outputFolder).BuildRss(context.Background(), items)
+	require.Nil(t, err)
+	changed, err = getTestXMLBuilder(xmlFileName, outputFolder).WouldChange(context.Background(), items)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	item.Title = "new title"
+	changed, err = getTestXMLBuilder(xmlFileName, outputFolder).WouldChange(context.Background(), items)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+}
+
+func getTestXMLBuilder(xmlFileName, outputFolder string) *command.XMLBuilder {
+	return command.NewXMLBuilder(
+		&runner.Test{},
+		xmlFileName,
+		outputFolder,
+		"http://foo.com",
+		fmt.Sprintf("feedTube v%s (github.com/guywithnose/feedTube)", command.Version),
+		&command.ChannelInfo{
+			Title:       "t",
+			Description: "d",
+			Link:        "https://www.youtube.com/channel/awesomeChannelId",
+		},
+	)
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/guywithnose/feedTube/command"
 	"github.com/urfave/cli"
@@ -27,7 +30,18 @@ func main() {
 	app.BashComplete = command.RootCompletion
 	app.ErrWriter = os.Stderr
 
+	// Interrupted runs stop their downloads and leave the feed as it was
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	command.SetContext(app, ctx)
+
 	err := app.Run(os.Args)
+	if err != nil && ctx.Err() != nil {
+		fmt.Fprintf(app.ErrWriter, "Interrupted: %v\n", err)
+		stop()
+		os.Exit(130)
+	}
+
 	if err != nil {
 		panic(err)
 	}